@@ -0,0 +1,23 @@
+package aletis
+
+import (
+	"context"
+	"os"
+
+	"github.com/AletisSearch/aletis/internal/cli"
+	"github.com/AletisSearch/aletis/internal/config"
+	"github.com/AletisSearch/aletis/internal/webapp"
+)
+
+func StartWebServer(options ...config.Option) error {
+	return webapp.Start(options...)
+}
+
+// RunCommand starts the web server when no subcommand (or "serve") is given,
+// otherwise it runs the matching administrative command.
+func RunCommand(args []string, options ...config.Option) error {
+	if len(args) == 0 || args[0] == "serve" {
+		return StartWebServer(options...)
+	}
+	return cli.Run(context.Background(), os.Stdout, args, options...)
+}
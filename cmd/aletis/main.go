@@ -9,7 +9,7 @@ import (
 )
 
 func main() {
-	if err := aletis.StartWebServer(config.EnvConfigOptions()...); err != nil {
+	if err := aletis.RunCommand(os.Args[1:], config.EnvConfigOptions()...); err != nil {
 		slog.Error("application exited with an error", "ERR", err)
 		os.Exit(1)
 	}
@@ -2,6 +2,8 @@ package sqlcdb
 
 import (
 	"embed"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net/url"
 
@@ -12,11 +14,16 @@ import (
 //go:embed migrations/*.sql
 var FS embed.FS
 
-func ApplyMigrations(conf *config.Config) error {
+func newDBMate(conf *config.Config) *dbmate.DB {
 	u, _ := url.Parse(conf.DBconnStr())
 	db := dbmate.New(u)
 	db.FS = FS
 	db.MigrationsDir = []string{"./migrations"}
+	return db
+}
+
+func ApplyMigrations(conf *config.Config) error {
+	db := newDBMate(conf)
 
 	migrations, err := db.FindMigrations()
 	if err != nil {
@@ -33,3 +40,30 @@ func ApplyMigrations(conf *config.Config) error {
 	}
 	return nil
 }
+
+// Migrations lists the migrations embedded in this binary and whether each
+// has been applied.
+func Migrations(conf *config.Config) ([]dbmate.Migration, error) {
+	return newDBMate(conf).FindMigrations()
+}
+
+var ErrPendingMigrations = errors.New("migrations pending")
+
+// CheckMigrations returns ErrPendingMigrations when the database is behind
+// the migrations embedded in this binary.
+func CheckMigrations(conf *config.Config) error {
+	migrations, err := Migrations(conf)
+	if err != nil {
+		return err
+	}
+	pending := 0
+	for _, m := range migrations {
+		if !m.Applied {
+			pending++
+		}
+	}
+	if pending > 0 {
+		return fmt.Errorf("%w: %d", ErrPendingMigrations, pending)
+	}
+	return nil
+}
@@ -0,0 +1,23 @@
+-- migrate:up
+CREATE TABLE api_keys (
+    id bigserial PRIMARY KEY,
+    name text NOT NULL,
+    prefix text NOT NULL,
+    hash text NOT NULL UNIQUE,
+    scope text NOT NULL DEFAULT 'search',
+    rate_limit integer NOT NULL,
+    daily_quota integer NOT NULL,
+    created timestamptz NOT NULL DEFAULT now(),
+    revoked timestamptz
+);
+
+CREATE TABLE api_key_usage (
+    key_id bigint NOT NULL REFERENCES api_keys (id) ON DELETE CASCADE,
+    day date NOT NULL DEFAULT CURRENT_DATE,
+    count integer NOT NULL DEFAULT 0,
+    PRIMARY KEY (key_id, day)
+);
+
+-- migrate:down
+DROP TABLE api_key_usage;
+DROP TABLE api_keys;
@@ -0,0 +1,10 @@
+-- migrate:up
+CREATE UNLOGGED TABLE rate_limits (
+    key text NOT NULL,
+    window_start timestamptz NOT NULL,
+    count integer NOT NULL DEFAULT 0,
+    PRIMARY KEY (key, window_start)
+);
+
+-- migrate:down
+DROP TABLE rate_limits;
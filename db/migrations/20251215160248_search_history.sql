@@ -0,0 +1,31 @@
+-- migrate:up
+CREATE TABLE search_history (
+    id bigserial PRIMARY KEY,
+    user_id text NOT NULL,
+    query text NOT NULL,
+    source text NOT NULL DEFAULT 'search',
+    created timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX search_history_user_created_idx ON search_history (user_id, created DESC);
+
+CREATE TABLE history_clicks (
+    id bigserial PRIMARY KEY,
+    user_id text NOT NULL,
+    query text NOT NULL,
+    url text NOT NULL,
+    created timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX history_clicks_user_created_idx ON history_clicks (user_id, created DESC);
+
+CREATE TABLE saved_searches (
+    id bigserial PRIMARY KEY,
+    user_id text NOT NULL,
+    query text NOT NULL,
+    created timestamptz NOT NULL DEFAULT now(),
+    UNIQUE (user_id, query)
+);
+
+-- migrate:down
+DROP TABLE saved_searches;
+DROP TABLE history_clicks;
+DROP TABLE search_history;
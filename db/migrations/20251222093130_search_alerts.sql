@@ -0,0 +1,27 @@
+-- migrate:up
+ALTER TABLE saved_searches
+    ADD COLUMN alert boolean NOT NULL DEFAULT false,
+    ADD COLUMN feed_token text NOT NULL UNIQUE DEFAULT gen_random_uuid()::text,
+    ADD COLUMN last_run timestamptz;
+CREATE INDEX saved_searches_alert_last_run_idx ON saved_searches (last_run) WHERE alert;
+
+CREATE TABLE alert_results (
+    saved_search_id bigint NOT NULL REFERENCES saved_searches (id) ON DELETE CASCADE,
+    url text NOT NULL,
+    title text NOT NULL,
+    content text NOT NULL,
+    baseline boolean NOT NULL,
+    -- pending results are still to be sent to the webhook
+    pending boolean NOT NULL DEFAULT false,
+    first_seen timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (saved_search_id, url)
+);
+CREATE INDEX alert_results_first_seen_idx ON alert_results (saved_search_id, first_seen DESC) WHERE NOT baseline;
+CREATE INDEX alert_results_pending_idx ON alert_results (saved_search_id, first_seen) WHERE pending;
+
+-- migrate:down
+DROP TABLE alert_results;
+ALTER TABLE saved_searches
+    DROP COLUMN alert,
+    DROP COLUMN feed_token,
+    DROP COLUMN last_run;
@@ -0,0 +1,10 @@
+-- migrate:up
+-- Entries written before namespaces existed use keys that are never looked
+-- up again, so they are dropped instead of migrated.
+DELETE FROM cache;
+ALTER TABLE cache ADD COLUMN namespace text NOT NULL DEFAULT '';
+CREATE INDEX cache_namespace_idx ON cache (namespace);
+
+-- migrate:down
+DROP INDEX cache_namespace_idx;
+ALTER TABLE cache DROP COLUMN namespace;
@@ -0,0 +1,7 @@
+-- migrate:up
+ALTER TABLE cache ADD COLUMN accessed timestamptz NOT NULL DEFAULT now();
+CREATE INDEX cache_accessed_idx ON cache (accessed);
+
+-- migrate:down
+DROP INDEX cache_accessed_idx;
+ALTER TABLE cache DROP COLUMN accessed;
@@ -0,0 +1,27 @@
+-- migrate:up
+CREATE TABLE settings (
+    key text PRIMARY KEY,
+    value text NOT NULL,
+    updated timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE domain_rules (
+    domain text PRIMARY KEY,
+    rule text NOT NULL CHECK (rule IN ('block', 'high', 'low')),
+    created timestamptz NOT NULL DEFAULT now()
+);
+
+CREATE TABLE llm_usage (
+    day date NOT NULL DEFAULT CURRENT_DATE,
+    model text NOT NULL,
+    requests bigint NOT NULL DEFAULT 0,
+    prompt_tokens bigint NOT NULL DEFAULT 0,
+    completion_tokens bigint NOT NULL DEFAULT 0,
+    cost double precision NOT NULL DEFAULT 0,
+    PRIMARY KEY (day, model)
+);
+
+-- migrate:down
+DROP TABLE llm_usage;
+DROP TABLE domain_rules;
+DROP TABLE settings;
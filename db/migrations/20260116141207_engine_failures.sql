@@ -0,0 +1,10 @@
+-- migrate:up
+CREATE TABLE engine_failures (
+    engine text NOT NULL,
+    reason text NOT NULL,
+    created timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX engine_failures_created_idx ON engine_failures (created);
+
+-- migrate:down
+DROP TABLE engine_failures;
@@ -0,0 +1,41 @@
+-- migrate:up
+-- A click counts once per client, query and result within a day. Clients
+-- are a hash of their address keyed with a salt of the day, which is
+-- deleted once the day is over.
+CREATE TABLE click_salts (
+    day date PRIMARY KEY DEFAULT current_date,
+    salt bytea NOT NULL
+);
+
+CREATE TABLE click_events (
+    query_hash text NOT NULL,
+    url text NOT NULL,
+    domain text NOT NULL,
+    position integer NOT NULL,
+    client bytea NOT NULL,
+    created timestamptz NOT NULL DEFAULT now()
+);
+CREATE INDEX click_events_created_idx ON click_events (created);
+CREATE UNIQUE INDEX click_events_client_idx ON click_events (query_hash, url, client);
+
+CREATE TABLE click_query_stats (
+    query_hash text NOT NULL,
+    url text NOT NULL,
+    clicks bigint NOT NULL,
+    weight double precision NOT NULL,
+    updated timestamptz NOT NULL DEFAULT now(),
+    PRIMARY KEY (query_hash, url)
+);
+
+CREATE TABLE click_domain_stats (
+    domain text PRIMARY KEY,
+    clicks bigint NOT NULL,
+    weight double precision NOT NULL,
+    updated timestamptz NOT NULL DEFAULT now()
+);
+
+-- migrate:down
+DROP TABLE click_domain_stats;
+DROP TABLE click_query_stats;
+DROP TABLE click_events;
+DROP TABLE click_salts;
@@ -0,0 +1,27 @@
+-- migrate:up
+CREATE TABLE query_log (
+    query text NOT NULL,
+    day date NOT NULL DEFAULT current_date,
+    searches bigint NOT NULL DEFAULT 1,
+    PRIMARY KEY (query, day)
+);
+CREATE INDEX query_log_day_idx ON query_log (day);
+
+-- Searches are counted once per client and day. Clients are kept as a hash
+-- keyed by a salt of the day, and both are deleted once the day is over.
+CREATE TABLE query_log_salts (
+    day date PRIMARY KEY DEFAULT current_date,
+    salt bytea NOT NULL
+);
+CREATE TABLE query_log_clients (
+    query text NOT NULL,
+    day date NOT NULL DEFAULT current_date,
+    client bytea NOT NULL,
+    PRIMARY KEY (query, day, client)
+);
+CREATE INDEX query_log_clients_day_idx ON query_log_clients (day);
+
+-- migrate:down
+DROP TABLE query_log_clients;
+DROP TABLE query_log_salts;
+DROP TABLE query_log;
@@ -0,0 +1,17 @@
+-- migrate:up
+CREATE TABLE documents (
+    id bigserial PRIMARY KEY,
+    source text NOT NULL,
+    url text NOT NULL,
+    title text NOT NULL,
+    body text NOT NULL,
+    modified timestamptz NOT NULL,
+    search tsvector GENERATED ALWAYS AS (
+        setweight(to_tsvector('english', title), 'A') || setweight(to_tsvector('english', body), 'B')
+    ) STORED,
+    UNIQUE (source, url)
+);
+CREATE INDEX documents_search_idx ON documents USING gin (search);
+
+-- migrate:down
+DROP TABLE documents;
@@ -0,0 +1,13 @@
+-- migrate:up
+ALTER TABLE documents
+    ADD COLUMN path text NOT NULL DEFAULT '',
+    ADD COLUMN chunk integer NOT NULL DEFAULT 0,
+    DROP CONSTRAINT documents_source_url_key,
+    ADD CONSTRAINT documents_source_path_chunk_key UNIQUE (source, path, chunk);
+
+-- migrate:down
+ALTER TABLE documents
+    DROP CONSTRAINT documents_source_path_chunk_key,
+    ADD CONSTRAINT documents_source_url_key UNIQUE (source, url),
+    DROP COLUMN chunk,
+    DROP COLUMN path;
@@ -1,14 +1,380 @@
 -- Cache queries using hstore for key-value data storage
 -- name: GetCache :one
-SELECT data, expires FROM cache
+-- accessed is only refreshed hourly to keep reads from turning into writes
+WITH touched AS (
+    UPDATE cache SET accessed = now()
+    WHERE key = $1 AND accessed < now() - interval '1 hour'
+)
+SELECT namespace, data, expires FROM cache
 WHERE key = $1 LIMIT 1;
 
 -- name: InsertCache :exec
-INSERT INTO cache (key, data, expires)
-VALUES ($1, $2, $3)
+INSERT INTO cache (key, namespace, data, expires)
+VALUES ($1, $2, $3, $4)
 ON CONFLICT(key) DO UPDATE SET
+    namespace = excluded.namespace,
     data = excluded.data,
-    expires = excluded.expires;
+    expires = excluded.expires,
+    accessed = now();
 
 -- name: DeleteOld :exec
-DELETE FROM cache WHERE expires <= $1;
\ No newline at end of file
+DELETE FROM cache WHERE expires <= $1;
+
+-- name: EvictCache :execrows
+-- Keeps the most recently accessed rows whose data fits in the budget
+DELETE FROM cache WHERE key IN (
+    SELECT key FROM (
+        SELECT key, sum(octet_length(data)) OVER (ORDER BY accessed DESC, key) AS total
+        FROM cache
+    ) ranked
+    WHERE total > sqlc.arg(budget)::bigint
+);
+
+-- name: PurgeCacheNamespace :execrows
+DELETE FROM cache WHERE namespace = $1;
+
+-- name: PurgeCacheMatching :execrows
+DELETE FROM cache
+WHERE namespace = sqlc.arg(namespace) AND key ~ sqlc.arg(pattern)::text;
+
+-- name: CacheStats :many
+SELECT namespace, count(*) AS entries, COALESCE(sum(octet_length(data)), 0)::bigint AS bytes
+FROM cache
+GROUP BY namespace
+ORDER BY namespace;
+
+-- name: CreateAPIKey :one
+INSERT INTO api_keys (name, prefix, hash, scope, rate_limit, daily_quota)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING *;
+
+-- name: GetAPIKeyByHash :one
+SELECT * FROM api_keys
+WHERE hash = $1 LIMIT 1;
+
+-- name: ListAPIKeys :many
+SELECT * FROM api_keys
+ORDER BY id;
+
+-- name: RevokeAPIKey :execrows
+UPDATE api_keys SET revoked = now()
+WHERE id = $1 AND revoked IS NULL;
+
+-- name: IncrementAPIKeyUsage :one
+INSERT INTO api_key_usage (key_id, count)
+VALUES ($1, 1)
+ON CONFLICT(key_id, day) DO UPDATE SET
+    count = api_key_usage.count + 1
+RETURNING count;
+
+-- name: DeleteOldAPIKeyUsage :exec
+DELETE FROM api_key_usage WHERE day < CURRENT_DATE - 30;
+
+-- name: IncrementRateLimit :exec
+INSERT INTO rate_limits (key, window_start, count)
+VALUES ($1, $2, $3)
+ON CONFLICT(key, window_start) DO UPDATE SET
+    count = rate_limits.count + excluded.count;
+
+-- name: TakeRateLimit :one
+-- Counts a request and returns the counts of the current window, including
+-- it, and of the previous window. Concurrent replicas are serialized by the
+-- row lock of the upsert, so each sees the requests taken before its own.
+WITH taken AS (
+    INSERT INTO rate_limits (key, window_start, count)
+    VALUES (@key, @current_window::timestamptz, 1)
+    ON CONFLICT(key, window_start) DO UPDATE SET
+        count = rate_limits.count + 1
+    RETURNING count
+)
+SELECT
+    (SELECT count FROM taken)::integer AS current_count,
+    COALESCE((
+        SELECT count FROM rate_limits
+        WHERE key = @key AND window_start = @previous_window::timestamptz
+    ), 0)::integer AS previous_count;
+
+-- name: DeleteOldRateLimits :exec
+DELETE FROM rate_limits WHERE window_start < $1;
+
+-- name: InsertSearchHistory :exec
+INSERT INTO search_history (user_id, query, source)
+VALUES ($1, $2, $3);
+
+-- name: ListSearchHistory :many
+SELECT * FROM search_history
+WHERE user_id = @user_id AND query ILIKE '%' || @filter::text || '%'
+ORDER BY created DESC
+LIMIT @max_rows;
+
+-- name: DeleteSearchHistoryEntry :exec
+DELETE FROM search_history WHERE id = $1 AND user_id = $2;
+
+-- name: DeleteSearchHistory :exec
+DELETE FROM search_history WHERE user_id = $1;
+
+-- name: DeleteOldSearchHistory :exec
+DELETE FROM search_history WHERE created <= $1;
+
+-- name: InsertHistoryClick :exec
+INSERT INTO history_clicks (user_id, query, url)
+VALUES ($1, $2, $3);
+
+-- name: ListHistoryClicks :many
+SELECT * FROM history_clicks
+WHERE user_id = @user_id AND (query ILIKE '%' || @filter::text || '%' OR url ILIKE '%' || @filter::text || '%')
+ORDER BY created DESC
+LIMIT @max_rows;
+
+-- name: DeleteHistoryClickEntry :exec
+DELETE FROM history_clicks WHERE id = $1 AND user_id = $2;
+
+-- name: DeleteHistoryClicks :exec
+DELETE FROM history_clicks WHERE user_id = $1;
+
+-- name: DeleteOldHistoryClicks :exec
+DELETE FROM history_clicks WHERE created <= $1;
+
+-- name: InsertSavedSearch :exec
+INSERT INTO saved_searches (user_id, query)
+VALUES ($1, $2)
+ON CONFLICT(user_id, query) DO NOTHING;
+
+-- name: ListSavedSearches :many
+SELECT * FROM saved_searches
+WHERE user_id = $1
+ORDER BY created DESC;
+
+-- name: DeleteSavedSearch :exec
+DELETE FROM saved_searches WHERE id = $1 AND user_id = $2;
+
+-- name: DeleteSavedSearches :exec
+DELETE FROM saved_searches WHERE user_id = $1;
+
+-- name: SetSavedSearchAlert :execrows
+UPDATE saved_searches SET alert = $3
+WHERE id = $1 AND user_id = $2;
+
+-- name: GetSavedSearchByFeedToken :one
+SELECT * FROM saved_searches
+WHERE feed_token = $1 AND alert LIMIT 1;
+
+-- name: ClaimDueAlerts :many
+-- Alerts are claimed by moving their last run to now, rows claimed by
+-- another replica at the same time are skipped.
+WITH due AS (
+    SELECT id, last_run FROM saved_searches
+    WHERE alert AND (last_run IS NULL OR last_run <= @due_before::timestamptz)
+    ORDER BY last_run NULLS FIRST
+    LIMIT 50
+    FOR UPDATE SKIP LOCKED
+)
+UPDATE saved_searches SET last_run = @claimed::timestamptz
+FROM due
+WHERE saved_searches.id = due.id
+RETURNING saved_searches.id, saved_searches.query, due.last_run AS previous_run;
+
+-- name: SetAlertLastRun :exec
+UPDATE saved_searches SET last_run = $2
+WHERE id = $1;
+
+-- name: InsertAlertResult :execrows
+INSERT INTO alert_results (saved_search_id, url, title, content, baseline, pending)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT(saved_search_id, url) DO NOTHING;
+
+-- name: ListPendingAlertResults :many
+SELECT url, title, content FROM alert_results
+WHERE saved_search_id = $1 AND pending
+ORDER BY first_seen
+LIMIT 100;
+
+-- name: SetAlertResultsSent :exec
+UPDATE alert_results SET pending = false
+WHERE saved_search_id = $1 AND url = ANY(@urls::text[]);
+
+-- name: ListAlertResults :many
+SELECT * FROM alert_results
+WHERE saved_search_id = $1 AND NOT baseline
+ORDER BY first_seen DESC
+LIMIT $2;
+
+-- name: GetSetting :one
+SELECT value FROM settings
+WHERE key = $1 LIMIT 1;
+
+-- name: SetSetting :exec
+INSERT INTO settings (key, value)
+VALUES ($1, $2)
+ON CONFLICT(key) DO UPDATE SET
+    value = excluded.value,
+    updated = now();
+
+-- name: ListDomainRules :many
+SELECT domain, rule, created FROM domain_rules
+ORDER BY domain;
+
+-- name: SetDomainRule :exec
+INSERT INTO domain_rules (domain, rule)
+VALUES ($1, $2)
+ON CONFLICT(domain) DO UPDATE SET
+    rule = excluded.rule;
+
+-- name: DeleteDomainRule :execrows
+DELETE FROM domain_rules WHERE domain = $1;
+
+-- name: IncrementLLMUsage :exec
+INSERT INTO llm_usage (model, requests, prompt_tokens, completion_tokens, cost)
+VALUES ($1, 1, $2, $3, $4)
+ON CONFLICT(day, model) DO UPDATE SET
+    requests = llm_usage.requests + 1,
+    prompt_tokens = llm_usage.prompt_tokens + excluded.prompt_tokens,
+    completion_tokens = llm_usage.completion_tokens + excluded.completion_tokens,
+    cost = llm_usage.cost + excluded.cost;
+
+-- name: ListLLMUsage :many
+SELECT day, model, requests, prompt_tokens, completion_tokens, cost FROM llm_usage
+WHERE day >= $1
+ORDER BY day DESC, model;
+
+-- name: InsertEngineFailure :exec
+INSERT INTO engine_failures (engine, reason)
+VALUES ($1, $2);
+
+-- name: ListEngineFailures :many
+SELECT * FROM engine_failures
+ORDER BY created DESC
+LIMIT $1;
+
+-- name: CountEngineFailures :many
+SELECT engine, count(*) AS failures FROM engine_failures
+WHERE created > $1
+GROUP BY engine
+ORDER BY failures DESC, engine;
+
+-- name: DeleteOldEngineFailures :exec
+DELETE FROM engine_failures WHERE created < $1;
+
+-- name: InsertClickEvent :exec
+INSERT INTO click_events (query_hash, url, domain, position, client)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT(query_hash, url, client) DO NOTHING;
+
+-- name: DeleteOldClickEvents :exec
+DELETE FROM click_events WHERE created < $1;
+
+-- name: GetClickSalt :one
+WITH inserted AS (
+    INSERT INTO click_salts (salt)
+    VALUES ($1)
+    ON CONFLICT(day) DO NOTHING
+    RETURNING salt
+)
+SELECT salt FROM inserted
+UNION ALL
+SELECT salt FROM click_salts WHERE day = current_date
+LIMIT 1;
+
+-- name: DeleteOldClickSalts :exec
+DELETE FROM click_salts WHERE day < current_date;
+
+-- name: RefreshClickQueryStats :exec
+INSERT INTO click_query_stats (query_hash, url, clicks, weight, updated)
+SELECT query_hash, url, count(*), sum(ln(position + 2) / ln(2)), now()
+FROM click_events
+WHERE created > @since
+GROUP BY query_hash, url
+HAVING count(*) >= @min_clicks::bigint
+ON CONFLICT(query_hash, url) DO UPDATE SET
+    clicks = excluded.clicks,
+    weight = excluded.weight,
+    updated = excluded.updated;
+
+-- name: DeleteStaleClickQueryStats :exec
+DELETE FROM click_query_stats WHERE updated < $1;
+
+-- name: RefreshClickDomainStats :exec
+INSERT INTO click_domain_stats (domain, clicks, weight, updated)
+SELECT domain, count(*), sum(ln(position + 2) / ln(2)), now()
+FROM click_events
+WHERE created > @since
+GROUP BY domain
+HAVING count(*) >= @min_clicks::bigint
+ON CONFLICT(domain) DO UPDATE SET
+    clicks = excluded.clicks,
+    weight = excluded.weight,
+    updated = excluded.updated;
+
+-- name: DeleteStaleClickDomainStats :exec
+DELETE FROM click_domain_stats WHERE updated < $1;
+
+-- name: ListClickQueryStats :many
+SELECT * FROM click_query_stats
+WHERE query_hash = $1;
+
+-- name: ListClickDomainStats :many
+SELECT * FROM click_domain_stats
+ORDER BY weight DESC
+LIMIT $1;
+
+-- name: IncrementQueryLog :exec
+WITH client AS (
+    INSERT INTO query_log_clients (query, client)
+    VALUES (@query, @client)
+    ON CONFLICT DO NOTHING
+    RETURNING query
+)
+INSERT INTO query_log (query)
+SELECT query FROM client
+ON CONFLICT(query, day) DO UPDATE SET
+    searches = query_log.searches + 1;
+
+-- name: GetQueryLogSalt :one
+WITH inserted AS (
+    INSERT INTO query_log_salts (salt)
+    VALUES ($1)
+    ON CONFLICT(day) DO NOTHING
+    RETURNING salt
+)
+SELECT salt FROM inserted
+UNION ALL
+SELECT salt FROM query_log_salts WHERE day = current_date
+LIMIT 1;
+
+-- name: DeleteOldQueryLogClients :exec
+WITH salts AS (
+    DELETE FROM query_log_salts WHERE day < current_date
+)
+DELETE FROM query_log_clients WHERE day < current_date;
+
+-- name: ListPopularQueries :many
+SELECT query, sum(searches)::bigint AS searches FROM query_log
+WHERE day >= @since
+GROUP BY query
+HAVING sum(searches) >= @min_searches::bigint
+ORDER BY searches DESC, query
+LIMIT @max_rows;
+
+-- name: DeleteOldQueryLog :exec
+DELETE FROM query_log WHERE day < $1;
+
+-- name: SearchDocuments :many
+SELECT url, title,
+    ts_headline('english', body, q, 'MaxFragments=2, MinWords=10, MaxWords=25, StartSel="", StopSel=""')::text AS snippet,
+    modified, ts_rank_cd(search, q) AS rank
+FROM documents, websearch_to_tsquery('english', @query) q
+WHERE search @@ q AND (@source::text = '' OR source = @source)
+ORDER BY rank DESC
+LIMIT @max_rows;
+
+-- name: ListDocumentFiles :many
+SELECT path, max(modified)::timestamptz AS modified FROM documents
+WHERE source = $1
+GROUP BY path;
+
+-- name: DeleteDocumentFile :exec
+DELETE FROM documents WHERE source = $1 AND path = $2;
+
+-- name: InsertDocumentChunks :exec
+INSERT INTO documents (source, path, chunk, url, title, body, modified)
+SELECT @source::text, @path::text, unnest(@chunks::integer[]), unnest(@urls::text[]), @title::text, unnest(@bodies::text[]), @modified::timestamptz;
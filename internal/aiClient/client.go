@@ -4,8 +4,10 @@ package aiclient
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json/v2"
-	"errors"
+	"fmt"
 	"log/slog"
 	"strings"
 	"time"
@@ -13,13 +15,19 @@ import (
 	"github.com/AletisSearch/aletis/internal/cache"
 	"github.com/AletisSearch/aletis/internal/db"
 	"github.com/AletisSearch/aletis/internal/message"
+	"github.com/AletisSearch/aletis/internal/metrics"
+	"github.com/AletisSearch/aletis/internal/tracing"
 	"github.com/openai/openai-go/v3"
 	"github.com/openai/openai-go/v3/option"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+const queryExpandModel = "google/gemma-3-12b-it"
+
 type Client struct {
 	apiClient openai.Client
 	cache     *cache.Cache[Output, *Output]
+	q         *db.Queries
 }
 type CompletionUsage struct {
 	Cost        float64 `json:"cost"`
@@ -36,8 +44,11 @@ type Output struct {
 	Cost    float64 `json:"cost"`
 }
 
-func NewClient(baseurl, openaiKey string, db *db.Queries) *Client {
+// NewClient creates an LLM client. Usage is recorded per day and model when
+// q is not nil.
+func NewClient(baseurl, openaiKey string, store cache.Store, q *db.Queries) *Client {
 	c := &Client{
+		q: q,
 		apiClient: openai.NewClient(
 			option.WithBaseURL(baseurl),
 			option.WithAPIKey(openaiKey),
@@ -46,12 +57,39 @@ func NewClient(baseurl, openaiKey string, db *db.Queries) *Client {
 			option.WithHeader("HTTP-Referer", "https://github.com/AletisSearch/aletis"),
 			option.WithHeader("X-Title", "Aletis"),
 		),
-		cache: cache.New[Output](db),
+		cache: cache.New[Output](store, cache.Namespace{Name: "ai", Version: "1"},
+			cache.WithStaleWhileRevalidate(time.Hour),
+			cache.WithNegativeCache(time.Minute),
+		),
 	}
 	return c
 }
 
 func (c *Client) RunQueryExpand(ctx context.Context, q string) (*Output, error) {
+	system, us, err := queryExpandPrompt()
+	if err != nil {
+		return nil, err
+	}
+	return c.cache.GetOrFetch(ctx, queryExpandKey(system, us, q), func(ctx context.Context) (*Output, time.Duration, error) {
+		out, err := c.Run(ctx, queryExpandModel, system, q, us...)
+		if err != nil {
+			return nil, 0, err
+		}
+		return out, time.Hour * 25, nil
+	})
+}
+
+// CachedQueryExpand returns the expansion of q if there is one in the cache,
+// without asking the model for it.
+func (c *Client) CachedQueryExpand(ctx context.Context, q string) (*Output, error) {
+	system, us, err := queryExpandPrompt()
+	if err != nil {
+		return nil, err
+	}
+	return c.cache.Get(ctx, queryExpandKey(system, us, q))
+}
+
+func queryExpandPrompt() (string, []message.UserAssistant, error) {
 	var sysMsg strings.Builder
 	mData := message.MessageData{
 		Year: time.Now().Year(),
@@ -59,29 +97,32 @@ func (c *Client) RunQueryExpand(ctx context.Context, q string) (*Output, error)
 		// Gender: "Male",
 	}
 	sysMsg.WriteString(message.SystemQueryExpand(3, 5, mData))
-	cacheKey := "aiClient-" + q
-
-	o, err := c.cache.Get(ctx, cacheKey)
-	if err == nil {
-		slog.Info("Cache Hit", "Key", cacheKey)
-		return o, nil
-	}
-	if !errors.Is(err, cache.ErrNotFoundInCache) && !errors.Is(err, cache.ErrOldCache) {
-		return nil, err
-	}
-
 	us, err := message.TemplateToUserAssistant(message.QueryExpandData, mData)
 	if err != nil {
-		return &Output{}, err
+		return "", nil, err
 	}
-	out, err := c.Run(ctx, "google/gemma-3-12b-it", sysMsg.String(), q, us...)
-	if err != nil {
-		return nil, err
+	return sysMsg.String(), us, nil
+}
+
+// queryExpandKey includes the prompt so that editing it never serves
+// answers produced by the old one.
+func queryExpandKey(system string, us []message.UserAssistant, q string) string {
+	return promptHash(queryExpandModel, system, us) + "-" + q
+}
+
+func promptHash(model, system string, messages []message.UserAssistant) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\x00%s\x00", model, system)
+	for _, m := range messages {
+		fmt.Fprintf(h, "%s\x00%s\x00", m.User, m.Assistant)
 	}
-	return out, c.cache.Set(ctx, cacheKey, out, time.Hour*25)
+	return hex.EncodeToString(h.Sum(nil)[:8])
 }
 
-func (c *Client) Run(ctx context.Context, model, system, query string, messages ...message.UserAssistant) (*Output, error) {
+func (c *Client) Run(ctx context.Context, model, system, query string, messages ...message.UserAssistant) (_ *Output, err error) {
+	ctx, span := tracing.Start(ctx, "llm.Run", attribute.String("gen_ai.request.model", model))
+	defer func() { tracing.End(span, err) }()
+
 	m := message.AiMessage{
 		openai.SystemMessage(system),
 	}
@@ -89,12 +130,14 @@ func (c *Client) Run(ctx context.Context, model, system, query string, messages
 		m.AddUserAssistant(messages)
 	}
 	m.AddUser(query)
+	start := time.Now()
 	chatCompletion, err := c.apiClient.Chat.Completions.New(ctx, openai.ChatCompletionNewParams{
 		Messages: m,
 		//Model:    "google/gemini-2.5-flash-lite-preview-09-2025",
 		Model: model,
 		//ReasoningEffort: "minimal",
 	})
+	metrics.ObserveLLM(model, time.Since(start), err)
 	if err != nil {
 		return nil, err
 	}
@@ -103,6 +146,29 @@ func (c *Client) Run(ctx context.Context, model, system, query string, messages
 	if err = json.Unmarshal([]byte(chatCompletion.Usage.RawJSON()), &cost); err != nil {
 		return nil, err
 	}
+	metrics.LLMUsage(model, chatCompletion.Usage.PromptTokens, chatCompletion.Usage.CompletionTokens, cost.Cost)
+	span.SetAttributes(
+		attribute.Int64("gen_ai.usage.input_tokens", chatCompletion.Usage.PromptTokens),
+		attribute.Int64("gen_ai.usage.output_tokens", chatCompletion.Usage.CompletionTokens),
+		attribute.Float64("aletis.llm.cost", cost.Cost),
+	)
+	if c.q != nil {
+		err := c.q.IncrementLLMUsage(ctx, db.IncrementLLMUsageParams{
+			Model:            model,
+			PromptTokens:     chatCompletion.Usage.PromptTokens,
+			CompletionTokens: chatCompletion.Usage.CompletionTokens,
+			Cost:             cost.Cost,
+		})
+		if err != nil {
+			slog.Error("unable to record llm usage", "ERROR", err)
+		}
+	}
 
 	return &Output{Content: chatCompletion.Choices[0].Message.Content, Cost: cost.Cost}, nil
 }
+
+// Ping checks that the LLM endpoint is reachable and accepts the API key.
+func (c *Client) Ping(ctx context.Context) error {
+	_, err := c.apiClient.Models.List(ctx)
+	return err
+}
@@ -0,0 +1,163 @@
+package alerts
+
+import (
+	"context"
+	"encoding/json/v2"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/AletisSearch/aletis/internal/db"
+	"github.com/AletisSearch/aletis/internal/egress"
+	"github.com/AletisSearch/aletis/internal/searxng"
+	"resty.dev/v3"
+)
+
+// Scheduler periodically re-runs saved searches that have alerts enabled and
+// records results that were not seen on an earlier run.
+type Scheduler struct {
+	q           *db.Queries
+	search      *searxng.Client
+	interval    time.Duration
+	webhookURL  string
+	restyClient *resty.Client
+}
+
+func New(q *db.Queries, search *searxng.Client, interval time.Duration, webhookURL string, f *egress.Factory) *Scheduler {
+	return &Scheduler{
+		q:           q,
+		search:      search,
+		interval:    interval,
+		webhookURL:  webhookURL,
+		restyClient: resty.NewWithClient(f.Client(egress.WithTrusted())),
+	}
+}
+
+type Hit struct {
+	URL     string `json:"url"`
+	Title   string `json:"title"`
+	Content string `json:"content"`
+}
+
+type WebhookPayload struct {
+	SavedSearchID int64     `json:"saved_search_id"`
+	Query         string    `json:"query"`
+	Time          time.Time `json:"time"`
+	Results       []Hit     `json:"results"`
+}
+
+// Run checks for due alerts every few minutes until ctx is cancelled.
+func (s *Scheduler) Run(ctx context.Context) {
+	defer s.restyClient.Close()
+	t := time.NewTicker(min(s.interval, time.Minute*5))
+	defer t.Stop()
+	for {
+		s.runDue(ctx)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			slog.Info("Closing Alerts Scheduler")
+			return
+		}
+	}
+}
+
+func (s *Scheduler) runDue(ctx context.Context) {
+	now := time.Now()
+	due, err := s.q.ClaimDueAlerts(ctx, db.ClaimDueAlertsParams{DueBefore: now.Add(-s.interval), Claimed: now})
+	if err != nil {
+		slog.Error("unable to claim due alerts", "ERROR", err)
+		return
+	}
+	for _, a := range due {
+		if ctx.Err() != nil {
+			// Alerts that didn't get to run are due again on the next start
+			s.release(context.WithoutCancel(ctx), a)
+			continue
+		}
+		if err = s.runOne(ctx, a, now); err != nil {
+			slog.Error("unable to run alert", "ID", a.ID, "ERROR", err)
+		}
+	}
+}
+
+// release gives back the claim on an alert that couldn't be run, so that it
+// is tried again on the next check rather than after a whole interval.
+func (s *Scheduler) release(ctx context.Context, a db.ClaimDueAlertsRow) {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	if err := s.q.SetAlertLastRun(ctx, db.SetAlertLastRunParams{ID: a.ID, LastRun: a.PreviousRun}); err != nil {
+		slog.Error("unable to release alert", "ID", a.ID, "ERROR", err)
+	}
+}
+
+func (s *Scheduler) runOne(ctx context.Context, a db.ClaimDueAlertsRow, now time.Time) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+
+	sr, err := s.search.Search(ctx, a.Query)
+	if err != nil && sr == nil {
+		s.release(context.WithoutCancel(ctx), a)
+		return err
+	}
+	// The first run only records what already exists
+	baseline := a.PreviousRun == nil
+	found := 0
+	for _, r := range sr.Results {
+		n, err := s.q.InsertAlertResult(ctx, db.InsertAlertResultParams{
+			SavedSearchID: a.ID,
+			Url:           r.URL,
+			Title:         r.Title,
+			Content:       r.Content,
+			Baseline:      baseline,
+			Pending:       !baseline && s.webhookURL != "",
+		})
+		if err != nil {
+			return err
+		}
+		if n > 0 && !baseline {
+			found++
+		}
+	}
+	if found > 0 {
+		slog.Info("New alert results", "ID", a.ID, "Count", found)
+	}
+	if s.webhookURL == "" {
+		return nil
+	}
+
+	// Results whose delivery failed on earlier runs are sent again
+	pending, err := s.q.ListPendingAlertResults(ctx, a.ID)
+	if err != nil || len(pending) == 0 {
+		return err
+	}
+	hits := make([]Hit, 0, len(pending))
+	urls := make([]string, 0, len(pending))
+	for _, r := range pending {
+		hits = append(hits, Hit{URL: r.Url, Title: r.Title, Content: r.Content})
+		urls = append(urls, r.Url)
+	}
+	if err = s.notify(ctx, WebhookPayload{SavedSearchID: a.ID, Query: a.Query, Time: now, Results: hits}); err != nil {
+		return err
+	}
+	return s.q.SetAlertResultsSent(ctx, db.SetAlertResultsSentParams{SavedSearchID: a.ID, Urls: urls})
+}
+
+func (s *Scheduler) notify(ctx context.Context, p WebhookPayload) error {
+	body, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	res, err := s.restyClient.R().WithContext(ctx).
+		SetHeader("Content-Type", "application/json").
+		SetBody(body).
+		Post(s.webhookURL)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode() >= 400 {
+		return fmt.Errorf("alert webhook responded with status: %d", res.StatusCode())
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package apikey
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AletisSearch/aletis/internal/db"
+	"github.com/AletisSearch/aletis/internal/ratelimit"
+	"github.com/go-chi/httprate"
+	"github.com/jackc/pgx/v5"
+)
+
+const Header = "X-API-Key"
+
+const keyPrefix = "aletis_"
+
+type Scope string
+
+const (
+	ScopeSearch Scope = "search"
+	ScopeAI     Scope = "ai"
+)
+
+var ErrInvalidKey = errors.New("invalid api key")
+var ErrRevokedKey = errors.New("api key revoked")
+var ErrQuotaExceeded = errors.New("api key daily quota exceeded")
+var ErrBadScope = errors.New("unknown api key scope")
+
+func ParseScope(s string) (Scope, error) {
+	switch Scope(s) {
+	case ScopeSearch, ScopeAI:
+		return Scope(s), nil
+	}
+	return "", fmt.Errorf("%w: %s", ErrBadScope, s)
+}
+
+// Generate returns a new random key along with the short prefix shown in
+// listings and the hash that is stored in the database.
+func Generate() (key, prefix, hash string, err error) {
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", "", err
+	}
+	key = keyPrefix + base64.RawURLEncoding.EncodeToString(b)
+	return key, key[:len(keyPrefix)+6], Hash(key), nil
+}
+
+func Hash(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+type ctxKey struct{}
+
+func FromContext(ctx context.Context) (*db.ApiKey, bool) {
+	k, ok := ctx.Value(ctxKey{}).(*db.ApiKey)
+	return k, ok
+}
+
+// AIAllowed reports whether the request may use the AI endpoints. Anonymous
+// requests are governed by the instance config alone.
+func AIAllowed(ctx context.Context) bool {
+	k, ok := FromContext(ctx)
+	if !ok {
+		return true
+	}
+	return Scope(k.Scope) == ScopeAI
+}
+
+func lookup(ctx context.Context, q *db.Queries, key string) (*db.ApiKey, error) {
+	if !strings.HasPrefix(key, keyPrefix) {
+		return nil, ErrInvalidKey
+	}
+	k, err := q.GetAPIKeyByHash(ctx, Hash(key))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, ErrInvalidKey
+		}
+		return nil, err
+	}
+	if k.Revoked != nil {
+		return nil, ErrRevokedKey
+	}
+	return &k, nil
+}
+
+// use counts a request against the daily quota of k.
+func use(ctx context.Context, q *db.Queries, k *db.ApiKey) error {
+	if k.DailyQuota <= 0 {
+		return nil
+	}
+	count, err := q.IncrementAPIKeyUsage(ctx, k.ID)
+	if err != nil {
+		return err
+	}
+	if count > k.DailyQuota {
+		return ErrQuotaExceeded
+	}
+	return nil
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, ErrInvalidKey), errors.Is(err, ErrRevokedKey):
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+	case errors.Is(err, ErrQuotaExceeded):
+		ratelimit.Reject("quota")
+		w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(tomorrow()).Seconds())))
+		http.Error(w, err.Error(), http.StatusTooManyRequests)
+	default:
+		slog.Error("unable to check api key", "ERROR", err)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
+}
+
+// Middleware authenticates requests carrying an API key header. Requests
+// without the header pass through anonymously.
+func Middleware(q *db.Queries) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := strings.TrimSpace(r.Header.Get(Header))
+			if key == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+			k, err := lookup(r.Context(), q, key)
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			ctx := context.WithValue(r.Context(), ctxKey{}, k)
+			ctx = httprate.WithRequestLimit(ctx, int(k.RateLimit))
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// Quota counts requests authenticated by Middleware against the daily quota
+// of their key. It goes after RateLimit so that rate limited requests don't
+// use up the quota.
+func Quota(q *db.Queries) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if k, ok := FromContext(r.Context()); ok {
+				if err := use(r.Context(), q, k); err != nil {
+					writeError(w, err)
+					return
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// KeyFunc keys the rate limiter by API key, falling back to the client IP
+// for anonymous requests.
+func KeyFunc(r *http.Request) (string, error) {
+	if k, ok := FromContext(r.Context()); ok {
+		return "apikey-" + strconv.FormatInt(k.ID, 10), nil
+	}
+	return httprate.KeyByIP(r)
+}
+
+// RateLimit applies the per-key limits set by Middleware and limits anonymous
+// requests per IP when limitAnonymous is set.
+func RateLimit(route string, requestLimit int, window time.Duration, limitAnonymous bool, store httprate.LimitCounter) func(http.Handler) http.Handler {
+	limiter := httprate.NewRateLimiter(requestLimit, window,
+		httprate.WithKeyFuncs(KeyFunc),
+		httprate.WithLimitCounter(store),
+		httprate.WithErrorHandler(ratelimit.ErrorHandler),
+		httprate.WithLimitHandler(ratelimit.LimitHandler(route)),
+	)
+	return func(next http.Handler) http.Handler {
+		limited := limiter.Handler(next)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if _, ok := FromContext(r.Context()); ok || limitAnonymous {
+				limited.ServeHTTP(w, r)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func tomorrow() time.Time {
+	return time.Now().UTC().Truncate(24 * time.Hour).Add(24 * time.Hour)
+}
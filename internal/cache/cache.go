@@ -6,8 +6,7 @@ import (
 	"fmt"
 	"time"
 
-	"github.com/AletisSearch/aletis/internal/db"
-	"github.com/jackc/pgx/v5"
+	"golang.org/x/sync/singleflight"
 )
 
 type CacheMarshal interface {
@@ -22,42 +21,49 @@ type Cache[T any, PT interface {
 	*T
 	CacheMarshal
 }] struct {
-	db *db.Queries
+	store    Store
+	ns       Namespace
+	stats    *counters
+	opts     options
+	group    singleflight.Group
+	negative negativeCache
 }
 
 func New[T any, PT interface {
 	*T
 	CacheMarshal
-}](db *db.Queries) *Cache[T, PT] {
-	return &Cache[T, PT]{db: db}
+}](store Store, ns Namespace, opts ...Option) *Cache[T, PT] {
+	c := &Cache[T, PT]{
+		store: store,
+		ns:    ns,
+		stats: countersFor(ns.Name),
+		opts:  options{timeout: time.Second * 30},
+	}
+	for _, o := range opts {
+		o(&c.opts)
+	}
+	return c
 }
 
 var ErrNilValue = errors.New("nil value pointer")
 
 func (c *Cache[T, PT]) Get(ctx context.Context, key string) (PT, error) {
-	r, err := c.db.GetCache(ctx, key)
+	r, err := c.store.Get(ctx, c.ns.key(key))
 	if err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			var zero PT
-			return zero, fmt.Errorf("unable to find: %s, err: %w", key, ErrNotFoundInCache)
+		if errors.Is(err, ErrNotFoundInCache) {
+			c.stats.misses.Add(1)
 		}
 		var zero PT
 		return zero, err
 	}
 	if time.Until(r.Expires) <= 0 {
+		c.stats.misses.Add(1)
 		var zero PT
 		return zero, fmt.Errorf("key: %s, err: %w", key, ErrOldCache)
 	}
+	c.stats.hits.Add(1)
 
-	var out T
-	ptr := PT(&out)
-	_, err = ptr.UnmarshalMsg(r.Data)
-	if err != nil {
-		var zero PT
-		return zero, err
-	}
-
-	return ptr, nil
+	return c.decode(r.Data)
 }
 
 func (c *Cache[T, PT]) Set(ctx context.Context, key string, obj PT, exp time.Duration) error {
@@ -68,5 +74,5 @@ func (c *Cache[T, PT]) Set(ctx context.Context, key string, obj PT, exp time.Dur
 	if err != nil {
 		return err
 	}
-	return c.db.InsertCache(ctx, db.InsertCacheParams{Key: key, Data: o, Expires: time.Now().Add(exp)})
+	return c.store.Set(ctx, c.ns.key(key), Entry{Namespace: c.ns.Name, Data: compress(o), Expires: time.Now().Add(exp)})
 }
@@ -0,0 +1,19 @@
+package cache
+
+import (
+	"github.com/tinylib/msgp/msgp"
+)
+
+// value is a minimal CacheMarshal for tests.
+type value struct {
+	S string
+}
+
+func (v *value) MarshalMsg(b []byte) ([]byte, error) {
+	return msgp.AppendString(b, v.S), nil
+}
+
+func (v *value) UnmarshalMsg(b []byte) (o []byte, err error) {
+	v.S, o, err = msgp.ReadStringBytes(b)
+	return o, err
+}
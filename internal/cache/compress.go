@@ -0,0 +1,53 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Encoded entries start with formatMagic, a byte msgpack never uses, followed
+// by the format. Entries written before compression existed are bare msgpack
+// and are read as formatRaw.
+const formatMagic = 0xc1
+
+const (
+	formatRaw  byte = 0
+	formatZstd byte = 1
+)
+
+// compressMin is the smallest payload worth compressing.
+const compressMin = 512
+
+var ErrUnknownFormat = errors.New("unknown cache entry format")
+
+var (
+	zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedDefault))
+	zstdDecoder, _ = zstd.NewReader(nil)
+)
+
+// compress prefixes data with its format header, compressing it with zstd
+// when that makes it smaller.
+func compress(data []byte) []byte {
+	if len(data) >= compressMin {
+		out := zstdEncoder.EncodeAll(data, []byte{formatMagic, formatZstd})
+		if len(out) < len(data) {
+			return out
+		}
+	}
+	return append([]byte{formatMagic, formatRaw}, data...)
+}
+
+func decompress(data []byte) ([]byte, error) {
+	if len(data) < 2 || data[0] != formatMagic {
+		return data, nil
+	}
+	switch data[1] {
+	case formatRaw:
+		return data[2:], nil
+	case formatZstd:
+		return zstdDecoder.DecodeAll(data[2:], nil)
+	}
+	return nil, fmt.Errorf("%w: %d", ErrUnknownFormat, data[1])
+}
@@ -0,0 +1,167 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+)
+
+// MaxStale is the longest an expired entry may be served for. Stores keep
+// entries at least this long past their expiry.
+const MaxStale = time.Hour * 24
+
+var ErrUpstreamFailed = errors.New("upstream recently failed")
+
+type options struct {
+	stale    time.Duration
+	negative time.Duration
+	timeout  time.Duration
+}
+
+type Option func(*options)
+
+// WithStaleWhileRevalidate serves entries up to d past their expiry while
+// they are refreshed in the background.
+func WithStaleWhileRevalidate(d time.Duration) Option {
+	return func(o *options) {
+		o.stale = min(d, MaxStale)
+	}
+}
+
+// WithNegativeCache remembers a failed fetch for d so that a struggling
+// upstream isn't hit again for every request.
+func WithNegativeCache(d time.Duration) Option {
+	return func(o *options) {
+		o.negative = d
+	}
+}
+
+// WithFetchTimeout bounds fetches, which run detached from the request that
+// started them since other requests may be waiting on the result.
+func WithFetchTimeout(d time.Duration) Option {
+	return func(o *options) {
+		o.timeout = d
+	}
+}
+
+// FetchFunc loads a value on a cache miss and returns how long to keep it.
+type FetchFunc[PT any] func(ctx context.Context) (PT, time.Duration, error)
+
+type failure struct {
+	err   error
+	until time.Time
+}
+
+type negativeCache struct {
+	mu       sync.Mutex
+	failures map[string]failure
+}
+
+func (n *negativeCache) get(key string) error {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	f, ok := n.failures[key]
+	if !ok {
+		return nil
+	}
+	if time.Until(f.until) <= 0 {
+		delete(n.failures, key)
+		return nil
+	}
+	return f.err
+}
+
+func (n *negativeCache) set(key string, err error, d time.Duration) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.failures == nil {
+		n.failures = make(map[string]failure)
+	}
+	now := time.Now()
+	// Drop expired failures so the map doesn't grow with one-off keys
+	if len(n.failures) > 1024 {
+		for k, f := range n.failures {
+			if f.until.Before(now) {
+				delete(n.failures, k)
+			}
+		}
+	}
+	n.failures[key] = failure{err: fmt.Errorf("%w: %w", ErrUpstreamFailed, err), until: now.Add(d)}
+}
+
+func (c *Cache[T, PT]) decode(data []byte) (PT, error) {
+	data, err := decompress(data)
+	if err != nil {
+		return nil, err
+	}
+	var out T
+	ptr := PT(&out)
+	if _, err = ptr.UnmarshalMsg(data); err != nil {
+		return nil, err
+	}
+	return ptr, nil
+}
+
+// GetOrFetch returns the cached value for key, calling fetch on a miss.
+// Concurrent misses for the same key share a single fetch.
+func (c *Cache[T, PT]) GetOrFetch(ctx context.Context, key string, fetch FetchFunc[PT]) (PT, error) {
+	e, err := c.store.Get(ctx, c.ns.key(key))
+	if err != nil && !errors.Is(err, ErrNotFoundInCache) {
+		return nil, err
+	}
+	if err == nil {
+		age := -time.Until(e.Expires)
+		if age < 0 || age < c.opts.stale {
+			v, err := c.decode(e.Data)
+			if err == nil {
+				if age < 0 {
+					c.stats.hits.Add(1)
+					slog.Info("Cache Hit", "Namespace", c.ns.Name, "Key", key)
+				} else {
+					c.stats.staleHits.Add(1)
+					slog.Info("Cache Hit Stale", "Namespace", c.ns.Name, "Key", key)
+					c.group.DoChan(key, c.fetchFunc(ctx, key, fetch))
+				}
+				return v, nil
+			}
+			slog.Error("unable to decode cache entry", "Key", key, "ERROR", err)
+		}
+	}
+
+	c.stats.misses.Add(1)
+	if err = c.negative.get(key); err != nil {
+		return nil, err
+	}
+
+	select {
+	case r := <-c.group.DoChan(key, c.fetchFunc(ctx, key, fetch)):
+		v, _ := r.Val.(PT)
+		return v, r.Err
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (c *Cache[T, PT]) fetchFunc(ctx context.Context, key string, fetch FetchFunc[PT]) func() (any, error) {
+	return func() (any, error) {
+		// Keep the values of ctx, such as the trace, but not its cancellation
+		ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), c.opts.timeout)
+		defer cancel()
+		v, exp, err := fetch(ctx)
+		if err != nil {
+			if c.opts.negative > 0 {
+				c.negative.set(key, err, c.opts.negative)
+			}
+			return v, err
+		}
+		// An oversized value is still returned, it just isn't kept
+		if err = c.Set(ctx, key, v, exp); errors.Is(err, ErrEntryTooLarge) {
+			slog.Warn("not caching entry", "Namespace", c.ns.Name, "ERROR", err)
+			return v, nil
+		}
+		return v, err
+	}
+}
@@ -0,0 +1,171 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/synctest"
+	"time"
+)
+
+func newTestCache(opts ...Option) *Cache[value, *value] {
+	return New[value](NewMemoryStore(1<<20), Namespace{Name: "test", Version: "1"}, opts...)
+}
+
+// fetchValue returns a FetchFunc returning s that counts its calls.
+func fetchValue(s string, calls *atomic.Int32) FetchFunc[*value] {
+	return func(ctx context.Context) (*value, time.Duration, error) {
+		calls.Add(1)
+		return &value{S: s}, time.Minute, nil
+	}
+}
+
+func TestGetOrFetchSingleflight(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		c := newTestCache()
+		release := make(chan struct{})
+		var calls atomic.Int32
+		fetch := func(ctx context.Context) (*value, time.Duration, error) {
+			calls.Add(1)
+			<-release
+			return &value{S: "fetched"}, time.Minute, nil
+		}
+
+		const callers = 10
+		var wg sync.WaitGroup
+		for range callers {
+			wg.Go(func() {
+				v, err := c.GetOrFetch(t.Context(), "key", fetch)
+				if err != nil || v.S != "fetched" {
+					t.Errorf("GetOrFetch = %v, %v", v, err)
+				}
+			})
+		}
+		// Every caller is waiting on the one fetch
+		synctest.Wait()
+		close(release)
+		wg.Wait()
+		if n := calls.Load(); n != 1 {
+			t.Errorf("fetched %d times, want 1", n)
+		}
+
+		v, err := c.Get(t.Context(), "key")
+		if err != nil || v.S != "fetched" {
+			t.Errorf("Get = %v, %v, want the fetched value", v, err)
+		}
+	})
+}
+
+func TestGetOrFetchCanceledCaller(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		c := newTestCache()
+		release := make(chan struct{})
+		fetch := func(ctx context.Context) (*value, time.Duration, error) {
+			<-release
+			return &value{S: "fetched"}, time.Minute, ctx.Err()
+		}
+
+		ctx, cancel := context.WithCancel(t.Context())
+		done := make(chan error)
+		go func() {
+			_, err := c.GetOrFetch(ctx, "key", fetch)
+			done <- err
+		}()
+		synctest.Wait()
+		cancel()
+		if err := <-done; !errors.Is(err, context.Canceled) {
+			t.Fatalf("GetOrFetch = %v, want context.Canceled", err)
+		}
+
+		// The fetch outlives the caller and its result is still kept
+		close(release)
+		synctest.Wait()
+		v, err := c.Get(t.Context(), "key")
+		if err != nil || v.S != "fetched" {
+			t.Errorf("Get = %v, %v, want the fetched value", v, err)
+		}
+	})
+}
+
+func TestGetOrFetchStaleWhileRevalidate(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		c := newTestCache(WithStaleWhileRevalidate(time.Hour))
+		if err := c.Set(t.Context(), "key", &value{S: "old"}, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Minute * 2)
+
+		var calls atomic.Int32
+		v, err := c.GetOrFetch(t.Context(), "key", fetchValue("new", &calls))
+		if err != nil || v.S != "old" {
+			t.Fatalf("GetOrFetch = %v, %v, want the stale value", v, err)
+		}
+		// The entry is refreshed in the background
+		synctest.Wait()
+		if n := calls.Load(); n != 1 {
+			t.Errorf("fetched %d times, want 1", n)
+		}
+		v, err = c.Get(t.Context(), "key")
+		if err != nil || v.S != "new" {
+			t.Errorf("Get = %v, %v, want the refreshed value", v, err)
+		}
+	})
+}
+
+func TestGetOrFetchTooStale(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		c := newTestCache(WithStaleWhileRevalidate(time.Hour))
+		if err := c.Set(t.Context(), "key", &value{S: "old"}, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(time.Hour * 2)
+
+		var calls atomic.Int32
+		v, err := c.GetOrFetch(t.Context(), "key", fetchValue("new", &calls))
+		if err != nil || v.S != "new" {
+			t.Errorf("GetOrFetch = %v, %v, want the fetched value", v, err)
+		}
+		if n := calls.Load(); n != 1 {
+			t.Errorf("fetched %d times, want 1", n)
+		}
+	})
+}
+
+func TestGetOrFetchNegativeCache(t *testing.T) {
+	synctest.Test(t, func(t *testing.T) {
+		c := newTestCache(WithNegativeCache(time.Minute))
+		errDown := errors.New("upstream down")
+		var calls atomic.Int32
+		fail := func(ctx context.Context) (*value, time.Duration, error) {
+			calls.Add(1)
+			return nil, 0, errDown
+		}
+
+		if _, err := c.GetOrFetch(t.Context(), "key", fail); !errors.Is(err, errDown) || errors.Is(err, ErrUpstreamFailed) {
+			t.Fatalf("first GetOrFetch = %v, want the fetch error", err)
+		}
+		// The failure is remembered instead of fetching again
+		_, err := c.GetOrFetch(t.Context(), "key", fail)
+		if !errors.Is(err, ErrUpstreamFailed) || !errors.Is(err, errDown) {
+			t.Errorf("second GetOrFetch = %v, want ErrUpstreamFailed", err)
+		}
+		if n := calls.Load(); n != 1 {
+			t.Errorf("fetched %d times, want 1", n)
+		}
+		// Other keys are fetched as usual
+		if v, err := c.GetOrFetch(t.Context(), "other", fetchValue("other", new(atomic.Int32))); err != nil || v.S != "other" {
+			t.Errorf("GetOrFetch of another key = %v, %v", v, err)
+		}
+
+		time.Sleep(time.Minute + time.Second)
+		v, err := c.GetOrFetch(t.Context(), "key", fetchValue("recovered", &calls))
+		if err != nil || v.S != "recovered" {
+			t.Errorf("GetOrFetch after the negative cache expired = %v, %v", v, err)
+		}
+		if n := calls.Load(); n != 2 {
+			t.Errorf("fetched %d times, want 2", n)
+		}
+	})
+}
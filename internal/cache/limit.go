@@ -0,0 +1,30 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+var ErrEntryTooLarge = errors.New("cache entry too large")
+
+var _ Store = (*LimitStore)(nil)
+
+// LimitStore refuses entries larger than the maximum of their namespace.
+// Sizes are checked after compression. Namespaces without a maximum are not
+// limited.
+type LimitStore struct {
+	Store
+	maxSize map[string]int
+}
+
+func NewLimitStore(store Store, maxSize map[string]int) *LimitStore {
+	return &LimitStore{Store: store, maxSize: maxSize}
+}
+
+func (s *LimitStore) Set(ctx context.Context, key string, e Entry) error {
+	if limit, ok := s.maxSize[e.Namespace]; ok && len(e.Data) > limit {
+		return fmt.Errorf("key: %s, size: %d, max: %d, err: %w", key, len(e.Data), limit, ErrEntryTooLarge)
+	}
+	return s.Store.Set(ctx, key, e)
+}
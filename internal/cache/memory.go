@@ -0,0 +1,125 @@
+package cache
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"regexp"
+	"sync"
+	"time"
+)
+
+// entryOverhead approximates the bookkeeping cost of an entry so that many
+// tiny entries still count against the size budget.
+const entryOverhead = 96
+
+type memoryEntry struct {
+	key   string
+	entry Entry
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// MemoryStore is a size-bounded LRU store. Expired entries are kept until
+// space is needed, the same as rows in the cache table until cleanup.
+type MemoryStore struct {
+	mu       sync.Mutex
+	maxBytes int64
+	size     int64
+	lru      *list.List
+	items    map[string]*list.Element
+}
+
+func NewMemoryStore(maxBytes int64) *MemoryStore {
+	return &MemoryStore{
+		maxBytes: maxBytes,
+		lru:      list.New(),
+		items:    make(map[string]*list.Element),
+	}
+}
+
+func entrySize(key string, e Entry) int64 {
+	return int64(len(key) + len(e.Data) + entryOverhead)
+}
+
+func (s *MemoryStore) Get(ctx context.Context, key string) (Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	el, ok := s.items[key]
+	if !ok {
+		return Entry{}, fmt.Errorf("unable to find: %s, err: %w", key, ErrNotFoundInCache)
+	}
+	s.lru.MoveToFront(el)
+	return el.Value.(*memoryEntry).entry, nil
+}
+
+func (s *MemoryStore) Purge(ctx context.Context, f PurgeFilter) (int64, error) {
+	if f.Namespace == "" {
+		return 0, ErrEmptyNamespace
+	}
+	var re *regexp.Regexp
+	if p := f.Pattern(); p != "" {
+		var err error
+		if re, err = regexp.Compile(p); err != nil {
+			return 0, err
+		}
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for el := s.lru.Front(); el != nil; {
+		next := el.Next()
+		me := el.Value.(*memoryEntry)
+		if me.entry.Namespace == f.Namespace && (re == nil || re.MatchString(me.key)) {
+			s.remove(el)
+			n++
+		}
+		el = next
+	}
+	return n, nil
+}
+
+func (s *MemoryStore) Set(ctx context.Context, key string, e Entry) error {
+	size := entrySize(key, e)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.items[key]; ok {
+		s.remove(el)
+	}
+	if size > s.maxBytes {
+		return nil
+	}
+	s.items[key] = s.lru.PushFront(&memoryEntry{key: key, entry: e})
+	s.size += size
+	s.evict()
+	return nil
+}
+
+// evict removes expired entries from the cold end first, then the least
+// recently used ones until the store fits its budget.
+func (s *MemoryStore) evict() {
+	now := time.Now()
+	for el := s.lru.Back(); el != nil && s.size > s.maxBytes; {
+		prev := el.Prev()
+		if el.Value.(*memoryEntry).entry.Expires.Before(now) {
+			s.remove(el)
+		}
+		el = prev
+	}
+	for s.size > s.maxBytes {
+		s.remove(s.lru.Back())
+	}
+}
+
+func (s *MemoryStore) remove(el *list.Element) {
+	me := s.lru.Remove(el).(*memoryEntry)
+	delete(s.items, me.key)
+	s.size -= entrySize(me.key, me.entry)
+}
+
+// Len returns the number of entries and their approximate size in bytes.
+func (s *MemoryStore) Len() (int, int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lru.Len(), s.size
+}
@@ -0,0 +1,101 @@
+package cache
+
+import (
+	"errors"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// Namespace groups the entries of one cache user. Version must be bumped
+// whenever the cached type or whatever produced it changes so that old
+// entries are never decoded into the new shape.
+type Namespace struct {
+	Name    string
+	Version string
+}
+
+func (n Namespace) key(key string) string {
+	return n.Name + ":" + n.Version + ":" + key
+}
+
+var ErrEmptyNamespace = errors.New("namespace is required")
+
+// PurgeFilter selects entries of a namespace, across all its versions. An
+// empty Prefix and Key select the whole namespace.
+type PurgeFilter struct {
+	Namespace string
+	Prefix    string
+	Key       string
+}
+
+// Pattern returns a regular expression matching the stored keys selected by
+// the filter, or an empty string when the whole namespace is selected. It
+// is valid both in Go and in Postgres.
+func (f PurgeFilter) Pattern() string {
+	switch {
+	case f.Key != "":
+		return "^" + regexp.QuoteMeta(f.Namespace) + ":[^:]*:" + regexp.QuoteMeta(f.Key) + "$"
+	case f.Prefix != "":
+		return "^" + regexp.QuoteMeta(f.Namespace) + ":[^:]*:" + regexp.QuoteMeta(f.Prefix)
+	}
+	return ""
+}
+
+type Stats struct {
+	Namespace string `json:"namespace"`
+	Hits      uint64 `json:"hits"`
+	StaleHits uint64 `json:"stale_hits"`
+	Misses    uint64 `json:"misses"`
+}
+
+// HitRatio is the share of lookups served from the cache, stale or not.
+func (s Stats) HitRatio() float64 {
+	total := s.Hits + s.StaleHits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits+s.StaleHits) / float64(total)
+}
+
+// NamespaceStats adds the stored size of a namespace to its statistics.
+type NamespaceStats struct {
+	Stats
+	Entries int64 `json:"entries"`
+	Bytes   int64 `json:"bytes"`
+}
+
+type counters struct {
+	hits      atomic.Uint64
+	staleHits atomic.Uint64
+	misses    atomic.Uint64
+}
+
+var registry sync.Map
+
+func countersFor(namespace string) *counters {
+	c, _ := registry.LoadOrStore(namespace, &counters{})
+	return c.(*counters)
+}
+
+// Statistics returns the hit and miss counts of every namespace used by this
+// process since it started.
+func Statistics() []Stats {
+	var s []Stats
+	registry.Range(func(k, v any) bool {
+		c := v.(*counters)
+		s = append(s, Stats{
+			Namespace: k.(string),
+			Hits:      c.hits.Load(),
+			StaleHits: c.staleHits.Load(),
+			Misses:    c.misses.Load(),
+		})
+		return true
+	})
+	slices.SortFunc(s, func(a, b Stats) int {
+		return strings.Compare(a.Namespace, b.Namespace)
+	})
+	return s
+}
@@ -0,0 +1,116 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/AletisSearch/aletis/internal/db"
+	"github.com/jackc/pgx/v5"
+)
+
+// Entry is a marshalled value as kept by a Store.
+type Entry struct {
+	Namespace string
+	Data      []byte
+	Expires   time.Time
+}
+
+// Store is a cache backend. Get returns ErrNotFoundInCache for missing keys
+// and may return expired entries; Cache decides what to do with those.
+type Store interface {
+	Get(ctx context.Context, key string) (Entry, error)
+	Set(ctx context.Context, key string, e Entry) error
+	// Purge deletes the entries selected by f and returns how many there were.
+	Purge(ctx context.Context, f PurgeFilter) (int64, error)
+}
+
+var _ Store = (*PostgresStore)(nil)
+
+// PostgresStore keeps entries in the cache table.
+type PostgresStore struct {
+	q *db.Queries
+}
+
+func NewPostgresStore(q *db.Queries) *PostgresStore {
+	return &PostgresStore{q: q}
+}
+
+func (s *PostgresStore) Get(ctx context.Context, key string) (Entry, error) {
+	r, err := s.q.GetCache(ctx, key)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return Entry{}, fmt.Errorf("unable to find: %s, err: %w", key, ErrNotFoundInCache)
+		}
+		return Entry{}, err
+	}
+	return Entry{Namespace: r.Namespace, Data: r.Data, Expires: r.Expires}, nil
+}
+
+func (s *PostgresStore) Set(ctx context.Context, key string, e Entry) error {
+	return s.q.InsertCache(ctx, db.InsertCacheParams{Key: key, Namespace: e.Namespace, Data: e.Data, Expires: e.Expires})
+}
+
+func (s *PostgresStore) Purge(ctx context.Context, f PurgeFilter) (int64, error) {
+	if f.Namespace == "" {
+		return 0, ErrEmptyNamespace
+	}
+	if p := f.Pattern(); p != "" {
+		return s.q.PurgeCacheMatching(ctx, db.PurgeCacheMatchingParams{Namespace: f.Namespace, Pattern: p})
+	}
+	return s.q.PurgeCacheNamespace(ctx, f.Namespace)
+}
+
+var _ Store = (*TieredStore)(nil)
+
+// TieredStore serves entries from a fast front store and falls back to a
+// shared back store, copying what it finds there to the front.
+type TieredStore struct {
+	front Store
+	back  Store
+}
+
+func NewTieredStore(front, back Store) *TieredStore {
+	return &TieredStore{front: front, back: back}
+}
+
+func (s *TieredStore) Get(ctx context.Context, key string) (Entry, error) {
+	fe, err := s.front.Get(ctx, key)
+	if err == nil && time.Until(fe.Expires) > 0 {
+		return fe, nil
+	}
+	if err != nil && !errors.Is(err, ErrNotFoundInCache) {
+		return Entry{}, err
+	}
+	found := err == nil
+
+	// Another replica may have refreshed an entry that expired in front
+	be, err := s.back.Get(ctx, key)
+	if err != nil {
+		if found && errors.Is(err, ErrNotFoundInCache) {
+			return fe, nil
+		}
+		return Entry{}, err
+	}
+	if err = s.front.Set(ctx, key, be); err != nil {
+		return Entry{}, err
+	}
+	return be, nil
+}
+
+func (s *TieredStore) Set(ctx context.Context, key string, e Entry) error {
+	if err := s.back.Set(ctx, key, e); err != nil {
+		return err
+	}
+	return s.front.Set(ctx, key, e)
+}
+
+// Purge only purges this replica's front store. Others keep serving their
+// copies until those expire.
+func (s *TieredStore) Purge(ctx context.Context, f PurgeFilter) (int64, error) {
+	if _, err := s.front.Purge(ctx, f); err != nil {
+		return 0, err
+	}
+	return s.back.Purge(ctx, f)
+}
@@ -0,0 +1,84 @@
+package cache
+
+import (
+	"crypto/rand"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AletisSearch/aletis/internal/db/dbtest"
+)
+
+// BenchmarkStores compares the cache modes selectable with CACHE_STORE. The
+// postgres and tiered modes are skipped unless POSTGRES_HOST is set.
+func BenchmarkStores(b *testing.B) {
+	const keys = 1000
+	modes := []struct {
+		name  string
+		store func(b *testing.B) Store
+	}{
+		{"memory", func(b *testing.B) Store {
+			return NewMemoryStore(64 << 20)
+		}},
+		{"postgres", func(b *testing.B) Store {
+			return NewPostgresStore(dbtest.New(b))
+		}},
+		{"tiered", func(b *testing.B) Store {
+			return NewTieredStore(NewMemoryStore(64<<20), NewPostgresStore(dbtest.New(b)))
+		}},
+	}
+	// Roughly the size of a page of search results
+	v := &value{S: strings.Repeat("Lorem ipsum dolor sit amet, consectetur adipiscing elit. ", 256)}
+
+	for _, mode := range modes {
+		newCache := func(b *testing.B) *Cache[value, *value] {
+			// A fresh version keeps entries of earlier runs out of the way
+			return New[value](mode.store(b), Namespace{Name: "bench", Version: rand.Text()})
+		}
+		b.Run(mode.name+"/set", func(b *testing.B) {
+			c := newCache(b)
+			i := 0
+			for b.Loop() {
+				if err := c.Set(b.Context(), strconv.Itoa(i%keys), v, time.Hour); err != nil {
+					b.Fatal(err)
+				}
+				i++
+			}
+		})
+		b.Run(mode.name+"/get", func(b *testing.B) {
+			c := newCache(b)
+			for i := range keys {
+				if err := c.Set(b.Context(), strconv.Itoa(i), v, time.Hour); err != nil {
+					b.Fatal(err)
+				}
+			}
+			i := 0
+			for b.Loop() {
+				if _, err := c.Get(b.Context(), strconv.Itoa(i%keys)); err != nil {
+					b.Fatal(err)
+				}
+				i++
+			}
+		})
+		b.Run(mode.name+"/get-parallel", func(b *testing.B) {
+			c := newCache(b)
+			for i := range keys {
+				if err := c.Set(b.Context(), strconv.Itoa(i), v, time.Hour); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.ResetTimer()
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					if _, err := c.Get(b.Context(), strconv.Itoa(i%keys)); err != nil {
+						b.Error(err)
+						return
+					}
+					i++
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/AletisSearch/aletis/internal/cache"
+	"github.com/AletisSearch/aletis/internal/config"
+	"github.com/AletisSearch/aletis/internal/db"
+)
+
+func Cache(ctx context.Context, _ *config.Config, q *db.Queries, out io.Writer, args []string) error {
+	if len(args) == 0 {
+		return ErrUsage
+	}
+	switch args[0] {
+	case "stats":
+		return cacheStats(ctx, q, out)
+	case "purge":
+		return cachePurge(ctx, q, out, args[1:])
+	}
+	return fmt.Errorf("unknown cache command %q: %w", args[0], ErrUsage)
+}
+
+func cacheStats(ctx context.Context, q *db.Queries, out io.Writer) error {
+	stats, err := q.CacheStats(ctx)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "NAMESPACE\tENTRIES\tBYTES")
+	for _, s := range stats {
+		fmt.Fprintf(tw, "%s\t%d\t%d\n", s.Namespace, s.Entries, s.Bytes)
+	}
+	return tw.Flush()
+}
+
+func cachePurge(ctx context.Context, q *db.Queries, out io.Writer, args []string) error {
+	fs := flag.NewFlagSet("cache purge", flag.ContinueOnError)
+	fs.SetOutput(out)
+	var f cache.PurgeFilter
+	fs.StringVar(&f.Namespace, "namespace", "", "namespace to purge (search, ai, icon)")
+	fs.StringVar(&f.Prefix, "prefix", "", "only purge keys starting with this")
+	fs.StringVar(&f.Key, "key", "", "only purge this key")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	n, err := cache.NewPostgresStore(q).Purge(ctx, f)
+	if err != nil {
+		return err
+	}
+	// Running servers keep their in-memory copies until they expire or
+	// are purged through /admin/cache/purge.
+	fmt.Fprintf(out, "Purged %d entries from %s\n", n, f.Namespace)
+	return nil
+}
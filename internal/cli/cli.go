@@ -0,0 +1,55 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	sqlcdb "github.com/AletisSearch/aletis/db"
+	"github.com/AletisSearch/aletis/internal/config"
+	"github.com/AletisSearch/aletis/internal/db"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrUsage = errors.New("usage: aletis [serve | keys <create|list|revoke> | cache <stats|purge> | ingest [source...]]")
+
+type command func(ctx context.Context, conf *config.Config, q *db.Queries, out io.Writer, args []string) error
+
+var commands = map[string]command{
+	"keys":   Keys,
+	"cache":  Cache,
+	"ingest": Ingest,
+}
+
+// Run executes an administrative subcommand against the configured database.
+func Run(ctx context.Context, out io.Writer, args []string, options ...config.Option) error {
+	if len(args) == 0 {
+		return ErrUsage
+	}
+	cmd, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("unknown command %q: %w", args[0], ErrUsage)
+	}
+
+	conf, err := config.NewConfig(options...)
+	if err != nil {
+		return fmt.Errorf("failed to create config: %w", err)
+	}
+	if err = conf.Validate(config.ValidPostgres); err != nil {
+		return fmt.Errorf("failed to validate config: %w", err)
+	}
+	if !conf.DatabaseEnabled() {
+		return errors.New("POSTGRES_HOST is not set")
+	}
+	if err = sqlcdb.ApplyMigrations(conf); err != nil {
+		return err
+	}
+	database, err := pgxpool.New(ctx, conf.DBconnStr())
+	if err != nil {
+		return err
+	}
+	defer database.Close()
+
+	return cmd(ctx, conf, db.New(database), out, args[1:])
+}
@@ -0,0 +1,41 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/AletisSearch/aletis/internal/config"
+	"github.com/AletisSearch/aletis/internal/db"
+	"github.com/AletisSearch/aletis/internal/ingest"
+)
+
+// Ingest indexes the directories of INGEST_PATHS, or of the sources named in
+// args. Running it again only reads the files that changed.
+func Ingest(ctx context.Context, conf *config.Config, q *db.Queries, out io.Writer, args []string) error {
+	if len(conf.IngestPaths) == 0 {
+		return errors.New("INGEST_PATHS is not set")
+	}
+	paths := conf.IngestPaths
+	if len(args) > 0 {
+		paths = nil
+		for _, source := range args {
+			i := slices.IndexFunc(conf.IngestPaths, func(p config.IngestPath) bool { return p.Source == source })
+			if i == -1 {
+				return fmt.Errorf("unknown ingest source %q", source)
+			}
+			paths = append(paths, conf.IngestPaths[i])
+		}
+	}
+	ix := ingest.New(q)
+	for _, p := range paths {
+		st, err := ix.Index(ctx, p)
+		if err != nil {
+			return fmt.Errorf("unable to ingest %s: %w", p.Source, err)
+		}
+		fmt.Fprintf(out, "%s: %s\n", p.Source, st)
+	}
+	return nil
+}
@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/AletisSearch/aletis/internal/apikey"
+	"github.com/AletisSearch/aletis/internal/config"
+	"github.com/AletisSearch/aletis/internal/db"
+)
+
+var ErrKeyNotFound = errors.New("api key not found or already revoked")
+
+func Keys(ctx context.Context, _ *config.Config, q *db.Queries, out io.Writer, args []string) error {
+	if len(args) == 0 {
+		return ErrUsage
+	}
+	switch args[0] {
+	case "create":
+		return keysCreate(ctx, q, out, args[1:])
+	case "list":
+		return keysList(ctx, q, out)
+	case "revoke":
+		return keysRevoke(ctx, q, out, args[1:])
+	}
+	return fmt.Errorf("unknown keys command %q: %w", args[0], ErrUsage)
+}
+
+func keysCreate(ctx context.Context, q *db.Queries, out io.Writer, args []string) error {
+	fs := flag.NewFlagSet("keys create", flag.ContinueOnError)
+	fs.SetOutput(out)
+	name := fs.String("name", "", "name to identify the key")
+	scope := fs.String("scope", string(apikey.ScopeSearch), "search or ai")
+	rateLimit := fs.Int("rate-limit", 60, "requests per minute")
+	quota := fs.Int("quota", 1000, "requests per day, 0 for unlimited")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *name == "" {
+		return errors.New("keys create: -name is required")
+	}
+	s, err := apikey.ParseScope(*scope)
+	if err != nil {
+		return err
+	}
+
+	key, prefix, hash, err := apikey.Generate()
+	if err != nil {
+		return err
+	}
+	k, err := q.CreateAPIKey(ctx, db.CreateAPIKeyParams{
+		Name:       *name,
+		Prefix:     prefix,
+		Hash:       hash,
+		Scope:      string(s),
+		RateLimit:  int32(*rateLimit),
+		DailyQuota: int32(*quota),
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Created key %d (%s). It will not be shown again:\n%s\n", k.ID, k.Name, key)
+	return nil
+}
+
+func keysList(ctx context.Context, q *db.Queries, out io.Writer) error {
+	keys, err := q.ListAPIKeys(ctx)
+	if err != nil {
+		return err
+	}
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tNAME\tPREFIX\tSCOPE\tRATE/MIN\tQUOTA/DAY\tCREATED\tREVOKED")
+	for _, k := range keys {
+		revoked := "-"
+		if k.Revoked != nil {
+			revoked = k.Revoked.Format(time.DateTime)
+		}
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%d\t%d\t%s\t%s\n",
+			k.ID, k.Name, k.Prefix, k.Scope, k.RateLimit, k.DailyQuota, k.Created.Format(time.DateTime), revoked)
+	}
+	return tw.Flush()
+}
+
+func keysRevoke(ctx context.Context, q *db.Queries, out io.Writer, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: aletis keys revoke <id>")
+	}
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid key id: %w", err)
+	}
+	n, err := q.RevokeAPIKey(ctx, id)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("key %d: %w", id, ErrKeyNotFound)
+	}
+	fmt.Fprintf(out, "Revoked key %d\n", id)
+	return nil
+}
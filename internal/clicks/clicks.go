@@ -0,0 +1,215 @@
+// Package clicks turns the results people open into ranking signals. Click
+// events hold no user identity; the query is kept only as a keyed hash, and
+// the client only as a hash keyed with a salt that is deleted once the day
+// is over, which counts a click once per client, query and result within a
+// day. The events are aggregated periodically into per-query and per-domain
+// statistics which raise the score of results that are clicked often.
+package clicks
+
+import (
+	"cmp"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"net"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AletisSearch/aletis/internal/db"
+	"github.com/AletisSearch/aletis/internal/searxng"
+	"github.com/AletisSearch/aletis/internal/signing"
+)
+
+const (
+	// minClicks keeps URLs and domains clicked by only a few searches out
+	// of the statistics, so that they can't be used to tell what someone
+	// searched for.
+	minClicks = 3
+	// maxDomains bounds the domain statistics kept in memory.
+	maxDomains = 10000
+	// queryBoost is how much a result clicked for every search of a query
+	// is raised.
+	queryBoost = 1.0
+	// domainBoost is how much results from the most clicked domains are
+	// raised, and domainHalf the click weight at which a domain gets half of
+	// it.
+	domainBoost = 0.25
+	domainHalf  = 50.0
+	// saltTTL is how long the salt of the day is used before it is read
+	// again, to follow the day changing.
+	saltTTL = time.Minute
+)
+
+// Clicks records clicked results and ranks results with the aggregates.
+type Clicks struct {
+	q      *db.Queries
+	signer *signing.Signer
+
+	mu      sync.RWMutex
+	domains map[string]float64
+
+	saltMu      sync.Mutex
+	salt        []byte
+	saltExpires time.Time
+}
+
+func New(q *db.Queries, signer *signing.Signer) *Clicks {
+	return &Clicks{q: q, signer: signer, domains: map[string]float64{}}
+}
+
+// Tracked reports whether clicks of the request may be recorded. Browsers
+// sending Do Not Track or Global Privacy Control are left out.
+func Tracked(r *http.Request) bool {
+	return r.Header.Get("Sec-GPC") != "1" && r.Header.Get("DNT") != "1"
+}
+
+// queryHash keys the statistics of a query. A keyed hash keeps queries from
+// being recovered by hashing guesses.
+func (c *Clicks) queryHash(query string) string {
+	return c.signer.Sign(signing.Clicks, strings.Join(strings.Fields(strings.ToLower(query)), " "))
+}
+
+// hostname drops the port of a URL host.
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.ToLower(host)
+}
+
+// Record stores a click on target shown at position for query by client,
+// the address of who clicked it, unless client already clicked it today.
+func (c *Clicks) Record(ctx context.Context, query, target string, position int, client string) error {
+	u, err := url.Parse(target)
+	if err != nil {
+		return err
+	}
+	salt, err := c.daySalt(ctx)
+	if err != nil {
+		return err
+	}
+	if host, _, err := net.SplitHostPort(client); err == nil {
+		client = host
+	}
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte(client))
+	return c.q.InsertClickEvent(ctx, db.InsertClickEventParams{
+		QueryHash: c.queryHash(query),
+		Url:       target,
+		Domain:    hostname(u.Host),
+		Position:  int32(position),
+		Client:    mac.Sum(nil)[:16],
+	})
+}
+
+// daySalt returns the salt of the day, shared by all replicas through the
+// database.
+func (c *Clicks) daySalt(ctx context.Context) ([]byte, error) {
+	c.saltMu.Lock()
+	defer c.saltMu.Unlock()
+	if c.salt != nil && time.Now().Before(c.saltExpires) {
+		return c.salt, nil
+	}
+	salt, err := c.q.GetClickSalt(ctx, []byte(rand.Text()))
+	if err != nil {
+		return nil, err
+	}
+	c.salt, c.saltExpires = salt, time.Now().Add(saltTTL)
+	return salt, nil
+}
+
+// Aggregate rebuilds the statistics from the clicks within retention and
+// loads the domain statistics. Clicks further down the page count for more
+// since fewer people look that far.
+func (c *Clicks) Aggregate(ctx context.Context, retention time.Duration) error {
+	start := time.Now()
+	since := start.Add(-retention)
+	if err := c.q.RefreshClickQueryStats(ctx, db.RefreshClickQueryStatsParams{Since: since, MinClicks: minClicks}); err != nil {
+		return err
+	}
+	if err := c.q.DeleteStaleClickQueryStats(ctx, start); err != nil {
+		return err
+	}
+	if err := c.q.RefreshClickDomainStats(ctx, db.RefreshClickDomainStatsParams{Since: since, MinClicks: minClicks}); err != nil {
+		return err
+	}
+	if err := c.q.DeleteStaleClickDomainStats(ctx, start); err != nil {
+		return err
+	}
+	return c.load(ctx)
+}
+
+func (c *Clicks) load(ctx context.Context) error {
+	stats, err := c.q.ListClickDomainStats(ctx, maxDomains)
+	if err != nil {
+		return err
+	}
+	domains := make(map[string]float64, len(stats))
+	for _, s := range stats {
+		domains[s.Domain] = s.Weight
+	}
+	c.mu.Lock()
+	c.domains = domains
+	c.mu.Unlock()
+	return nil
+}
+
+// Cleanup deletes clicks past retention and the salts of past days. The
+// statistics of the clicks go with the next Aggregate.
+func (c *Clicks) Cleanup(ctx context.Context, retention time.Duration) error {
+	if err := c.q.DeleteOldClickSalts(ctx); err != nil {
+		return err
+	}
+	return c.q.DeleteOldClickEvents(ctx, time.Now().Add(-retention))
+}
+
+// Apply returns sr with the scores of clicked results raised and re-ranked.
+// sr may be shared through the cache so it is never modified; a copy is
+// returned when a result was raised.
+func (c *Clicks) Apply(ctx context.Context, query string, sr *searxng.SearchResponse) (*searxng.SearchResponse, error) {
+	if c == nil || sr == nil || len(sr.Results) == 0 {
+		return sr, nil
+	}
+	stats, err := c.q.ListClickQueryStats(ctx, c.queryHash(query))
+	if err != nil {
+		return sr, err
+	}
+	var total float64
+	urls := make(map[string]float64, len(stats))
+	for _, s := range stats {
+		urls[s.Url] = s.Weight
+		total += s.Weight
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	results := slices.Clone(sr.Results)
+	changed := false
+	for i, res := range results {
+		boost := 1.0
+		if w, ok := urls[res.URL]; ok {
+			boost += queryBoost * w / total
+		}
+		if w, ok := c.domains[hostname(res.ParsedURL[1])]; ok {
+			boost += domainBoost * w / (w + domainHalf)
+		}
+		if boost != 1 {
+			results[i].Score *= boost
+			changed = true
+		}
+	}
+	if !changed {
+		return sr, nil
+	}
+	slices.SortStableFunc(results, func(i, j searxng.Result) int {
+		return cmp.Compare(j.Score, i.Score)
+	})
+	out := *sr
+	out.Results = results
+	return &out, nil
+}
@@ -0,0 +1,66 @@
+// Package clientip finds the address of clients behind the reverse proxies
+// in front of the server. Forwarded headers are only believed from trusted
+// proxies, since anyone else could send them to pose as another client.
+package clientip
+
+import (
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// Middleware sets the RemoteAddr of requests from trusted proxies to the
+// client address they forwarded: the last address in X-Forwarded-For that
+// isn't a trusted proxy itself, the first when all are, or X-Real-IP without
+// the header. Requests from anyone else keep their own address.
+func Middleware(trusted []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if addr, ok := forwarded(r, trusted); ok {
+				r.RemoteAddr = addr.String()
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// forwarded returns the client address forwarded by a trusted proxy.
+// Proxies append the address they received the request from, so only the
+// addresses after the last hop that isn't trusted were added by proxies we
+// know; anything before it may be made up by the client.
+func forwarded(r *http.Request, trusted []netip.Prefix) (netip.Addr, bool) {
+	peer, err := netip.ParseAddrPort(r.RemoteAddr)
+	if err != nil || !isTrusted(peer.Addr(), trusted) {
+		return netip.Addr{}, false
+	}
+	var hops []string
+	for _, h := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(h, ",")...)
+	}
+	var addr netip.Addr
+	for i := len(hops) - 1; i >= 0; i-- {
+		if addr, err = netip.ParseAddr(strings.TrimSpace(hops[i])); err != nil {
+			return netip.Addr{}, false
+		}
+		if !isTrusted(addr, trusted) {
+			break
+		}
+	}
+	if addr.IsValid() {
+		return addr.Unmap(), true
+	}
+	if addr, err = netip.ParseAddr(strings.TrimSpace(r.Header.Get("X-Real-IP"))); err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
+
+func isTrusted(addr netip.Addr, trusted []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, p := range trusted {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
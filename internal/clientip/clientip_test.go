@@ -0,0 +1,97 @@
+package clientip
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestMiddleware(t *testing.T) {
+	trusted := []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("fd00::/8"),
+	}
+	for _, tt := range []struct {
+		name   string
+		remote string
+		header http.Header
+		want   string
+	}{
+		{
+			name:   "direct client",
+			remote: "203.0.113.7:4242",
+			want:   "203.0.113.7:4242",
+		},
+		{
+			name:   "forged by untrusted client",
+			remote: "203.0.113.7:4242",
+			header: http.Header{"X-Forwarded-For": {"198.51.100.1"}, "X-Real-Ip": {"198.51.100.2"}},
+			want:   "203.0.113.7:4242",
+		},
+		{
+			name:   "forwarded by trusted proxy",
+			remote: "10.0.0.2:4242",
+			header: http.Header{"X-Forwarded-For": {"203.0.113.7"}},
+			want:   "203.0.113.7",
+		},
+		{
+			name:   "forged before trusted proxy",
+			remote: "10.0.0.2:4242",
+			header: http.Header{"X-Forwarded-For": {"198.51.100.1, 203.0.113.7"}},
+			want:   "203.0.113.7",
+		},
+		{
+			name:   "chain of trusted proxies",
+			remote: "10.0.0.2:4242",
+			header: http.Header{"X-Forwarded-For": {"198.51.100.1, 203.0.113.7", "10.0.0.3"}},
+			want:   "203.0.113.7",
+		},
+		{
+			name:   "only trusted hops",
+			remote: "10.0.0.2:4242",
+			header: http.Header{"X-Forwarded-For": {"10.0.0.4, 10.0.0.3"}},
+			want:   "10.0.0.4",
+		},
+		{
+			name:   "real ip from trusted proxy",
+			remote: "[fd00::2]:4242",
+			header: http.Header{"X-Real-Ip": {"2001:db8::7"}},
+			want:   "2001:db8::7",
+		},
+		{
+			name:   "mapped addresses",
+			remote: "[::ffff:10.0.0.2]:4242",
+			header: http.Header{"X-Forwarded-For": {"::ffff:203.0.113.7"}},
+			want:   "203.0.113.7",
+		},
+		{
+			name:   "malformed hop",
+			remote: "10.0.0.2:4242",
+			header: http.Header{"X-Forwarded-For": {"203.0.113.7, unknown"}},
+			want:   "10.0.0.2:4242",
+		},
+		{
+			name:   "trusted proxy without headers",
+			remote: "10.0.0.2:4242",
+			want:   "10.0.0.2:4242",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			h := Middleware(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.RemoteAddr
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remote
+			r.Header = tt.header
+			if r.Header == nil {
+				r.Header = http.Header{}
+			}
+			h.ServeHTTP(httptest.NewRecorder(), r)
+			if got != tt.want {
+				t.Errorf("RemoteAddr = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,27 +1,257 @@
 package config
 
 import (
+	"crypto/rand"
 	"errors"
 	"fmt"
 	"log/slog"
+	"net/netip"
+	"net/url"
 	"os"
+	"reflect"
+	"slices"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Config struct {
-	Dev              bool
-	Port             string
-	OpenAIKey        string
-	OpenAIURL        string
-	SearxngHost      string
-	Public           bool
-	AIEnabled        bool
-	PostgresHost     string
-	PostgresPort     string
-	PostgresDatabase string
-	PostgresUsername string
-	PostgresPassword string
+	Dev               bool
+	Port              string
+	MetricsPort       string
+	OpenAIKey         string
+	OpenAIURL         string
+	SearxngHosts      []SearxngUpstream
+	Public            bool
+	TrustedProxies    []netip.Prefix
+	AIEnabled         bool
+	PostgresHost      string
+	PostgresPort      string
+	PostgresDatabase  string
+	PostgresUsername  string
+	PostgresPassword  string
+	RateLimitStore    string
+	RateLimitSearch   RateLimit
+	RateLimitIcons    RateLimit
+	RateLimitSuggest  RateLimit
+	RateLimitRedirect RateLimit
+	SecretKey         string
+	HistoryEnabled    bool
+	HistoryRetention  time.Duration
+	ClicksEnabled     bool
+	ClicksRetention   time.Duration
+	QueryLogEnabled   bool
+	QueryLogRetention time.Duration
+	AutoCorrect       bool
+	AlertsEnabled     bool
+	AlertsInterval    time.Duration
+	AlertsWebhookURL  string
+	CacheStore        string
+	CacheMemoryMB     int
+	CacheMaxEntryKB   map[string]int
+	CacheMaxTableMB   int
+	AdminUsername     string
+	AdminPassword     string
+	TracingExporter   string
+	TracingEndpoint   string
+	TracingRatio      float64
+	TracingTrusted    bool
+	ReadyCheckAI      bool
+	ShutdownDelay     time.Duration
+	IconsFallbackURL  string
+	EgressAllowHosts  []string
+	EgressDenyHosts   []string
+	Federation        []FederationBackend
+	IngestPaths       []IngestPath
+}
+
+// RateLimit is a number of requests allowed per window. A zero Requests
+// disables the limit.
+type RateLimit struct {
+	Requests int
+	Window   time.Duration
+}
+
+func (r RateLimit) String() string {
+	return fmt.Sprintf("%d/%s", r.Requests, r.Window)
+}
+
+// SearxngUpstream is a SearXNG instance searches are spread across. An
+// upstream with twice the weight of another gets about twice the traffic
+// when both answer equally fast.
+type SearxngUpstream struct {
+	URL    string
+	Weight int
+}
+
+func (u SearxngUpstream) String() string {
+	return redactURL(u.URL) + "=" + strconv.Itoa(u.Weight)
+}
+
+// ParseSearxngHosts parses a comma separated list of SearXNG instances, each
+// optionally followed by "=weight". Instances without a weight get 1.
+func ParseSearxngHosts(s string) ([]SearxngUpstream, error) {
+	var hosts []SearxngUpstream
+	for item := range strings.SplitSeq(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		u := SearxngUpstream{URL: item, Weight: 1}
+		if i := strings.LastIndex(item, "="); i != -1 {
+			n, err := strconv.Atoi(item[i+1:])
+			if err != nil || n <= 0 {
+				return nil, fmt.Errorf("invalid weight for SearXNG host %q", item)
+			}
+			u = SearxngUpstream{URL: item[:i], Weight: n}
+		}
+		hosts = append(hosts, u)
+	}
+	return hosts, nil
+}
+
+const (
+	// FederationAletis is another Aletis instance, searched through its
+	// JSON Feed
+	FederationAletis = "aletis"
+	// FederationMediaWiki is a wiki, the target is the URL of its api.php
+	FederationMediaWiki = "mediawiki"
+	// FederationPostgres is the documents table, the target optionally
+	// names the source of the documents searched
+	FederationPostgres = "postgres"
+)
+
+// defaultFederationTimeout applies to backends listed without a timeout.
+const defaultFederationTimeout = time.Second * 2
+
+// FederationBackend is a search backend whose results are merged with those
+// of SearXNG.
+type FederationBackend struct {
+	Name    string
+	Kind    string
+	Target  string
+	Timeout time.Duration
+}
+
+func (b FederationBackend) String() string {
+	return fmt.Sprintf("%s=%s:%s|%s", b.Name, b.Kind, redactURL(b.Target), b.Timeout)
+}
+
+// ParseFederationBackends parses a comma separated list of backends in the
+// form "name=kind:target|timeout", such as
+// "wiki=mediawiki:https://wiki.example/w/api.php|1s". The target and the
+// timeout may be left out.
+func ParseFederationBackends(s string) ([]FederationBackend, error) {
+	var backends []FederationBackend
+	for _, item := range splitList(s) {
+		name, rest, ok := strings.Cut(item, "=")
+		if !ok || name == "" {
+			return nil, fmt.Errorf("federated backend %q has no name", item)
+		}
+		if name == "web" {
+			return nil, errors.New(`federated backend name "web" is reserved for SearXNG`)
+		}
+		b := FederationBackend{Name: name, Timeout: defaultFederationTimeout}
+		if i := strings.LastIndex(rest, "|"); i != -1 {
+			d, err := time.ParseDuration(rest[i+1:])
+			if err != nil || d <= 0 {
+				return nil, fmt.Errorf("invalid timeout for federated backend %q", name)
+			}
+			b.Timeout = d
+			rest = rest[:i]
+		}
+		b.Kind, b.Target, _ = strings.Cut(rest, ":")
+		switch b.Kind {
+		case FederationAletis, FederationMediaWiki:
+			u, err := url.Parse(b.Target)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return nil, fmt.Errorf("federated backend %q needs an http(s) URL", name)
+			}
+		case FederationPostgres:
+		default:
+			return nil, fmt.Errorf("federated backend %q must be of kind %q, %q or %q", name, FederationAletis, FederationMediaWiki, FederationPostgres)
+		}
+		if slices.ContainsFunc(backends, func(o FederationBackend) bool { return o.Name == name }) {
+			return nil, fmt.Errorf("federated backend %q is listed twice", name)
+		}
+		backends = append(backends, b)
+	}
+	return backends, nil
+}
+
+// IngestPath is a directory whose documents `aletis ingest` keeps in the
+// documents table under the name of the source.
+type IngestPath struct {
+	Source string
+	Path   string
+	// BaseURL links the documents, except those of git clones, which are
+	// linked on the host of their origin remote.
+	BaseURL string
+}
+
+func (p IngestPath) String() string {
+	return p.Source + "=" + p.Path + "|" + redactURL(p.BaseURL)
+}
+
+// ParseIngestPaths parses a comma separated list of directories in the form
+// "source=path|base URL", such as "handbook=/srv/handbook|https://handbook.example/".
+// Documents are only searchable through links, so the base URL is required.
+func ParseIngestPaths(s string) ([]IngestPath, error) {
+	var paths []IngestPath
+	for _, item := range splitList(s) {
+		source, rest, ok := strings.Cut(item, "=")
+		if !ok || source == "" {
+			return nil, fmt.Errorf("ingest path %q has no source name", item)
+		}
+		p := IngestPath{Source: source}
+		p.Path, p.BaseURL, _ = strings.Cut(rest, "|")
+		if p.Path == "" {
+			return nil, fmt.Errorf("ingest source %q has no path", source)
+		}
+		u, err := url.Parse(p.BaseURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("ingest source %q needs an http(s) base URL", source)
+		}
+		if slices.ContainsFunc(paths, func(o IngestPath) bool { return o.Source == source }) {
+			return nil, fmt.Errorf("ingest source %q is listed twice", source)
+		}
+		paths = append(paths, p)
+	}
+	return paths, nil
+}
+
+const (
+	RateLimitStoreMemory   = "memory"
+	RateLimitStorePostgres = "postgres"
+)
+
+const (
+	// CacheStoreTiered keeps an in-memory LRU in front of Postgres
+	CacheStoreTiered   = "tiered"
+	CacheStorePostgres = "postgres"
+	// CacheStoreMemory needs no database when POSTGRES_HOST is unset
+	CacheStoreMemory = "memory"
+)
+
+// TracingExporterOTLP sends spans over OTLP/HTTP. The standard
+// OTEL_EXPORTER_OTLP_* variables apply when TRACING_ENDPOINT is unset.
+const TracingExporterOTLP = "otlp"
+
+// ParseRateLimit parses limits in the form "10/1m".
+func ParseRateLimit(s string) (RateLimit, error) {
+	requests, window, ok := strings.Cut(s, "/")
+	if !ok {
+		return RateLimit{}, fmt.Errorf("rate limit %q is not in the form requests/window", s)
+	}
+	n, err := strconv.Atoi(requests)
+	if err != nil || n < 0 {
+		return RateLimit{}, fmt.Errorf("invalid request count in rate limit %q", s)
+	}
+	d, err := time.ParseDuration(window)
+	if err != nil || d <= 0 {
+		return RateLimit{}, fmt.Errorf("invalid window in rate limit %q", s)
+	}
+	return RateLimit{Requests: n, Window: d}, nil
 }
 
 type Option func(*Config) error
@@ -59,9 +289,15 @@ func WithOpenAIURL(url string) Option {
 	}
 }
 
-func WithSearxngHost(host string) Option {
+// WithSearxngHost sets the SearXNG instances from a list such as
+// "http://a:8080=2,http://b:8080".
+func WithSearxngHost(hosts string) Option {
 	return func(c *Config) error {
-		c.SearxngHost = host
+		upstreams, err := ParseSearxngHosts(hosts)
+		if err != nil {
+			return fmt.Errorf("unable to parse SEARXNG_HOST environment variable: %w", err)
+		}
+		c.SearxngHosts = upstreams
 		return nil
 	}
 }
@@ -77,6 +313,41 @@ func WithPublicString(public string) Option {
 	}
 }
 
+// WithTrustedProxiesString sets the proxies whose forwarded client
+// addresses are believed, see ParseTrustedProxies.
+func WithTrustedProxiesString(proxies string) Option {
+	return func(c *Config) error {
+		p, err := ParseTrustedProxies(proxies)
+		if err != nil {
+			return fmt.Errorf("unable to parse TRUSTED_PROXIES environment variable: %w", err)
+		}
+		c.TrustedProxies = p
+		return nil
+	}
+}
+
+// ParseTrustedProxies parses a comma separated list of addresses and CIDR
+// ranges.
+func ParseTrustedProxies(s string) ([]netip.Prefix, error) {
+	var proxies []netip.Prefix
+	for _, item := range splitList(s) {
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, err
+			}
+			proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		p, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, err
+		}
+		proxies = append(proxies, p.Masked())
+	}
+	return proxies, nil
+}
+
 func WithAIEnabledString(enabled string) Option {
 	return func(c *Config) error {
 		boolValue, err := strconv.ParseBool(enabled)
@@ -122,8 +393,362 @@ func WithPostgresPassword(password string) Option {
 		return nil
 	}
 }
+
+func WithRateLimitStore(store string) Option {
+	return func(c *Config) error {
+		c.RateLimitStore = store
+		return nil
+	}
+}
+
+func WithRateLimitSearchString(limit string) Option {
+	return func(c *Config) error {
+		rl, err := ParseRateLimit(limit)
+		if err != nil {
+			return fmt.Errorf("unable to parse RATE_LIMIT_SEARCH environment variable: %w", err)
+		}
+		c.RateLimitSearch = rl
+		return nil
+	}
+}
+
+func WithRateLimitIconsString(limit string) Option {
+	return func(c *Config) error {
+		rl, err := ParseRateLimit(limit)
+		if err != nil {
+			return fmt.Errorf("unable to parse RATE_LIMIT_ICONS environment variable: %w", err)
+		}
+		c.RateLimitIcons = rl
+		return nil
+	}
+}
+
+func WithRateLimitSuggestString(limit string) Option {
+	return func(c *Config) error {
+		rl, err := ParseRateLimit(limit)
+		if err != nil {
+			return fmt.Errorf("unable to parse RATE_LIMIT_SUGGEST environment variable: %w", err)
+		}
+		c.RateLimitSuggest = rl
+		return nil
+	}
+}
+
+func WithRateLimitRedirectString(limit string) Option {
+	return func(c *Config) error {
+		rl, err := ParseRateLimit(limit)
+		if err != nil {
+			return fmt.Errorf("unable to parse RATE_LIMIT_REDIRECT environment variable: %w", err)
+		}
+		c.RateLimitRedirect = rl
+		return nil
+	}
+}
+
+func WithSecretKey(key string) Option {
+	return func(c *Config) error {
+		c.SecretKey = key
+		return nil
+	}
+}
+
+func WithIconsFallbackURL(url string) Option {
+	return func(c *Config) error {
+		c.IconsFallbackURL = url
+		return nil
+	}
+}
+
+// WithEgressAllowHostsString restricts fetches of third-party content to a
+// comma separated list of hosts and their subdomains.
+func WithEgressAllowHostsString(hosts string) Option {
+	return func(c *Config) error {
+		c.EgressAllowHosts = splitList(hosts)
+		return nil
+	}
+}
+
+// WithEgressDenyHostsString refuses fetches of third-party content from a
+// comma separated list of hosts and their subdomains.
+func WithEgressDenyHostsString(hosts string) Option {
+	return func(c *Config) error {
+		c.EgressDenyHosts = splitList(hosts)
+		return nil
+	}
+}
+
+// WithFederationString sets the backends searched alongside SearXNG, see
+// ParseFederationBackends.
+func WithFederationString(backends string) Option {
+	return func(c *Config) error {
+		b, err := ParseFederationBackends(backends)
+		if err != nil {
+			return fmt.Errorf("unable to parse FEDERATION_BACKENDS environment variable: %w", err)
+		}
+		c.Federation = b
+		return nil
+	}
+}
+
+// WithIngestPathsString sets the directories indexed by `aletis ingest`,
+// see ParseIngestPaths.
+func WithIngestPathsString(paths string) Option {
+	return func(c *Config) error {
+		p, err := ParseIngestPaths(paths)
+		if err != nil {
+			return fmt.Errorf("unable to parse INGEST_PATHS environment variable: %w", err)
+		}
+		c.IngestPaths = p
+		return nil
+	}
+}
+
+func splitList(s string) []string {
+	var out []string
+	for item := range strings.SplitSeq(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			out = append(out, item)
+		}
+	}
+	return out
+}
+
+func WithMetricsPort(port string) Option {
+	return func(c *Config) error {
+		c.MetricsPort = port
+		return nil
+	}
+}
+
+func WithAdminUsername(username string) Option {
+	return func(c *Config) error {
+		c.AdminUsername = username
+		return nil
+	}
+}
+
+func WithAdminPassword(password string) Option {
+	return func(c *Config) error {
+		c.AdminPassword = password
+		return nil
+	}
+}
+
+func WithHistoryEnabledString(enabled string) Option {
+	return func(c *Config) error {
+		boolValue, err := strconv.ParseBool(enabled)
+		if err != nil {
+			return fmt.Errorf("unable to parse HISTORY_ENABLED environment variable: %w", err)
+		}
+		c.HistoryEnabled = boolValue
+		return nil
+	}
+}
+
+func WithHistoryRetentionString(retention string) Option {
+	return func(c *Config) error {
+		d, err := time.ParseDuration(retention)
+		if err != nil {
+			return fmt.Errorf("unable to parse HISTORY_RETENTION environment variable: %w", err)
+		}
+		c.HistoryRetention = d
+		return nil
+	}
+}
+
+func WithClicksEnabledString(enabled string) Option {
+	return func(c *Config) error {
+		boolValue, err := strconv.ParseBool(enabled)
+		if err != nil {
+			return fmt.Errorf("unable to parse CLICKS_ENABLED environment variable: %w", err)
+		}
+		c.ClicksEnabled = boolValue
+		return nil
+	}
+}
+
+func WithClicksRetentionString(retention string) Option {
+	return func(c *Config) error {
+		d, err := time.ParseDuration(retention)
+		if err != nil {
+			return fmt.Errorf("unable to parse CLICKS_RETENTION environment variable: %w", err)
+		}
+		c.ClicksRetention = d
+		return nil
+	}
+}
+
+func WithQueryLogEnabledString(enabled string) Option {
+	return func(c *Config) error {
+		boolValue, err := strconv.ParseBool(enabled)
+		if err != nil {
+			return fmt.Errorf("unable to parse QUERY_LOG_ENABLED environment variable: %w", err)
+		}
+		c.QueryLogEnabled = boolValue
+		return nil
+	}
+}
+
+func WithAutoCorrectString(enabled string) Option {
+	return func(c *Config) error {
+		boolValue, err := strconv.ParseBool(enabled)
+		if err != nil {
+			return fmt.Errorf("unable to parse SPELLING_AUTOCORRECT environment variable: %w", err)
+		}
+		c.AutoCorrect = boolValue
+		return nil
+	}
+}
+
+func WithQueryLogRetentionString(retention string) Option {
+	return func(c *Config) error {
+		d, err := time.ParseDuration(retention)
+		if err != nil {
+			return fmt.Errorf("unable to parse QUERY_LOG_RETENTION environment variable: %w", err)
+		}
+		c.QueryLogRetention = d
+		return nil
+	}
+}
+
+func WithAlertsEnabledString(enabled string) Option {
+	return func(c *Config) error {
+		boolValue, err := strconv.ParseBool(enabled)
+		if err != nil {
+			return fmt.Errorf("unable to parse ALERTS_ENABLED environment variable: %w", err)
+		}
+		c.AlertsEnabled = boolValue
+		return nil
+	}
+}
+
+func WithAlertsIntervalString(interval string) Option {
+	return func(c *Config) error {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			return fmt.Errorf("unable to parse ALERTS_INTERVAL environment variable: %w", err)
+		}
+		c.AlertsInterval = d
+		return nil
+	}
+}
+
+func WithAlertsWebhookURL(url string) Option {
+	return func(c *Config) error {
+		c.AlertsWebhookURL = url
+		return nil
+	}
+}
+
+func WithCacheStore(store string) Option {
+	return func(c *Config) error {
+		c.CacheStore = store
+		return nil
+	}
+}
+
+func WithCacheMemoryMBString(size string) Option {
+	return func(c *Config) error {
+		n, err := strconv.Atoi(size)
+		if err != nil {
+			return fmt.Errorf("unable to parse CACHE_MEMORY_MB environment variable: %w", err)
+		}
+		c.CacheMemoryMB = n
+		return nil
+	}
+}
+
+// WithCacheMaxEntryKBString sets the maximum entry size of namespaces from
+// a list such as "search=2048,ai=64". Namespaces not listed keep their
+// default.
+func WithCacheMaxEntryKBString(sizes string) Option {
+	return func(c *Config) error {
+		for item := range strings.SplitSeq(sizes, ",") {
+			ns, size, ok := strings.Cut(strings.TrimSpace(item), "=")
+			if !ok {
+				return fmt.Errorf("unable to parse CACHE_MAX_ENTRY_KB environment variable: %q is not namespace=size", item)
+			}
+			n, err := strconv.Atoi(strings.TrimSpace(size))
+			if err != nil {
+				return fmt.Errorf("unable to parse CACHE_MAX_ENTRY_KB environment variable: %w", err)
+			}
+			c.CacheMaxEntryKB[strings.TrimSpace(ns)] = n
+		}
+		return nil
+	}
+}
+
+func WithCacheMaxTableMBString(size string) Option {
+	return func(c *Config) error {
+		n, err := strconv.Atoi(size)
+		if err != nil {
+			return fmt.Errorf("unable to parse CACHE_MAX_TABLE_MB environment variable: %w", err)
+		}
+		c.CacheMaxTableMB = n
+		return nil
+	}
+}
+
+func WithTracingExporter(exporter string) Option {
+	return func(c *Config) error {
+		c.TracingExporter = exporter
+		return nil
+	}
+}
+
+func WithTracingEndpoint(endpoint string) Option {
+	return func(c *Config) error {
+		c.TracingEndpoint = endpoint
+		return nil
+	}
+}
+
+func WithTracingRatioString(ratio string) Option {
+	return func(c *Config) error {
+		f, err := strconv.ParseFloat(ratio, 64)
+		if err != nil {
+			return fmt.Errorf("unable to parse TRACING_SAMPLE_RATIO environment variable: %w", err)
+		}
+		c.TracingRatio = f
+		return nil
+	}
+}
+
+func WithTracingTrustedString(trusted string) Option {
+	return func(c *Config) error {
+		boolValue, err := strconv.ParseBool(trusted)
+		if err != nil {
+			return fmt.Errorf("unable to parse TRACING_TRUST_PARENT environment variable: %w", err)
+		}
+		c.TracingTrusted = boolValue
+		return nil
+	}
+}
+
+func WithReadyCheckAIString(enabled string) Option {
+	return func(c *Config) error {
+		boolValue, err := strconv.ParseBool(enabled)
+		if err != nil {
+			return fmt.Errorf("unable to parse READY_CHECK_AI environment variable: %w", err)
+		}
+		c.ReadyCheckAI = boolValue
+		return nil
+	}
+}
+
+func WithShutdownDelayString(delay string) Option {
+	return func(c *Config) error {
+		d, err := time.ParseDuration(delay)
+		if err != nil {
+			return fmt.Errorf("unable to parse SHUTDOWN_DELAY environment variable: %w", err)
+		}
+		c.ShutdownDelay = d
+		return nil
+	}
+}
+
 func ValidSearxngHost(c *Config) error {
-	if c.SearxngHost == "" {
+	if len(c.SearxngHosts) == 0 {
 		return errors.New("SEARXNG_HOST is not set")
 	}
 	return nil
@@ -144,6 +769,9 @@ func ValidAi(c *Config) error {
 }
 
 func ValidPostgres(c *Config) error {
+	if !c.DatabaseEnabled() {
+		return nil
+	}
 	if c.PostgresHost == "" {
 		return errors.New("POSTGRES_HOST is not set")
 	}
@@ -159,6 +787,110 @@ func ValidPostgres(c *Config) error {
 	return nil
 }
 
+func ValidRateLimit(c *Config) error {
+	switch c.RateLimitStore {
+	case RateLimitStoreMemory:
+		return nil
+	case RateLimitStorePostgres:
+		if !c.DatabaseEnabled() {
+			return errors.New("RATE_LIMIT_STORE postgres requires POSTGRES_HOST")
+		}
+		return nil
+	}
+	return fmt.Errorf("RATE_LIMIT_STORE must be %q or %q", RateLimitStoreMemory, RateLimitStorePostgres)
+}
+
+func ValidSecretKey(c *Config) error {
+	if c.SecretKey == "" && c.ClicksActive() {
+		// Click statistics are keyed by it and would be split by every
+		// restart and replica
+		return errors.New("CLICKS_ENABLED requires SECRET_KEY")
+	}
+	if c.SecretKey == "" {
+		// Signed links stop working on restart and differ between replicas
+		c.SecretKey = rand.Text()
+		slog.Warn("missing SECRET_KEY using a random key")
+	}
+	return nil
+}
+
+func ValidHistory(c *Config) error {
+	if c.HistoryEnabled && !c.DatabaseEnabled() {
+		return errors.New("HISTORY_ENABLED requires POSTGRES_HOST")
+	}
+	if c.HistoryEnabled && c.HistoryRetention <= 0 {
+		return errors.New("HISTORY_RETENTION must be positive")
+	}
+	return nil
+}
+
+func ValidClicks(c *Config) error {
+	if c.ClicksEnabled && c.ClicksRetention <= 0 {
+		return errors.New("CLICKS_RETENTION must be positive")
+	}
+	return nil
+}
+
+func ValidQueryLog(c *Config) error {
+	if c.QueryLogEnabled && c.QueryLogRetention <= 0 {
+		return errors.New("QUERY_LOG_RETENTION must be positive")
+	}
+	return nil
+}
+
+func ValidFederation(c *Config) error {
+	for _, b := range c.Federation {
+		if b.Kind == FederationPostgres && !c.DatabaseEnabled() {
+			return fmt.Errorf("federated backend %q requires POSTGRES_HOST", b.Name)
+		}
+	}
+	return nil
+}
+
+func ValidAlerts(c *Config) error {
+	if !c.AlertsEnabled {
+		return nil
+	}
+	// Alerts run the saved searches kept by the history subsystem
+	if !c.HistoryEnabled {
+		return errors.New("ALERTS_ENABLED requires HISTORY_ENABLED")
+	}
+	if c.AlertsInterval < time.Minute*15 {
+		return errors.New("ALERTS_INTERVAL must be at least 15m")
+	}
+	return nil
+}
+
+func ValidCache(c *Config) error {
+	switch c.CacheStore {
+	case CacheStoreTiered, CacheStorePostgres, CacheStoreMemory:
+	default:
+		return fmt.Errorf("CACHE_STORE must be %q, %q or %q", CacheStoreTiered, CacheStorePostgres, CacheStoreMemory)
+	}
+	if c.CacheStore != CacheStorePostgres && c.CacheMemoryMB <= 0 {
+		return errors.New("CACHE_MEMORY_MB must be positive")
+	}
+	for ns, size := range c.CacheMaxEntryKB {
+		if size <= 0 {
+			return fmt.Errorf("CACHE_MAX_ENTRY_KB for %q must be positive", ns)
+		}
+	}
+	if c.CacheMaxTableMB < 0 {
+		return errors.New("CACHE_MAX_TABLE_MB must not be negative")
+	}
+	return nil
+}
+
+func ValidTracing(c *Config) error {
+	if c.TracingExporter != "" && c.TracingExporter != TracingExporterOTLP {
+		return fmt.Errorf("TRACING_EXPORTER must be empty or %q", TracingExporterOTLP)
+	}
+	if c.TracingRatio < 0 || c.TracingRatio > 1 {
+		return errors.New("TRACING_SAMPLE_RATIO must be between 0 and 1")
+	}
+	return nil
+}
+
 func ValidDefault(c *Config) (err error) {
 	if err = ValidSearxngHost(c); err != nil {
 		return err
@@ -168,10 +900,46 @@ func ValidDefault(c *Config) (err error) {
 		return err
 	}
 
+	if err = ValidCache(c); err != nil {
+		return err
+	}
+
 	if err = ValidPostgres(c); err != nil {
 		return err
 	}
 
+	if err = ValidRateLimit(c); err != nil {
+		return err
+	}
+
+	if err = ValidSecretKey(c); err != nil {
+		return err
+	}
+
+	if err = ValidHistory(c); err != nil {
+		return err
+	}
+
+	if err = ValidClicks(c); err != nil {
+		return err
+	}
+
+	if err = ValidQueryLog(c); err != nil {
+		return err
+	}
+
+	if err = ValidFederation(c); err != nil {
+		return err
+	}
+
+	if err = ValidAlerts(c); err != nil {
+		return err
+	}
+
+	if err = ValidTracing(c); err != nil {
+		return err
+	}
+
 	return nil
 }
 
@@ -185,9 +953,15 @@ func EnvConfigOptions() []Option {
 	if addr, exist := trimLookupEnv("PORT"); exist {
 		confOptions = append(confOptions, WithPort(addr))
 	}
+	if metricsPort, exist := trimLookupEnv("METRICS_PORT"); exist {
+		confOptions = append(confOptions, WithMetricsPort(metricsPort))
+	}
 	if public, ok := trimLookupEnv("PUBLIC"); ok {
 		confOptions = append(confOptions, WithPublicString(public))
 	}
+	if proxies, ok := trimLookupEnv("TRUSTED_PROXIES"); ok {
+		confOptions = append(confOptions, WithTrustedProxiesString(proxies))
+	}
 	// AI
 	if aiEnabled, ok := trimLookupEnv("AI_ENABLED"); ok {
 		confOptions = append(confOptions, WithAIEnabledString(aiEnabled))
@@ -214,6 +988,118 @@ func EnvConfigOptions() []Option {
 	if postgresPassword, ok := trimLookupEnv("POSTGRES_PASSWORD"); ok {
 		confOptions = append(confOptions, WithPostgresPassword(postgresPassword))
 	}
+	// Rate limiting
+	if store, ok := trimLookupEnv("RATE_LIMIT_STORE"); ok {
+		confOptions = append(confOptions, WithRateLimitStore(store))
+	}
+	if limit, ok := trimLookupEnv("RATE_LIMIT_SEARCH"); ok {
+		confOptions = append(confOptions, WithRateLimitSearchString(limit))
+	}
+	if limit, ok := trimLookupEnv("RATE_LIMIT_ICONS"); ok {
+		confOptions = append(confOptions, WithRateLimitIconsString(limit))
+	}
+	if limit, ok := trimLookupEnv("RATE_LIMIT_SUGGEST"); ok {
+		confOptions = append(confOptions, WithRateLimitSuggestString(limit))
+	}
+	if limit, ok := trimLookupEnv("RATE_LIMIT_REDIRECT"); ok {
+		confOptions = append(confOptions, WithRateLimitRedirectString(limit))
+	}
+	if secretKey, ok := trimLookupEnv("SECRET_KEY"); ok {
+		confOptions = append(confOptions, WithSecretKey(secretKey))
+	}
+	// History
+	if historyEnabled, ok := trimLookupEnv("HISTORY_ENABLED"); ok {
+		confOptions = append(confOptions, WithHistoryEnabledString(historyEnabled))
+	}
+	if retention, ok := trimLookupEnv("HISTORY_RETENTION"); ok {
+		confOptions = append(confOptions, WithHistoryRetentionString(retention))
+	}
+	// Click statistics
+	if clicksEnabled, ok := trimLookupEnv("CLICKS_ENABLED"); ok {
+		confOptions = append(confOptions, WithClicksEnabledString(clicksEnabled))
+	}
+	if retention, ok := trimLookupEnv("CLICKS_RETENTION"); ok {
+		confOptions = append(confOptions, WithClicksRetentionString(retention))
+	}
+	// Query log
+	if queryLogEnabled, ok := trimLookupEnv("QUERY_LOG_ENABLED"); ok {
+		confOptions = append(confOptions, WithQueryLogEnabledString(queryLogEnabled))
+	}
+	if retention, ok := trimLookupEnv("QUERY_LOG_RETENTION"); ok {
+		confOptions = append(confOptions, WithQueryLogRetentionString(retention))
+	}
+	// Spelling
+	if autoCorrect, ok := trimLookupEnv("SPELLING_AUTOCORRECT"); ok {
+		confOptions = append(confOptions, WithAutoCorrectString(autoCorrect))
+	}
+	// Alerts
+	if alertsEnabled, ok := trimLookupEnv("ALERTS_ENABLED"); ok {
+		confOptions = append(confOptions, WithAlertsEnabledString(alertsEnabled))
+	}
+	if interval, ok := trimLookupEnv("ALERTS_INTERVAL"); ok {
+		confOptions = append(confOptions, WithAlertsIntervalString(interval))
+	}
+	if webhook, ok := trimLookupEnv("ALERTS_WEBHOOK_URL"); ok {
+		confOptions = append(confOptions, WithAlertsWebhookURL(webhook))
+	}
+	// Cache
+	if store, ok := trimLookupEnv("CACHE_STORE"); ok {
+		confOptions = append(confOptions, WithCacheStore(store))
+	}
+	if size, ok := trimLookupEnv("CACHE_MEMORY_MB"); ok {
+		confOptions = append(confOptions, WithCacheMemoryMBString(size))
+	}
+	if sizes, ok := trimLookupEnv("CACHE_MAX_ENTRY_KB"); ok {
+		confOptions = append(confOptions, WithCacheMaxEntryKBString(sizes))
+	}
+	if size, ok := trimLookupEnv("CACHE_MAX_TABLE_MB"); ok {
+		confOptions = append(confOptions, WithCacheMaxTableMBString(size))
+	}
+	// Health
+	if checkAI, ok := trimLookupEnv("READY_CHECK_AI"); ok {
+		confOptions = append(confOptions, WithReadyCheckAIString(checkAI))
+	}
+	if delay, ok := trimLookupEnv("SHUTDOWN_DELAY"); ok {
+		confOptions = append(confOptions, WithShutdownDelayString(delay))
+	}
+	// Icons
+	if url, ok := trimLookupEnv("ICONS_FALLBACK_URL"); ok {
+		confOptions = append(confOptions, WithIconsFallbackURL(url))
+	}
+	// Egress
+	if hosts, ok := trimLookupEnv("EGRESS_ALLOW_HOSTS"); ok {
+		confOptions = append(confOptions, WithEgressAllowHostsString(hosts))
+	}
+	if hosts, ok := trimLookupEnv("EGRESS_DENY_HOSTS"); ok {
+		confOptions = append(confOptions, WithEgressDenyHostsString(hosts))
+	}
+	// Federation and ingestion
+	if backends, ok := trimLookupEnv("FEDERATION_BACKENDS"); ok {
+		confOptions = append(confOptions, WithFederationString(backends))
+	}
+	if paths, ok := trimLookupEnv("INGEST_PATHS"); ok {
+		confOptions = append(confOptions, WithIngestPathsString(paths))
+	}
+	// Tracing
+	if exporter, ok := trimLookupEnv("TRACING_EXPORTER"); ok {
+		confOptions = append(confOptions, WithTracingExporter(exporter))
+	}
+	if endpoint, ok := trimLookupEnv("TRACING_ENDPOINT"); ok {
+		confOptions = append(confOptions, WithTracingEndpoint(endpoint))
+	}
+	if ratio, ok := trimLookupEnv("TRACING_SAMPLE_RATIO"); ok {
+		confOptions = append(confOptions, WithTracingRatioString(ratio))
+	}
+	if trusted, ok := trimLookupEnv("TRACING_TRUST_PARENT"); ok {
+		confOptions = append(confOptions, WithTracingTrustedString(trusted))
+	}
+	// Admin
+	if username, ok := trimLookupEnv("ADMIN_USERNAME"); ok {
+		confOptions = append(confOptions, WithAdminUsername(username))
+	}
+	if password, ok := trimLookupEnv("ADMIN_PASSWORD"); ok {
+		confOptions = append(confOptions, WithAdminPassword(password))
+	}
 	return confOptions
 }
 func trimGetEnv(key string) string {
@@ -230,13 +1116,32 @@ func trimLookupEnv(key string) (string, bool) {
 
 func NewConfig(options ...Option) (*Config, error) {
 	conf := &Config{
-		Dev:              false,
-		Port:             "8080",
-		Public:           true,
-		AIEnabled:        false,
-		PostgresPort:     "5432",
-		PostgresDatabase: "aletis",
-		PostgresUsername: "aletis",
+		Dev:               false,
+		Port:              "8080",
+		Public:            true,
+		AIEnabled:         false,
+		PostgresPort:      "5432",
+		PostgresDatabase:  "aletis",
+		PostgresUsername:  "aletis",
+		RateLimitStore:    RateLimitStoreMemory,
+		RateLimitSearch:   RateLimit{Requests: 10, Window: time.Minute},
+		RateLimitIcons:    RateLimit{Requests: 300, Window: time.Minute},
+		RateLimitSuggest:  RateLimit{Requests: 120, Window: time.Minute},
+		RateLimitRedirect: RateLimit{Requests: 60, Window: time.Minute},
+		HistoryEnabled:    false,
+		HistoryRetention:  time.Hour * 24 * 90,
+		ClicksEnabled:     false,
+		ClicksRetention:   time.Hour * 24 * 30,
+		QueryLogEnabled:   false,
+		QueryLogRetention: time.Hour * 24 * 90,
+		AlertsEnabled:     false,
+		AlertsInterval:    time.Hour * 24,
+		CacheStore:        CacheStoreTiered,
+		CacheMemoryMB:     64,
+		CacheMaxEntryKB:   map[string]int{"search": 1024, "ai": 64, "icon": 256, "media": 2048},
+		CacheMaxTableMB:   1024,
+		AdminUsername:     "admin",
+		TracingRatio:      1,
 	}
 	for _, o := range options {
 		if err := o(conf); err != nil {
@@ -269,3 +1174,80 @@ func (c *Config) DBconnStr() string {
 		c.PostgresDatabase,
 	)
 }
+
+// RateLimitMaxWindow is the longest window of any route limit.
+func (c *Config) RateLimitMaxWindow() time.Duration {
+	return max(c.RateLimitSearch.Window, c.RateLimitIcons.Window, c.RateLimitSuggest.Window, c.RateLimitRedirect.Window)
+}
+
+// DatabaseEnabled reports whether Postgres is used. Only the memory cache
+// store can run without it.
+func (c *Config) DatabaseEnabled() bool {
+	return c.CacheStore != CacheStoreMemory || c.PostgresHost != ""
+}
+
+// ClicksActive reports whether clicked results are recorded and used for
+// ranking. It is off until CLICKS_ENABLED turns it on, and needs a database
+// to keep the statistics in.
+func (c *Config) ClicksActive() bool {
+	return c.ClicksEnabled && c.DatabaseEnabled()
+}
+
+// QueryLogActive reports whether searches are counted per query for
+// spelling correction and autocomplete. Popular queries are shown to
+// everyone as suggestions, so it is off until QUERY_LOG_ENABLED turns it on,
+// and needs a database.
+func (c *Config) QueryLogActive() bool {
+	return c.QueryLogEnabled && c.DatabaseEnabled()
+}
+
+// AdminEnabled reports whether the /admin routes are served. They are off
+// until an operator sets a password.
+func (c *Config) AdminEnabled() bool {
+	return c.AdminPassword != ""
+}
+
+// secretFields are never shown outside the process.
+var secretFields = map[string]bool{
+	"OpenAIKey":        true,
+	"PostgresPassword": true,
+	"SecretKey":        true,
+	"AdminPassword":    true,
+	// Webhook URLs are credentials themselves
+	"AlertsWebhookURL": true,
+}
+
+// redactURL strips the user info and query of a URL, where credentials such
+// as API keys and tokens are given. Values that aren't URLs are returned as
+// they are.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.Scheme == "" || u.Host == "" {
+		return s
+	}
+	u.User = nil
+	u.RawQuery = ""
+	u.ForceQuery = false
+	return u.String()
+}
+
+type Value struct {
+	Name  string
+	Value string
+}
+
+// Redacted lists every field of the config with secrets replaced and the
+// user info and query of URLs stripped, for display to operators.
+func (c *Config) Redacted() []Value {
+	v := reflect.ValueOf(c).Elem()
+	out := make([]Value, 0, v.NumField())
+	for i := range v.NumField() {
+		name := v.Type().Field(i).Name
+		value := redactURL(fmt.Sprint(v.Field(i).Interface()))
+		if secretFields[name] && value != "" {
+			value = "[redacted]"
+		}
+		out = append(out, Value{Name: name, Value: value})
+	}
+	return out
+}
@@ -0,0 +1,35 @@
+// Package dbtest connects tests to the Postgres database configured through
+// the usual POSTGRES_* environment variables.
+package dbtest
+
+import (
+	"testing"
+
+	sqlcdb "github.com/AletisSearch/aletis/db"
+	"github.com/AletisSearch/aletis/internal/config"
+	"github.com/AletisSearch/aletis/internal/db"
+	_ "github.com/amacneil/dbmate/v2/pkg/driver/postgres"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// New migrates the configured database and returns queries on it. Tests are
+// skipped when POSTGRES_HOST is unset.
+func New(t testing.TB) *db.Queries {
+	t.Helper()
+	conf, err := config.NewConfig(config.EnvConfigOptions()...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conf.PostgresHost == "" {
+		t.Skip("POSTGRES_HOST is not set")
+	}
+	if err = sqlcdb.ApplyMigrations(conf); err != nil {
+		t.Fatal(err)
+	}
+	pool, err := pgxpool.New(t.Context(), conf.DBconnStr())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	return db.New(pool)
+}
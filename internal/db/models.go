@@ -6,10 +6,159 @@ package db
 
 import (
 	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
+type AlertResult struct {
+	SavedSearchID int64
+	Url           string
+	Title         string
+	Content       string
+	Baseline      bool
+	Pending       bool
+	FirstSeen     time.Time
+}
+
+type ApiKey struct {
+	ID         int64
+	Name       string
+	Prefix     string
+	Hash       string
+	Scope      string
+	RateLimit  int32
+	DailyQuota int32
+	Created    time.Time
+	Revoked    *time.Time
+}
+
+type ApiKeyUsage struct {
+	KeyID int64
+	Day   pgtype.Date
+	Count int32
+}
+
 type Cache struct {
+	Key       string
+	Data      []byte
+	Expires   time.Time
+	Namespace string
+	Accessed  time.Time
+}
+
+type ClickDomainStat struct {
+	Domain  string
+	Clicks  int64
+	Weight  float64
+	Updated time.Time
+}
+
+type ClickEvent struct {
+	QueryHash string
+	Url       string
+	Domain    string
+	Position  int32
+	Client    []byte
+	Created   time.Time
+}
+
+type ClickQueryStat struct {
+	QueryHash string
+	Url       string
+	Clicks    int64
+	Weight    float64
+	Updated   time.Time
+}
+
+type ClickSalt struct {
+	Day  pgtype.Date
+	Salt []byte
+}
+
+type Document struct {
+	ID       int64
+	Source   string
+	Url      string
+	Title    string
+	Body     string
+	Modified time.Time
+	Search   interface{}
+	Path     string
+	Chunk    int32
+}
+
+type DomainRule struct {
+	Domain  string
+	Rule    string
+	Created time.Time
+}
+
+type EngineFailure struct {
+	Engine  string
+	Reason  string
+	Created time.Time
+}
+
+type HistoryClick struct {
+	ID      int64
+	UserID  string
+	Query   string
+	Url     string
+	Created time.Time
+}
+
+type LlmUsage struct {
+	Day              pgtype.Date
+	Model            string
+	Requests         int64
+	PromptTokens     int64
+	CompletionTokens int64
+	Cost             float64
+}
+
+type QueryLog struct {
+	Query    string
+	Day      pgtype.Date
+	Searches int64
+}
+
+type QueryLogClient struct {
+	Query  string
+	Day    pgtype.Date
+	Client []byte
+}
+
+type QueryLogSalt struct {
+	Day  pgtype.Date
+	Salt []byte
+}
+
+type RateLimit struct {
+	Key         string
+	WindowStart time.Time
+	Count       int32
+}
+
+type SavedSearch struct {
+	ID        int64
+	UserID    string
+	Query     string
+	Created   time.Time
+	Alert     bool
+	FeedToken string
+	LastRun   *time.Time
+}
+
+type SearchHistory struct {
+	ID      int64
+	UserID  string
+	Query   string
+	Source  string
+	Created time.Time
+}
+
+type Setting struct {
 	Key     string
-	Data    []byte
-	Expires time.Time
+	Value   string
+	Updated time.Time
 }
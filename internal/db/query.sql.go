@@ -8,8 +8,210 @@ package db
 import (
 	"context"
 	"time"
+
+	"github.com/jackc/pgx/v5/pgtype"
 )
 
+const cacheStats = `-- name: CacheStats :many
+SELECT namespace, count(*) AS entries, COALESCE(sum(octet_length(data)), 0)::bigint AS bytes
+FROM cache
+GROUP BY namespace
+ORDER BY namespace
+`
+
+type CacheStatsRow struct {
+	Namespace string
+	Entries   int64
+	Bytes     int64
+}
+
+func (q *Queries) CacheStats(ctx context.Context) ([]CacheStatsRow, error) {
+	rows, err := q.db.Query(ctx, cacheStats)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CacheStatsRow
+	for rows.Next() {
+		var i CacheStatsRow
+		if err := rows.Scan(&i.Namespace, &i.Entries, &i.Bytes); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const claimDueAlerts = `-- name: ClaimDueAlerts :many
+WITH due AS (
+    SELECT id, last_run FROM saved_searches
+    WHERE alert AND (last_run IS NULL OR last_run <= $1::timestamptz)
+    ORDER BY last_run NULLS FIRST
+    LIMIT 50
+    FOR UPDATE SKIP LOCKED
+)
+UPDATE saved_searches SET last_run = $2::timestamptz
+FROM due
+WHERE saved_searches.id = due.id
+RETURNING saved_searches.id, saved_searches.query, due.last_run AS previous_run
+`
+
+type ClaimDueAlertsParams struct {
+	DueBefore time.Time
+	Claimed   time.Time
+}
+
+type ClaimDueAlertsRow struct {
+	ID          int64
+	Query       string
+	PreviousRun *time.Time
+}
+
+// Alerts are claimed by moving their last run to now, rows claimed by
+// another replica at the same time are skipped.
+func (q *Queries) ClaimDueAlerts(ctx context.Context, arg ClaimDueAlertsParams) ([]ClaimDueAlertsRow, error) {
+	rows, err := q.db.Query(ctx, claimDueAlerts, arg.DueBefore, arg.Claimed)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ClaimDueAlertsRow
+	for rows.Next() {
+		var i ClaimDueAlertsRow
+		if err := rows.Scan(&i.ID, &i.Query, &i.PreviousRun); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const countEngineFailures = `-- name: CountEngineFailures :many
+SELECT engine, count(*) AS failures FROM engine_failures
+WHERE created > $1
+GROUP BY engine
+ORDER BY failures DESC, engine
+`
+
+type CountEngineFailuresRow struct {
+	Engine   string
+	Failures int64
+}
+
+func (q *Queries) CountEngineFailures(ctx context.Context, created time.Time) ([]CountEngineFailuresRow, error) {
+	rows, err := q.db.Query(ctx, countEngineFailures, created)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []CountEngineFailuresRow
+	for rows.Next() {
+		var i CountEngineFailuresRow
+		if err := rows.Scan(&i.Engine, &i.Failures); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const createAPIKey = `-- name: CreateAPIKey :one
+INSERT INTO api_keys (name, prefix, hash, scope, rate_limit, daily_quota)
+VALUES ($1, $2, $3, $4, $5, $6)
+RETURNING id, name, prefix, hash, scope, rate_limit, daily_quota, created, revoked
+`
+
+type CreateAPIKeyParams struct {
+	Name       string
+	Prefix     string
+	Hash       string
+	Scope      string
+	RateLimit  int32
+	DailyQuota int32
+}
+
+func (q *Queries) CreateAPIKey(ctx context.Context, arg CreateAPIKeyParams) (ApiKey, error) {
+	row := q.db.QueryRow(ctx, createAPIKey,
+		arg.Name,
+		arg.Prefix,
+		arg.Hash,
+		arg.Scope,
+		arg.RateLimit,
+		arg.DailyQuota,
+	)
+	var i ApiKey
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Prefix,
+		&i.Hash,
+		&i.Scope,
+		&i.RateLimit,
+		&i.DailyQuota,
+		&i.Created,
+		&i.Revoked,
+	)
+	return i, err
+}
+
+const deleteDocumentFile = `-- name: DeleteDocumentFile :exec
+DELETE FROM documents WHERE source = $1 AND path = $2
+`
+
+type DeleteDocumentFileParams struct {
+	Source string
+	Path   string
+}
+
+func (q *Queries) DeleteDocumentFile(ctx context.Context, arg DeleteDocumentFileParams) error {
+	_, err := q.db.Exec(ctx, deleteDocumentFile, arg.Source, arg.Path)
+	return err
+}
+
+const deleteDomainRule = `-- name: DeleteDomainRule :execrows
+DELETE FROM domain_rules WHERE domain = $1
+`
+
+func (q *Queries) DeleteDomainRule(ctx context.Context, domain string) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteDomainRule, domain)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteHistoryClickEntry = `-- name: DeleteHistoryClickEntry :exec
+DELETE FROM history_clicks WHERE id = $1 AND user_id = $2
+`
+
+type DeleteHistoryClickEntryParams struct {
+	ID     int64
+	UserID string
+}
+
+func (q *Queries) DeleteHistoryClickEntry(ctx context.Context, arg DeleteHistoryClickEntryParams) error {
+	_, err := q.db.Exec(ctx, deleteHistoryClickEntry, arg.ID, arg.UserID)
+	return err
+}
+
+const deleteHistoryClicks = `-- name: DeleteHistoryClicks :exec
+DELETE FROM history_clicks WHERE user_id = $1
+`
+
+func (q *Queries) DeleteHistoryClicks(ctx context.Context, userID string) error {
+	_, err := q.db.Exec(ctx, deleteHistoryClicks, userID)
+	return err
+}
+
 const deleteOld = `-- name: DeleteOld :exec
 DELETE FROM cache WHERE expires <= $1
 `
@@ -19,39 +221,1238 @@ func (q *Queries) DeleteOld(ctx context.Context, expires time.Time) error {
 	return err
 }
 
+const deleteOldAPIKeyUsage = `-- name: DeleteOldAPIKeyUsage :exec
+DELETE FROM api_key_usage WHERE day < CURRENT_DATE - 30
+`
+
+func (q *Queries) DeleteOldAPIKeyUsage(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteOldAPIKeyUsage)
+	return err
+}
+
+const deleteOldClickEvents = `-- name: DeleteOldClickEvents :exec
+DELETE FROM click_events WHERE created < $1
+`
+
+func (q *Queries) DeleteOldClickEvents(ctx context.Context, created time.Time) error {
+	_, err := q.db.Exec(ctx, deleteOldClickEvents, created)
+	return err
+}
+
+const deleteOldClickSalts = `-- name: DeleteOldClickSalts :exec
+DELETE FROM click_salts WHERE day < current_date
+`
+
+func (q *Queries) DeleteOldClickSalts(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteOldClickSalts)
+	return err
+}
+
+const deleteOldEngineFailures = `-- name: DeleteOldEngineFailures :exec
+DELETE FROM engine_failures WHERE created < $1
+`
+
+func (q *Queries) DeleteOldEngineFailures(ctx context.Context, created time.Time) error {
+	_, err := q.db.Exec(ctx, deleteOldEngineFailures, created)
+	return err
+}
+
+const deleteOldHistoryClicks = `-- name: DeleteOldHistoryClicks :exec
+DELETE FROM history_clicks WHERE created <= $1
+`
+
+func (q *Queries) DeleteOldHistoryClicks(ctx context.Context, created time.Time) error {
+	_, err := q.db.Exec(ctx, deleteOldHistoryClicks, created)
+	return err
+}
+
+const deleteOldQueryLog = `-- name: DeleteOldQueryLog :exec
+DELETE FROM query_log WHERE day < $1
+`
+
+func (q *Queries) DeleteOldQueryLog(ctx context.Context, day pgtype.Date) error {
+	_, err := q.db.Exec(ctx, deleteOldQueryLog, day)
+	return err
+}
+
+const deleteOldQueryLogClients = `-- name: DeleteOldQueryLogClients :exec
+WITH salts AS (
+    DELETE FROM query_log_salts WHERE day < current_date
+)
+DELETE FROM query_log_clients WHERE day < current_date
+`
+
+func (q *Queries) DeleteOldQueryLogClients(ctx context.Context) error {
+	_, err := q.db.Exec(ctx, deleteOldQueryLogClients)
+	return err
+}
+
+const deleteOldRateLimits = `-- name: DeleteOldRateLimits :exec
+DELETE FROM rate_limits WHERE window_start < $1
+`
+
+func (q *Queries) DeleteOldRateLimits(ctx context.Context, windowStart time.Time) error {
+	_, err := q.db.Exec(ctx, deleteOldRateLimits, windowStart)
+	return err
+}
+
+const deleteOldSearchHistory = `-- name: DeleteOldSearchHistory :exec
+DELETE FROM search_history WHERE created <= $1
+`
+
+func (q *Queries) DeleteOldSearchHistory(ctx context.Context, created time.Time) error {
+	_, err := q.db.Exec(ctx, deleteOldSearchHistory, created)
+	return err
+}
+
+const deleteSavedSearch = `-- name: DeleteSavedSearch :exec
+DELETE FROM saved_searches WHERE id = $1 AND user_id = $2
+`
+
+type DeleteSavedSearchParams struct {
+	ID     int64
+	UserID string
+}
+
+func (q *Queries) DeleteSavedSearch(ctx context.Context, arg DeleteSavedSearchParams) error {
+	_, err := q.db.Exec(ctx, deleteSavedSearch, arg.ID, arg.UserID)
+	return err
+}
+
+const deleteSavedSearches = `-- name: DeleteSavedSearches :exec
+DELETE FROM saved_searches WHERE user_id = $1
+`
+
+func (q *Queries) DeleteSavedSearches(ctx context.Context, userID string) error {
+	_, err := q.db.Exec(ctx, deleteSavedSearches, userID)
+	return err
+}
+
+const deleteSearchHistory = `-- name: DeleteSearchHistory :exec
+DELETE FROM search_history WHERE user_id = $1
+`
+
+func (q *Queries) DeleteSearchHistory(ctx context.Context, userID string) error {
+	_, err := q.db.Exec(ctx, deleteSearchHistory, userID)
+	return err
+}
+
+const deleteSearchHistoryEntry = `-- name: DeleteSearchHistoryEntry :exec
+DELETE FROM search_history WHERE id = $1 AND user_id = $2
+`
+
+type DeleteSearchHistoryEntryParams struct {
+	ID     int64
+	UserID string
+}
+
+func (q *Queries) DeleteSearchHistoryEntry(ctx context.Context, arg DeleteSearchHistoryEntryParams) error {
+	_, err := q.db.Exec(ctx, deleteSearchHistoryEntry, arg.ID, arg.UserID)
+	return err
+}
+
+const deleteStaleClickDomainStats = `-- name: DeleteStaleClickDomainStats :exec
+DELETE FROM click_domain_stats WHERE updated < $1
+`
+
+func (q *Queries) DeleteStaleClickDomainStats(ctx context.Context, updated time.Time) error {
+	_, err := q.db.Exec(ctx, deleteStaleClickDomainStats, updated)
+	return err
+}
+
+const deleteStaleClickQueryStats = `-- name: DeleteStaleClickQueryStats :exec
+DELETE FROM click_query_stats WHERE updated < $1
+`
+
+func (q *Queries) DeleteStaleClickQueryStats(ctx context.Context, updated time.Time) error {
+	_, err := q.db.Exec(ctx, deleteStaleClickQueryStats, updated)
+	return err
+}
+
+const evictCache = `-- name: EvictCache :execrows
+DELETE FROM cache WHERE key IN (
+    SELECT key FROM (
+        SELECT key, sum(octet_length(data)) OVER (ORDER BY accessed DESC, key) AS total
+        FROM cache
+    ) ranked
+    WHERE total > $1::bigint
+)
+`
+
+// Keeps the most recently accessed rows whose data fits in the budget
+func (q *Queries) EvictCache(ctx context.Context, budget int64) (int64, error) {
+	result, err := q.db.Exec(ctx, evictCache, budget)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const getAPIKeyByHash = `-- name: GetAPIKeyByHash :one
+SELECT id, name, prefix, hash, scope, rate_limit, daily_quota, created, revoked FROM api_keys
+WHERE hash = $1 LIMIT 1
+`
+
+func (q *Queries) GetAPIKeyByHash(ctx context.Context, hash string) (ApiKey, error) {
+	row := q.db.QueryRow(ctx, getAPIKeyByHash, hash)
+	var i ApiKey
+	err := row.Scan(
+		&i.ID,
+		&i.Name,
+		&i.Prefix,
+		&i.Hash,
+		&i.Scope,
+		&i.RateLimit,
+		&i.DailyQuota,
+		&i.Created,
+		&i.Revoked,
+	)
+	return i, err
+}
+
 const getCache = `-- name: GetCache :one
-SELECT data, expires FROM cache
+WITH touched AS (
+    UPDATE cache SET accessed = now()
+    WHERE key = $1 AND accessed < now() - interval '1 hour'
+)
+SELECT namespace, data, expires FROM cache
 WHERE key = $1 LIMIT 1
 `
 
 type GetCacheRow struct {
-	Data    []byte
-	Expires time.Time
+	Namespace string
+	Data      []byte
+	Expires   time.Time
 }
 
 // Cache queries using hstore for key-value data storage
+// accessed is only refreshed hourly to keep reads from turning into writes
 func (q *Queries) GetCache(ctx context.Context, key string) (GetCacheRow, error) {
 	row := q.db.QueryRow(ctx, getCache, key)
 	var i GetCacheRow
-	err := row.Scan(&i.Data, &i.Expires)
+	err := row.Scan(&i.Namespace, &i.Data, &i.Expires)
 	return i, err
 }
 
-const insertCache = `-- name: InsertCache :exec
-INSERT INTO cache (key, data, expires)
+const getClickSalt = `-- name: GetClickSalt :one
+WITH inserted AS (
+    INSERT INTO click_salts (salt)
+    VALUES ($1)
+    ON CONFLICT(day) DO NOTHING
+    RETURNING salt
+)
+SELECT salt FROM inserted
+UNION ALL
+SELECT salt FROM click_salts WHERE day = current_date
+LIMIT 1
+`
+
+func (q *Queries) GetClickSalt(ctx context.Context, salt []byte) ([]byte, error) {
+	row := q.db.QueryRow(ctx, getClickSalt, salt)
+	err := row.Scan(&salt)
+	return salt, err
+}
+
+const getQueryLogSalt = `-- name: GetQueryLogSalt :one
+WITH inserted AS (
+    INSERT INTO query_log_salts (salt)
+    VALUES ($1)
+    ON CONFLICT(day) DO NOTHING
+    RETURNING salt
+)
+SELECT salt FROM inserted
+UNION ALL
+SELECT salt FROM query_log_salts WHERE day = current_date
+LIMIT 1
+`
+
+func (q *Queries) GetQueryLogSalt(ctx context.Context, salt []byte) ([]byte, error) {
+	row := q.db.QueryRow(ctx, getQueryLogSalt, salt)
+	err := row.Scan(&salt)
+	return salt, err
+}
+
+const getSavedSearchByFeedToken = `-- name: GetSavedSearchByFeedToken :one
+SELECT id, user_id, query, created, alert, feed_token, last_run FROM saved_searches
+WHERE feed_token = $1 AND alert LIMIT 1
+`
+
+func (q *Queries) GetSavedSearchByFeedToken(ctx context.Context, feedToken string) (SavedSearch, error) {
+	row := q.db.QueryRow(ctx, getSavedSearchByFeedToken, feedToken)
+	var i SavedSearch
+	err := row.Scan(
+		&i.ID,
+		&i.UserID,
+		&i.Query,
+		&i.Created,
+		&i.Alert,
+		&i.FeedToken,
+		&i.LastRun,
+	)
+	return i, err
+}
+
+const getSetting = `-- name: GetSetting :one
+SELECT value FROM settings
+WHERE key = $1 LIMIT 1
+`
+
+func (q *Queries) GetSetting(ctx context.Context, key string) (string, error) {
+	row := q.db.QueryRow(ctx, getSetting, key)
+	var value string
+	err := row.Scan(&value)
+	return value, err
+}
+
+const incrementAPIKeyUsage = `-- name: IncrementAPIKeyUsage :one
+INSERT INTO api_key_usage (key_id, count)
+VALUES ($1, 1)
+ON CONFLICT(key_id, day) DO UPDATE SET
+    count = api_key_usage.count + 1
+RETURNING count
+`
+
+func (q *Queries) IncrementAPIKeyUsage(ctx context.Context, keyID int64) (int32, error) {
+	row := q.db.QueryRow(ctx, incrementAPIKeyUsage, keyID)
+	var count int32
+	err := row.Scan(&count)
+	return count, err
+}
+
+const incrementLLMUsage = `-- name: IncrementLLMUsage :exec
+INSERT INTO llm_usage (model, requests, prompt_tokens, completion_tokens, cost)
+VALUES ($1, 1, $2, $3, $4)
+ON CONFLICT(day, model) DO UPDATE SET
+    requests = llm_usage.requests + 1,
+    prompt_tokens = llm_usage.prompt_tokens + excluded.prompt_tokens,
+    completion_tokens = llm_usage.completion_tokens + excluded.completion_tokens,
+    cost = llm_usage.cost + excluded.cost
+`
+
+type IncrementLLMUsageParams struct {
+	Model            string
+	PromptTokens     int64
+	CompletionTokens int64
+	Cost             float64
+}
+
+func (q *Queries) IncrementLLMUsage(ctx context.Context, arg IncrementLLMUsageParams) error {
+	_, err := q.db.Exec(ctx, incrementLLMUsage,
+		arg.Model,
+		arg.PromptTokens,
+		arg.CompletionTokens,
+		arg.Cost,
+	)
+	return err
+}
+
+const incrementQueryLog = `-- name: IncrementQueryLog :exec
+WITH client AS (
+    INSERT INTO query_log_clients (query, client)
+    VALUES ($1, $2)
+    ON CONFLICT DO NOTHING
+    RETURNING query
+)
+INSERT INTO query_log (query)
+SELECT query FROM client
+ON CONFLICT(query, day) DO UPDATE SET
+    searches = query_log.searches + 1
+`
+
+type IncrementQueryLogParams struct {
+	Query  string
+	Client []byte
+}
+
+func (q *Queries) IncrementQueryLog(ctx context.Context, arg IncrementQueryLogParams) error {
+	_, err := q.db.Exec(ctx, incrementQueryLog, arg.Query, arg.Client)
+	return err
+}
+
+const incrementRateLimit = `-- name: IncrementRateLimit :exec
+INSERT INTO rate_limits (key, window_start, count)
 VALUES ($1, $2, $3)
+ON CONFLICT(key, window_start) DO UPDATE SET
+    count = rate_limits.count + excluded.count
+`
+
+type IncrementRateLimitParams struct {
+	Key         string
+	WindowStart time.Time
+	Count       int32
+}
+
+func (q *Queries) IncrementRateLimit(ctx context.Context, arg IncrementRateLimitParams) error {
+	_, err := q.db.Exec(ctx, incrementRateLimit, arg.Key, arg.WindowStart, arg.Count)
+	return err
+}
+
+const insertAlertResult = `-- name: InsertAlertResult :execrows
+INSERT INTO alert_results (saved_search_id, url, title, content, baseline, pending)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT(saved_search_id, url) DO NOTHING
+`
+
+type InsertAlertResultParams struct {
+	SavedSearchID int64
+	Url           string
+	Title         string
+	Content       string
+	Baseline      bool
+	Pending       bool
+}
+
+func (q *Queries) InsertAlertResult(ctx context.Context, arg InsertAlertResultParams) (int64, error) {
+	result, err := q.db.Exec(ctx, insertAlertResult,
+		arg.SavedSearchID,
+		arg.Url,
+		arg.Title,
+		arg.Content,
+		arg.Baseline,
+		arg.Pending,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const insertCache = `-- name: InsertCache :exec
+INSERT INTO cache (key, namespace, data, expires)
+VALUES ($1, $2, $3, $4)
 ON CONFLICT(key) DO UPDATE SET
+    namespace = excluded.namespace,
     data = excluded.data,
-    expires = excluded.expires
+    expires = excluded.expires,
+    accessed = now()
 `
 
 type InsertCacheParams struct {
-	Key     string
-	Data    []byte
-	Expires time.Time
+	Key       string
+	Namespace string
+	Data      []byte
+	Expires   time.Time
 }
 
 func (q *Queries) InsertCache(ctx context.Context, arg InsertCacheParams) error {
-	_, err := q.db.Exec(ctx, insertCache, arg.Key, arg.Data, arg.Expires)
+	_, err := q.db.Exec(ctx, insertCache,
+		arg.Key,
+		arg.Namespace,
+		arg.Data,
+		arg.Expires,
+	)
+	return err
+}
+
+const insertClickEvent = `-- name: InsertClickEvent :exec
+INSERT INTO click_events (query_hash, url, domain, position, client)
+VALUES ($1, $2, $3, $4, $5)
+ON CONFLICT(query_hash, url, client) DO NOTHING
+`
+
+type InsertClickEventParams struct {
+	QueryHash string
+	Url       string
+	Domain    string
+	Position  int32
+	Client    []byte
+}
+
+func (q *Queries) InsertClickEvent(ctx context.Context, arg InsertClickEventParams) error {
+	_, err := q.db.Exec(ctx, insertClickEvent,
+		arg.QueryHash,
+		arg.Url,
+		arg.Domain,
+		arg.Position,
+		arg.Client,
+	)
+	return err
+}
+
+const insertDocumentChunks = `-- name: InsertDocumentChunks :exec
+INSERT INTO documents (source, path, chunk, url, title, body, modified)
+SELECT $1::text, $2::text, unnest($3::integer[]), unnest($4::text[]), $5::text, unnest($6::text[]), $7::timestamptz
+`
+
+type InsertDocumentChunksParams struct {
+	Source   string
+	Path     string
+	Chunks   []int32
+	Urls     []string
+	Title    string
+	Bodies   []string
+	Modified time.Time
+}
+
+func (q *Queries) InsertDocumentChunks(ctx context.Context, arg InsertDocumentChunksParams) error {
+	_, err := q.db.Exec(ctx, insertDocumentChunks,
+		arg.Source,
+		arg.Path,
+		arg.Chunks,
+		arg.Urls,
+		arg.Title,
+		arg.Bodies,
+		arg.Modified,
+	)
+	return err
+}
+
+const insertEngineFailure = `-- name: InsertEngineFailure :exec
+INSERT INTO engine_failures (engine, reason)
+VALUES ($1, $2)
+`
+
+type InsertEngineFailureParams struct {
+	Engine string
+	Reason string
+}
+
+func (q *Queries) InsertEngineFailure(ctx context.Context, arg InsertEngineFailureParams) error {
+	_, err := q.db.Exec(ctx, insertEngineFailure, arg.Engine, arg.Reason)
+	return err
+}
+
+const insertHistoryClick = `-- name: InsertHistoryClick :exec
+INSERT INTO history_clicks (user_id, query, url)
+VALUES ($1, $2, $3)
+`
+
+type InsertHistoryClickParams struct {
+	UserID string
+	Query  string
+	Url    string
+}
+
+func (q *Queries) InsertHistoryClick(ctx context.Context, arg InsertHistoryClickParams) error {
+	_, err := q.db.Exec(ctx, insertHistoryClick, arg.UserID, arg.Query, arg.Url)
+	return err
+}
+
+const insertSavedSearch = `-- name: InsertSavedSearch :exec
+INSERT INTO saved_searches (user_id, query)
+VALUES ($1, $2)
+ON CONFLICT(user_id, query) DO NOTHING
+`
+
+type InsertSavedSearchParams struct {
+	UserID string
+	Query  string
+}
+
+func (q *Queries) InsertSavedSearch(ctx context.Context, arg InsertSavedSearchParams) error {
+	_, err := q.db.Exec(ctx, insertSavedSearch, arg.UserID, arg.Query)
+	return err
+}
+
+const insertSearchHistory = `-- name: InsertSearchHistory :exec
+INSERT INTO search_history (user_id, query, source)
+VALUES ($1, $2, $3)
+`
+
+type InsertSearchHistoryParams struct {
+	UserID string
+	Query  string
+	Source string
+}
+
+func (q *Queries) InsertSearchHistory(ctx context.Context, arg InsertSearchHistoryParams) error {
+	_, err := q.db.Exec(ctx, insertSearchHistory, arg.UserID, arg.Query, arg.Source)
+	return err
+}
+
+const listAPIKeys = `-- name: ListAPIKeys :many
+SELECT id, name, prefix, hash, scope, rate_limit, daily_quota, created, revoked FROM api_keys
+ORDER BY id
+`
+
+func (q *Queries) ListAPIKeys(ctx context.Context) ([]ApiKey, error) {
+	rows, err := q.db.Query(ctx, listAPIKeys)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ApiKey
+	for rows.Next() {
+		var i ApiKey
+		if err := rows.Scan(
+			&i.ID,
+			&i.Name,
+			&i.Prefix,
+			&i.Hash,
+			&i.Scope,
+			&i.RateLimit,
+			&i.DailyQuota,
+			&i.Created,
+			&i.Revoked,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listAlertResults = `-- name: ListAlertResults :many
+SELECT saved_search_id, url, title, content, baseline, pending, first_seen FROM alert_results
+WHERE saved_search_id = $1 AND NOT baseline
+ORDER BY first_seen DESC
+LIMIT $2
+`
+
+type ListAlertResultsParams struct {
+	SavedSearchID int64
+	Limit         int32
+}
+
+func (q *Queries) ListAlertResults(ctx context.Context, arg ListAlertResultsParams) ([]AlertResult, error) {
+	rows, err := q.db.Query(ctx, listAlertResults, arg.SavedSearchID, arg.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AlertResult
+	for rows.Next() {
+		var i AlertResult
+		if err := rows.Scan(
+			&i.SavedSearchID,
+			&i.Url,
+			&i.Title,
+			&i.Content,
+			&i.Baseline,
+			&i.Pending,
+			&i.FirstSeen,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listClickDomainStats = `-- name: ListClickDomainStats :many
+SELECT domain, clicks, weight, updated FROM click_domain_stats
+ORDER BY weight DESC
+LIMIT $1
+`
+
+func (q *Queries) ListClickDomainStats(ctx context.Context, limit int32) ([]ClickDomainStat, error) {
+	rows, err := q.db.Query(ctx, listClickDomainStats, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ClickDomainStat
+	for rows.Next() {
+		var i ClickDomainStat
+		if err := rows.Scan(
+			&i.Domain,
+			&i.Clicks,
+			&i.Weight,
+			&i.Updated,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listClickQueryStats = `-- name: ListClickQueryStats :many
+SELECT query_hash, url, clicks, weight, updated FROM click_query_stats
+WHERE query_hash = $1
+`
+
+func (q *Queries) ListClickQueryStats(ctx context.Context, queryHash string) ([]ClickQueryStat, error) {
+	rows, err := q.db.Query(ctx, listClickQueryStats, queryHash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ClickQueryStat
+	for rows.Next() {
+		var i ClickQueryStat
+		if err := rows.Scan(
+			&i.QueryHash,
+			&i.Url,
+			&i.Clicks,
+			&i.Weight,
+			&i.Updated,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDocumentFiles = `-- name: ListDocumentFiles :many
+SELECT path, max(modified)::timestamptz AS modified FROM documents
+WHERE source = $1
+GROUP BY path
+`
+
+type ListDocumentFilesRow struct {
+	Path     string
+	Modified time.Time
+}
+
+func (q *Queries) ListDocumentFiles(ctx context.Context, source string) ([]ListDocumentFilesRow, error) {
+	rows, err := q.db.Query(ctx, listDocumentFiles, source)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListDocumentFilesRow
+	for rows.Next() {
+		var i ListDocumentFilesRow
+		if err := rows.Scan(&i.Path, &i.Modified); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listDomainRules = `-- name: ListDomainRules :many
+SELECT domain, rule, created FROM domain_rules
+ORDER BY domain
+`
+
+func (q *Queries) ListDomainRules(ctx context.Context) ([]DomainRule, error) {
+	rows, err := q.db.Query(ctx, listDomainRules)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []DomainRule
+	for rows.Next() {
+		var i DomainRule
+		if err := rows.Scan(&i.Domain, &i.Rule, &i.Created); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listEngineFailures = `-- name: ListEngineFailures :many
+SELECT engine, reason, created FROM engine_failures
+ORDER BY created DESC
+LIMIT $1
+`
+
+func (q *Queries) ListEngineFailures(ctx context.Context, limit int32) ([]EngineFailure, error) {
+	rows, err := q.db.Query(ctx, listEngineFailures, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []EngineFailure
+	for rows.Next() {
+		var i EngineFailure
+		if err := rows.Scan(&i.Engine, &i.Reason, &i.Created); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listHistoryClicks = `-- name: ListHistoryClicks :many
+SELECT id, user_id, query, url, created FROM history_clicks
+WHERE user_id = $1 AND (query ILIKE '%' || $2::text || '%' OR url ILIKE '%' || $2::text || '%')
+ORDER BY created DESC
+LIMIT $3
+`
+
+type ListHistoryClicksParams struct {
+	UserID  string
+	Filter  string
+	MaxRows int32
+}
+
+func (q *Queries) ListHistoryClicks(ctx context.Context, arg ListHistoryClicksParams) ([]HistoryClick, error) {
+	rows, err := q.db.Query(ctx, listHistoryClicks, arg.UserID, arg.Filter, arg.MaxRows)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []HistoryClick
+	for rows.Next() {
+		var i HistoryClick
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Query,
+			&i.Url,
+			&i.Created,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listLLMUsage = `-- name: ListLLMUsage :many
+SELECT day, model, requests, prompt_tokens, completion_tokens, cost FROM llm_usage
+WHERE day >= $1
+ORDER BY day DESC, model
+`
+
+func (q *Queries) ListLLMUsage(ctx context.Context, day pgtype.Date) ([]LlmUsage, error) {
+	rows, err := q.db.Query(ctx, listLLMUsage, day)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []LlmUsage
+	for rows.Next() {
+		var i LlmUsage
+		if err := rows.Scan(
+			&i.Day,
+			&i.Model,
+			&i.Requests,
+			&i.PromptTokens,
+			&i.CompletionTokens,
+			&i.Cost,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPendingAlertResults = `-- name: ListPendingAlertResults :many
+SELECT url, title, content FROM alert_results
+WHERE saved_search_id = $1 AND pending
+ORDER BY first_seen
+LIMIT 100
+`
+
+type ListPendingAlertResultsRow struct {
+	Url     string
+	Title   string
+	Content string
+}
+
+func (q *Queries) ListPendingAlertResults(ctx context.Context, savedSearchID int64) ([]ListPendingAlertResultsRow, error) {
+	rows, err := q.db.Query(ctx, listPendingAlertResults, savedSearchID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListPendingAlertResultsRow
+	for rows.Next() {
+		var i ListPendingAlertResultsRow
+		if err := rows.Scan(&i.Url, &i.Title, &i.Content); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listPopularQueries = `-- name: ListPopularQueries :many
+SELECT query, sum(searches)::bigint AS searches FROM query_log
+WHERE day >= $1
+GROUP BY query
+HAVING sum(searches) >= $2::bigint
+ORDER BY searches DESC, query
+LIMIT $3
+`
+
+type ListPopularQueriesParams struct {
+	Since       pgtype.Date
+	MinSearches int64
+	MaxRows     int32
+}
+
+type ListPopularQueriesRow struct {
+	Query    string
+	Searches int64
+}
+
+func (q *Queries) ListPopularQueries(ctx context.Context, arg ListPopularQueriesParams) ([]ListPopularQueriesRow, error) {
+	rows, err := q.db.Query(ctx, listPopularQueries, arg.Since, arg.MinSearches, arg.MaxRows)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []ListPopularQueriesRow
+	for rows.Next() {
+		var i ListPopularQueriesRow
+		if err := rows.Scan(&i.Query, &i.Searches); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listSavedSearches = `-- name: ListSavedSearches :many
+SELECT id, user_id, query, created, alert, feed_token, last_run FROM saved_searches
+WHERE user_id = $1
+ORDER BY created DESC
+`
+
+func (q *Queries) ListSavedSearches(ctx context.Context, userID string) ([]SavedSearch, error) {
+	rows, err := q.db.Query(ctx, listSavedSearches, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SavedSearch
+	for rows.Next() {
+		var i SavedSearch
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Query,
+			&i.Created,
+			&i.Alert,
+			&i.FeedToken,
+			&i.LastRun,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const listSearchHistory = `-- name: ListSearchHistory :many
+SELECT id, user_id, query, source, created FROM search_history
+WHERE user_id = $1 AND query ILIKE '%' || $2::text || '%'
+ORDER BY created DESC
+LIMIT $3
+`
+
+type ListSearchHistoryParams struct {
+	UserID  string
+	Filter  string
+	MaxRows int32
+}
+
+func (q *Queries) ListSearchHistory(ctx context.Context, arg ListSearchHistoryParams) ([]SearchHistory, error) {
+	rows, err := q.db.Query(ctx, listSearchHistory, arg.UserID, arg.Filter, arg.MaxRows)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchHistory
+	for rows.Next() {
+		var i SearchHistory
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.Query,
+			&i.Source,
+			&i.Created,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const purgeCacheMatching = `-- name: PurgeCacheMatching :execrows
+DELETE FROM cache
+WHERE namespace = $1 AND key ~ $2::text
+`
+
+type PurgeCacheMatchingParams struct {
+	Namespace string
+	Pattern   string
+}
+
+func (q *Queries) PurgeCacheMatching(ctx context.Context, arg PurgeCacheMatchingParams) (int64, error) {
+	result, err := q.db.Exec(ctx, purgeCacheMatching, arg.Namespace, arg.Pattern)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const purgeCacheNamespace = `-- name: PurgeCacheNamespace :execrows
+DELETE FROM cache WHERE namespace = $1
+`
+
+func (q *Queries) PurgeCacheNamespace(ctx context.Context, namespace string) (int64, error) {
+	result, err := q.db.Exec(ctx, purgeCacheNamespace, namespace)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const refreshClickDomainStats = `-- name: RefreshClickDomainStats :exec
+INSERT INTO click_domain_stats (domain, clicks, weight, updated)
+SELECT domain, count(*), sum(ln(position + 2) / ln(2)), now()
+FROM click_events
+WHERE created > $1
+GROUP BY domain
+HAVING count(*) >= $2::bigint
+ON CONFLICT(domain) DO UPDATE SET
+    clicks = excluded.clicks,
+    weight = excluded.weight,
+    updated = excluded.updated
+`
+
+type RefreshClickDomainStatsParams struct {
+	Since     time.Time
+	MinClicks int64
+}
+
+func (q *Queries) RefreshClickDomainStats(ctx context.Context, arg RefreshClickDomainStatsParams) error {
+	_, err := q.db.Exec(ctx, refreshClickDomainStats, arg.Since, arg.MinClicks)
+	return err
+}
+
+const refreshClickQueryStats = `-- name: RefreshClickQueryStats :exec
+INSERT INTO click_query_stats (query_hash, url, clicks, weight, updated)
+SELECT query_hash, url, count(*), sum(ln(position + 2) / ln(2)), now()
+FROM click_events
+WHERE created > $1
+GROUP BY query_hash, url
+HAVING count(*) >= $2::bigint
+ON CONFLICT(query_hash, url) DO UPDATE SET
+    clicks = excluded.clicks,
+    weight = excluded.weight,
+    updated = excluded.updated
+`
+
+type RefreshClickQueryStatsParams struct {
+	Since     time.Time
+	MinClicks int64
+}
+
+func (q *Queries) RefreshClickQueryStats(ctx context.Context, arg RefreshClickQueryStatsParams) error {
+	_, err := q.db.Exec(ctx, refreshClickQueryStats, arg.Since, arg.MinClicks)
 	return err
 }
+
+const revokeAPIKey = `-- name: RevokeAPIKey :execrows
+UPDATE api_keys SET revoked = now()
+WHERE id = $1 AND revoked IS NULL
+`
+
+func (q *Queries) RevokeAPIKey(ctx context.Context, id int64) (int64, error) {
+	result, err := q.db.Exec(ctx, revokeAPIKey, id)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const searchDocuments = `-- name: SearchDocuments :many
+SELECT url, title,
+    ts_headline('english', body, q, 'MaxFragments=2, MinWords=10, MaxWords=25, StartSel="", StopSel=""')::text AS snippet,
+    modified, ts_rank_cd(search, q) AS rank
+FROM documents, websearch_to_tsquery('english', $1) q
+WHERE search @@ q AND ($2::text = '' OR source = $2)
+ORDER BY rank DESC
+LIMIT $3
+`
+
+type SearchDocumentsParams struct {
+	Query   string
+	Source  string
+	MaxRows int32
+}
+
+type SearchDocumentsRow struct {
+	Url      string
+	Title    string
+	Snippet  string
+	Modified time.Time
+	Rank     float32
+}
+
+func (q *Queries) SearchDocuments(ctx context.Context, arg SearchDocumentsParams) ([]SearchDocumentsRow, error) {
+	rows, err := q.db.Query(ctx, searchDocuments, arg.Query, arg.Source, arg.MaxRows)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []SearchDocumentsRow
+	for rows.Next() {
+		var i SearchDocumentsRow
+		if err := rows.Scan(
+			&i.Url,
+			&i.Title,
+			&i.Snippet,
+			&i.Modified,
+			&i.Rank,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const setAlertLastRun = `-- name: SetAlertLastRun :exec
+UPDATE saved_searches SET last_run = $2
+WHERE id = $1
+`
+
+type SetAlertLastRunParams struct {
+	ID      int64
+	LastRun *time.Time
+}
+
+func (q *Queries) SetAlertLastRun(ctx context.Context, arg SetAlertLastRunParams) error {
+	_, err := q.db.Exec(ctx, setAlertLastRun, arg.ID, arg.LastRun)
+	return err
+}
+
+const setAlertResultsSent = `-- name: SetAlertResultsSent :exec
+UPDATE alert_results SET pending = false
+WHERE saved_search_id = $1 AND url = ANY($2::text[])
+`
+
+type SetAlertResultsSentParams struct {
+	SavedSearchID int64
+	Urls          []string
+}
+
+func (q *Queries) SetAlertResultsSent(ctx context.Context, arg SetAlertResultsSentParams) error {
+	_, err := q.db.Exec(ctx, setAlertResultsSent, arg.SavedSearchID, arg.Urls)
+	return err
+}
+
+const setDomainRule = `-- name: SetDomainRule :exec
+INSERT INTO domain_rules (domain, rule)
+VALUES ($1, $2)
+ON CONFLICT(domain) DO UPDATE SET
+    rule = excluded.rule
+`
+
+type SetDomainRuleParams struct {
+	Domain string
+	Rule   string
+}
+
+func (q *Queries) SetDomainRule(ctx context.Context, arg SetDomainRuleParams) error {
+	_, err := q.db.Exec(ctx, setDomainRule, arg.Domain, arg.Rule)
+	return err
+}
+
+const setSavedSearchAlert = `-- name: SetSavedSearchAlert :execrows
+UPDATE saved_searches SET alert = $3
+WHERE id = $1 AND user_id = $2
+`
+
+type SetSavedSearchAlertParams struct {
+	ID     int64
+	UserID string
+	Alert  bool
+}
+
+func (q *Queries) SetSavedSearchAlert(ctx context.Context, arg SetSavedSearchAlertParams) (int64, error) {
+	result, err := q.db.Exec(ctx, setSavedSearchAlert, arg.ID, arg.UserID, arg.Alert)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const setSetting = `-- name: SetSetting :exec
+INSERT INTO settings (key, value)
+VALUES ($1, $2)
+ON CONFLICT(key) DO UPDATE SET
+    value = excluded.value,
+    updated = now()
+`
+
+type SetSettingParams struct {
+	Key   string
+	Value string
+}
+
+func (q *Queries) SetSetting(ctx context.Context, arg SetSettingParams) error {
+	_, err := q.db.Exec(ctx, setSetting, arg.Key, arg.Value)
+	return err
+}
+
+const takeRateLimit = `-- name: TakeRateLimit :one
+WITH taken AS (
+    INSERT INTO rate_limits (key, window_start, count)
+    VALUES ($1, $2::timestamptz, 1)
+    ON CONFLICT(key, window_start) DO UPDATE SET
+        count = rate_limits.count + 1
+    RETURNING count
+)
+SELECT
+    (SELECT count FROM taken)::integer AS current_count,
+    COALESCE((
+        SELECT count FROM rate_limits
+        WHERE key = $1 AND window_start = $3::timestamptz
+    ), 0)::integer AS previous_count
+`
+
+type TakeRateLimitParams struct {
+	Key            string
+	CurrentWindow  time.Time
+	PreviousWindow time.Time
+}
+
+type TakeRateLimitRow struct {
+	CurrentCount  int32
+	PreviousCount int32
+}
+
+// Counts a request and returns the counts of the current window, including
+// it, and of the previous window. Concurrent replicas are serialized by the
+// row lock of the upsert, so each sees the requests taken before its own.
+func (q *Queries) TakeRateLimit(ctx context.Context, arg TakeRateLimitParams) (TakeRateLimitRow, error) {
+	row := q.db.QueryRow(ctx, takeRateLimit, arg.Key, arg.CurrentWindow, arg.PreviousWindow)
+	var i TakeRateLimitRow
+	err := row.Scan(&i.CurrentCount, &i.PreviousCount)
+	return i, err
+}
@@ -0,0 +1,153 @@
+// Package domainrules lets operators block, boost or lower result domains.
+// Rules apply to the domain and all of its subdomains.
+package domainrules
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"net"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/AletisSearch/aletis/internal/db"
+	"github.com/AletisSearch/aletis/internal/searxng"
+	"github.com/go-playground/validator/v10"
+)
+
+const (
+	RuleBlock = "block"
+	RuleHigh  = "high"
+	RuleLow   = "low"
+)
+
+var (
+	ErrInvalidRule   = errors.New("rule must be block, high or low")
+	ErrInvalidDomain = errors.New("invalid domain")
+	ErrRuleNotFound  = errors.New("domain rule not found")
+)
+
+var validate = validator.New(validator.WithRequiredStructEnabled())
+
+type Rules struct {
+	q     *db.Queries
+	mu    sync.RWMutex
+	rules map[string]string
+}
+
+func New(q *db.Queries) *Rules {
+	return &Rules{q: q, rules: map[string]string{}}
+}
+
+// Refresh reloads the rules from the database.
+func (r *Rules) Refresh(ctx context.Context) error {
+	list, err := r.q.ListDomainRules(ctx)
+	if err != nil {
+		return err
+	}
+	rules := make(map[string]string, len(list))
+	for _, l := range list {
+		rules[l.Domain] = l.Rule
+	}
+	r.mu.Lock()
+	r.rules = rules
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *Rules) List(ctx context.Context) ([]db.DomainRule, error) {
+	return r.q.ListDomainRules(ctx)
+}
+
+func (r *Rules) Set(ctx context.Context, domain, rule string) error {
+	domain = normalize(domain)
+	if err := validate.Var(domain, "required,fqdn"); err != nil {
+		return ErrInvalidDomain
+	}
+	switch rule {
+	case RuleBlock, RuleHigh, RuleLow:
+	default:
+		return ErrInvalidRule
+	}
+	if err := r.q.SetDomainRule(ctx, db.SetDomainRuleParams{Domain: domain, Rule: rule}); err != nil {
+		return err
+	}
+	return r.Refresh(ctx)
+}
+
+func (r *Rules) Delete(ctx context.Context, domain string) error {
+	n, err := r.q.DeleteDomainRule(ctx, normalize(domain))
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrRuleNotFound
+	}
+	return r.Refresh(ctx)
+}
+
+func normalize(domain string) string {
+	return strings.TrimPrefix(strings.ToLower(strings.TrimSpace(domain)), "www.")
+}
+
+// match returns the rule of host or of its closest parent domain.
+func (r *Rules) match(host string) (string, bool) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = normalize(host)
+	for {
+		if rule, ok := r.rules[host]; ok {
+			return rule, true
+		}
+		_, parent, ok := strings.Cut(host, ".")
+		if !ok {
+			return "", false
+		}
+		host = parent
+	}
+}
+
+// Apply returns sr with blocked results removed and boosted or lowered ones
+// re-ranked. sr may be shared through the cache so it is never modified; a
+// copy is returned when a rule matched.
+func (r *Rules) Apply(sr *searxng.SearchResponse) *searxng.SearchResponse {
+	if r == nil || sr == nil {
+		return sr
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if len(r.rules) == 0 {
+		return sr
+	}
+
+	results := make([]searxng.Result, 0, len(sr.Results))
+	changed := false
+	for _, res := range sr.Results {
+		rule, ok := r.match(res.ParsedURL[1])
+		if !ok {
+			results = append(results, res)
+			continue
+		}
+		changed = true
+		switch rule {
+		case RuleHigh:
+			res.Score *= 2
+		case RuleLow:
+			res.Score /= 2
+		case RuleBlock:
+			continue
+		}
+		results = append(results, res)
+	}
+	if !changed {
+		return sr
+	}
+	slices.SortStableFunc(results, func(i, j searxng.Result) int {
+		return cmp.Compare(j.Score, i.Score)
+	})
+	out := *sr
+	out.Results = results
+	return &out
+}
@@ -0,0 +1,291 @@
+// Package egress builds the HTTP clients used for outbound requests. Hosts
+// named by search results must never be able to reach the internal network,
+// so clients resolve names themselves and refuse private addresses before
+// connecting.
+package egress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+var (
+	ErrPrivateAddress   = errors.New("address is not public")
+	ErrHostDenied       = errors.New("host denied by egress policy")
+	ErrBadURL           = errors.New("only http and https urls can be fetched")
+	ErrTooManyRedirects = errors.New("too many redirects")
+	ErrResponseTooLarge = errors.New("response too large")
+)
+
+// reserved are ranges that aren't covered by the netip helpers but must not
+// be reachable either.
+var reserved = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+	// NAT64 can embed any IPv4 address
+	netip.MustParsePrefix("64:ff9b::/96"),
+}
+
+// IsPublic reports whether ip is reachable on the public internet. Cloud
+// metadata endpoints are link-local or carrier-grade NAT addresses and are
+// not public.
+func IsPublic(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() ||
+		ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, p := range reserved {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// Resolver looks up the addresses of a host. *net.Resolver implements it.
+type Resolver interface {
+	LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error)
+}
+
+// Factory creates HTTP clients sharing one egress policy.
+type Factory struct {
+	allow    []string
+	deny     []string
+	resolver Resolver
+}
+
+type Option func(*Factory)
+
+// WithAllowHosts restricts requests to the hosts and their subdomains.
+func WithAllowHosts(hosts ...string) Option {
+	return func(f *Factory) {
+		f.allow = normalizeHosts(hosts)
+	}
+}
+
+// WithDenyHosts refuses requests to the hosts and their subdomains.
+func WithDenyHosts(hosts ...string) Option {
+	return func(f *Factory) {
+		f.deny = normalizeHosts(hosts)
+	}
+}
+
+func WithResolver(r Resolver) Option {
+	return func(f *Factory) {
+		f.resolver = r
+	}
+}
+
+func New(opts ...Option) *Factory {
+	f := &Factory{resolver: net.DefaultResolver}
+	for _, o := range opts {
+		o(f)
+	}
+	return f
+}
+
+func normalizeHosts(hosts []string) []string {
+	var out []string
+	for _, h := range hosts {
+		if h = strings.Trim(strings.ToLower(strings.TrimSpace(h)), "."); h != "" {
+			out = append(out, h)
+		}
+	}
+	return out
+}
+
+func matchHost(host string, patterns []string) bool {
+	for _, p := range patterns {
+		if host == p || strings.HasSuffix(host, "."+p) {
+			return true
+		}
+	}
+	return false
+}
+
+// checkHost applies the allow and deny lists.
+func (f *Factory) checkHost(host string) error {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if matchHost(host, f.deny) {
+		return fmt.Errorf("%w: %s", ErrHostDenied, host)
+	}
+	if len(f.allow) > 0 && !matchHost(host, f.allow) {
+		return fmt.Errorf("%w: %s", ErrHostDenied, host)
+	}
+	return nil
+}
+
+type clientOptions struct {
+	timeout      time.Duration
+	maxRedirects int
+	maxBodyBytes int64
+	trusted      bool
+}
+
+type ClientOption func(*clientOptions)
+
+// WithTimeout bounds the whole request including reading the body.
+func WithTimeout(d time.Duration) ClientOption {
+	return func(o *clientOptions) {
+		o.timeout = d
+	}
+}
+
+func WithMaxRedirects(n int) ClientOption {
+	return func(o *clientOptions) {
+		o.maxRedirects = n
+	}
+}
+
+// WithMaxBodyBytes fails reads of response bodies past n bytes.
+func WithMaxBodyBytes(n int64) ClientOption {
+	return func(o *clientOptions) {
+		o.maxBodyBytes = n
+	}
+}
+
+// WithTrusted is for hosts set by the operator, such as SearXNG, which often
+// live on the internal network. The host lists and address checks are
+// skipped while the limits still apply.
+func WithTrusted() ClientOption {
+	return func(o *clientOptions) {
+		o.trusted = true
+	}
+}
+
+// Client returns an HTTP client enforcing the policy of the factory.
+func (f *Factory) Client(opts ...ClientOption) *http.Client {
+	o := clientOptions{
+		timeout:      time.Second * 10,
+		maxRedirects: 3,
+		maxBodyBytes: 5 << 20,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	dialer := &net.Dialer{Timeout: time.Second * 5}
+	transport := &http.Transport{
+		// An environment proxy would be dialed instead of the target
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		TLSHandshakeTimeout:   time.Second * 5,
+		ResponseHeaderTimeout: time.Second * 5,
+		MaxIdleConnsPerHost:   2,
+		IdleConnTimeout:       time.Minute,
+	}
+	if !o.trusted {
+		transport.DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			return f.dial(ctx, dialer, network, addr)
+		}
+	}
+
+	return &http.Client{
+		Timeout: o.timeout,
+		Transport: &policyTransport{
+			next:         transport,
+			factory:      f,
+			maxBodyBytes: o.maxBodyBytes,
+			trusted:      o.trusted,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > o.maxRedirects {
+				return ErrTooManyRedirects
+			}
+			return nil
+		},
+	}
+}
+
+// dial resolves the host itself and connects to the first public address,
+// so that the address checked is the one connected to.
+func (f *Factory) dial(ctx context.Context, dialer *net.Dialer, network, addr string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	var ips []netip.Addr
+	if ip, err := netip.ParseAddr(host); err == nil {
+		ips = []netip.Addr{ip}
+	} else if ips, err = f.resolver.LookupNetIP(ctx, "ip", host); err != nil {
+		return nil, err
+	}
+	var errs []error
+	for _, ip := range ips {
+		if !IsPublic(ip) {
+			errs = append(errs, fmt.Errorf("%w: %s resolved to %s", ErrPrivateAddress, host, ip))
+			continue
+		}
+		conn, err := dialer.DialContext(ctx, network, net.JoinHostPort(ip.Unmap().String(), port))
+		if err == nil {
+			return conn, nil
+		}
+		errs = append(errs, err)
+	}
+	if len(errs) == 0 {
+		return nil, fmt.Errorf("no addresses found for %s", host)
+	}
+	return nil, errors.Join(errs...)
+}
+
+// policyTransport checks every request, redirects included, against the
+// policy and limits the size of responses.
+type policyTransport struct {
+	next         http.RoundTripper
+	factory      *Factory
+	maxBodyBytes int64
+	trusted      bool
+}
+
+func (t *policyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+		return nil, ErrBadURL
+	}
+	if !t.trusted {
+		if err := t.factory.checkHost(req.URL.Hostname()); err != nil {
+			return nil, err
+		}
+	}
+	res, err := t.next.RoundTrip(req)
+	if err != nil || t.maxBodyBytes <= 0 {
+		return res, err
+	}
+	if res.ContentLength > t.maxBodyBytes {
+		res.Body.Close()
+		return nil, fmt.Errorf("%w: %d bytes", ErrResponseTooLarge, res.ContentLength)
+	}
+	res.Body = &limitedBody{ReadCloser: res.Body, remaining: t.maxBodyBytes}
+	return res, nil
+}
+
+type limitedBody struct {
+	io.ReadCloser
+	remaining int64
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	// Read one byte past the limit to tell a body of exactly the limit
+	// from a larger one
+	if int64(len(p)) > b.remaining+1 {
+		p = p[:b.remaining+1]
+	}
+	n, err := b.ReadCloser.Read(p)
+	b.remaining -= int64(n)
+	if b.remaining < 0 {
+		return n, ErrResponseTooLarge
+	}
+	return n, err
+}
@@ -0,0 +1,223 @@
+package egress
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// staticResolver answers with fixed addresses and counts lookups.
+type staticResolver struct {
+	addrs   map[string][]netip.Addr
+	lookups atomic.Int32
+}
+
+func (r *staticResolver) LookupNetIP(ctx context.Context, network, host string) ([]netip.Addr, error) {
+	r.lookups.Add(1)
+	addrs, ok := r.addrs[host]
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host", Name: host, IsNotFound: true}
+	}
+	return addrs, nil
+}
+
+func addrs(s ...string) []netip.Addr {
+	var out []netip.Addr
+	for _, a := range s {
+		out = append(out, netip.MustParseAddr(a))
+	}
+	return out
+}
+
+// newServer returns a server on loopback and a counter of the requests
+// that reached it.
+func newServer(t *testing.T, h http.HandlerFunc) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		h(w, r)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, &hits
+}
+
+func get(c *http.Client, url string) error {
+	res, err := c.Get(url)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, err = io.ReadAll(res.Body)
+	return err
+}
+
+func TestIsPublic(t *testing.T) {
+	for _, tt := range []struct {
+		addr   string
+		public bool
+	}{
+		{"93.184.215.14", true},
+		{"2606:2800:21f:cb07:6820:80da:af6b:8b2c", true},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.100.100.200", false},
+		{"0.0.0.0", false},
+		{"::1", false},
+		{"fd00:ec2::254", false},
+		{"fe80::1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+		{"64:ff9b::a9fe:a9fe", false},
+	} {
+		if got := IsPublic(netip.MustParseAddr(tt.addr)); got != tt.public {
+			t.Errorf("IsPublic(%s) = %v, want %v", tt.addr, got, tt.public)
+		}
+	}
+}
+
+func TestRefusesPrivateAddresses(t *testing.T) {
+	srv, hits := newServer(t, func(w http.ResponseWriter, r *http.Request) {})
+	_, port, _ := net.SplitHostPort(srv.Listener.Addr().String())
+	resolver := &staticResolver{addrs: map[string][]netip.Addr{
+		"loopback.test": addrs("127.0.0.1"),
+		"private.test":  addrs("10.0.0.7", "192.168.0.7"),
+		"metadata.test": addrs("169.254.169.254"),
+		"mapped.test":   addrs("::ffff:127.0.0.1"),
+		"ipv6.test":     addrs("::1"),
+	}}
+	c := New(WithResolver(resolver)).Client()
+
+	for _, host := range []string{
+		"loopback.test",
+		"private.test",
+		"metadata.test",
+		"mapped.test",
+		"ipv6.test",
+		"127.0.0.1",
+		"169.254.169.254",
+		"[::1]",
+	} {
+		url := fmt.Sprintf("http://%s:%s/latest/meta-data/", host, port)
+		if err := get(c, url); !errors.Is(err, ErrPrivateAddress) {
+			t.Errorf("GET %s = %v, want ErrPrivateAddress", url, err)
+		}
+	}
+	if n := hits.Load(); n != 0 {
+		t.Errorf("server got %d requests, want 0", n)
+	}
+	if n := resolver.lookups.Load(); n != 5 {
+		t.Errorf("resolver got %d lookups, want 5", n)
+	}
+
+	// Trusted clients reach the internal network
+	if err := get(New(WithResolver(resolver)).Client(WithTrusted()), srv.URL); err != nil {
+		t.Errorf("trusted GET %s = %v", srv.URL, err)
+	}
+}
+
+func TestRefusesRedirectToPrivateAddress(t *testing.T) {
+	resolver := &staticResolver{addrs: map[string][]netip.Addr{
+		"metadata.test": addrs("169.254.169.254"),
+	}}
+	f := New(WithResolver(resolver))
+	redirect := httptest.NewServer(http.RedirectHandler("http://metadata.test/latest/meta-data/", http.StatusFound))
+	t.Cleanup(redirect.Close)
+	// The redirecting server listens on loopback so it is dialed directly,
+	// the redirect target still goes through the policy
+	c := f.Client()
+	c.Transport.(*policyTransport).next.(*http.Transport).DialContext = func(ctx context.Context, network, addr string) (net.Conn, error) {
+		if addr == redirect.Listener.Addr().String() {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		}
+		return f.dial(ctx, &net.Dialer{}, network, addr)
+	}
+
+	if err := get(c, redirect.URL); !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("GET redirecting to metadata = %v, want ErrPrivateAddress", err)
+	}
+	if n := resolver.lookups.Load(); n != 1 {
+		t.Errorf("resolver got %d lookups, want 1", n)
+	}
+}
+
+func TestHostPolicy(t *testing.T) {
+	resolver := &staticResolver{}
+	f := New(
+		WithResolver(resolver),
+		WithAllowHosts("Example.org", "cdn.test."),
+		WithDenyHosts("private.example.org"),
+	)
+	c := f.Client()
+	for _, url := range []string{
+		"http://private.example.org/",
+		"http://a.private.example.org/",
+		"http://example.com/",
+		"http://notexample.org/",
+	} {
+		if err := get(c, url); !errors.Is(err, ErrHostDenied) {
+			t.Errorf("GET %s = %v, want ErrHostDenied", url, err)
+		}
+	}
+	// Denied hosts aren't even resolved
+	if n := resolver.lookups.Load(); n != 0 {
+		t.Errorf("resolver got %d lookups, want 0", n)
+	}
+	for _, url := range []string{"http://example.org/", "http://img.cdn.test/"} {
+		if err := get(c, url); errors.Is(err, ErrHostDenied) {
+			t.Errorf("GET %s = %v, want it allowed", url, err)
+		}
+	}
+}
+
+func TestRefusesOtherSchemes(t *testing.T) {
+	c := New().Client()
+	for _, url := range []string{"file:///etc/passwd", "ftp://example.org/"} {
+		req, _ := http.NewRequest("GET", url, nil)
+		if _, err := c.Transport.RoundTrip(req); !errors.Is(err, ErrBadURL) {
+			t.Errorf("GET %s = %v, want ErrBadURL", url, err)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	body := strings.Repeat("a", 1024)
+	srv, _ := newServer(t, func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/chunked":
+			// Without a length the limit is only noticed while reading
+			w.Write([]byte(body[:512]))
+			w.(http.Flusher).Flush()
+			w.Write([]byte(body[512:]))
+		case "/loop":
+			http.Redirect(w, r, "/loop", http.StatusFound)
+		default:
+			fmt.Fprint(w, body)
+		}
+	})
+	f := New()
+
+	if err := get(f.Client(WithTrusted(), WithMaxBodyBytes(1024)), srv.URL); err != nil {
+		t.Errorf("GET of exactly the limit = %v", err)
+	}
+	small := f.Client(WithTrusted(), WithMaxBodyBytes(1023))
+	for _, path := range []string{"/", "/chunked"} {
+		if err := get(small, srv.URL+path); !errors.Is(err, ErrResponseTooLarge) {
+			t.Errorf("GET %s past the limit = %v, want ErrResponseTooLarge", path, err)
+		}
+	}
+	if err := get(f.Client(WithTrusted(), WithMaxRedirects(2)), srv.URL+"/loop"); !errors.Is(err, ErrTooManyRedirects) {
+		t.Errorf("GET of a redirect loop = %v, want ErrTooManyRedirects", err)
+	}
+}
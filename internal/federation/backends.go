@@ -0,0 +1,209 @@
+package federation
+
+import (
+	"context"
+	"encoding/json/v2"
+	"errors"
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AletisSearch/aletis/internal/apikey"
+	"github.com/AletisSearch/aletis/internal/db"
+	"github.com/AletisSearch/aletis/internal/searxng"
+)
+
+var ErrBadStatus = errors.New("bad response status")
+
+// result builds a result of a backend, with the parsed URL that favicons and
+// domain rules look at.
+func result(name, link, title, content string, score float64) searxng.Result {
+	r := searxng.Result{
+		URL:      link,
+		Engine:   name,
+		Engines:  []string{name},
+		Title:    title,
+		Content:  content,
+		Score:    score,
+		Category: "general",
+	}
+	if u, err := url.Parse(link); err == nil {
+		r.ParsedURL = [6]string{u.Scheme, u.Host, u.EscapedPath(), "", u.RawQuery, u.Fragment}
+	}
+	return r
+}
+
+func getJSON(ctx context.Context, client *http.Client, u string, header http.Header, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return err
+	}
+	for k, vs := range header {
+		req.Header[k] = vs
+	}
+	req.Header.Set("Accept", "application/json")
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 400 {
+		return fmt.Errorf("%w: %d", ErrBadStatus, res.StatusCode)
+	}
+	return json.UnmarshalRead(res.Body, v)
+}
+
+// Aletis searches another Aletis instance through its JSON Feed.
+type Aletis struct {
+	name   string
+	base   *url.URL
+	key    string
+	client *http.Client
+}
+
+// NewAletis creates a backend for the instance at base. An API key for the
+// instance is taken from the user info of base, as in
+// https://KEY@search.example.com.
+func NewAletis(name, base string, client *http.Client) (*Aletis, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	a := &Aletis{name: name, client: client}
+	if u.User != nil {
+		a.key = u.User.Username()
+		u.User = nil
+	}
+	a.base = u
+	return a, nil
+}
+
+type jsonFeed struct {
+	Items []struct {
+		URL           string `json:"url"`
+		Title         string `json:"title"`
+		ContentText   string `json:"content_text"`
+		DatePublished string `json:"date_published"`
+	} `json:"items"`
+}
+
+func (a *Aletis) Search(ctx context.Context, query string) ([]searxng.Result, error) {
+	u := a.base.JoinPath("search")
+	u.RawQuery = url.Values{"format": {"jsonfeed"}, "q": {query}}.Encode()
+	header := http.Header{}
+	if a.key != "" {
+		header.Set(apikey.Header, a.key)
+	}
+	var f jsonFeed
+	if err := getJSON(ctx, a.client, u.String(), header, &f); err != nil {
+		return nil, err
+	}
+	out := make([]searxng.Result, 0, min(len(f.Items), maxResults))
+	for _, i := range f.Items[:min(len(f.Items), maxResults)] {
+		r := result(a.name, i.URL, i.Title, i.ContentText, 0)
+		if t, err := time.Parse(time.RFC3339, i.DatePublished); err == nil {
+			r.PublishedDate = &searxng.Time{Time: t}
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// MediaWiki searches a wiki through its action API.
+type MediaWiki struct {
+	name   string
+	api    *url.URL
+	client *http.Client
+}
+
+// NewMediaWiki creates a backend for the wiki whose api.php is at api.
+func NewMediaWiki(name, api string, client *http.Client) (*MediaWiki, error) {
+	u, err := url.Parse(api)
+	if err != nil {
+		return nil, err
+	}
+	return &MediaWiki{name: name, api: u, client: client}, nil
+}
+
+type mediaWikiSearch struct {
+	Query struct {
+		Search []struct {
+			PageID    int64  `json:"pageid"`
+			Title     string `json:"title"`
+			Snippet   string `json:"snippet"`
+			Timestamp string `json:"timestamp"`
+		} `json:"search"`
+	} `json:"query"`
+}
+
+var tags = regexp.MustCompile(`<[^>]*>`)
+
+func (m *MediaWiki) Search(ctx context.Context, query string) ([]searxng.Result, error) {
+	u := *m.api
+	u.RawQuery = url.Values{
+		"action":        {"query"},
+		"list":          {"search"},
+		"srsearch":      {query},
+		"srlimit":       {strconv.Itoa(maxResults)},
+		"srprop":        {"snippet|timestamp"},
+		"format":        {"json"},
+		"formatversion": {"2"},
+	}.Encode()
+	var s mediaWikiSearch
+	if err := getJSON(ctx, m.client, u.String(), nil, &s); err != nil {
+		return nil, err
+	}
+	// Pages are linked by id next to api.php, which works whatever the
+	// article path of the wiki is
+	page := *m.api
+	page.Path = path.Join(path.Dir(m.api.Path), "index.php")
+	out := make([]searxng.Result, 0, len(s.Query.Search))
+	for _, p := range s.Query.Search {
+		page.RawQuery = "curid=" + strconv.FormatInt(p.PageID, 10)
+		// Snippets mark the matches with spans
+		snippet := html.UnescapeString(tags.ReplaceAllString(p.Snippet, ""))
+		r := result(m.name, page.String(), p.Title, strings.Join(strings.Fields(snippet), " "), 0)
+		if t, err := time.Parse(time.RFC3339, p.Timestamp); err == nil {
+			r.PublishedDate = &searxng.Time{Time: t}
+		}
+		out = append(out, r)
+	}
+	return out, nil
+}
+
+// Postgres searches the documents table with full-text search.
+type Postgres struct {
+	name   string
+	source string
+	q      *db.Queries
+}
+
+// NewPostgres creates a backend for the documents of source, or for all
+// documents when source is empty.
+func NewPostgres(name, source string, q *db.Queries) *Postgres {
+	return &Postgres{name: name, source: source, q: q}
+}
+
+func (p *Postgres) Search(ctx context.Context, query string) ([]searxng.Result, error) {
+	rows, err := p.q.SearchDocuments(ctx, db.SearchDocumentsParams{
+		Query:   query,
+		Source:  p.source,
+		MaxRows: maxResults,
+	})
+	if err != nil {
+		return nil, err
+	}
+	out := make([]searxng.Result, 0, len(rows))
+	for _, row := range rows {
+		r := result(p.name, row.Url, row.Title, row.Snippet, float64(row.Rank))
+		r.PublishedDate = &searxng.Time{Time: row.Modified}
+		out = append(out, r)
+	}
+	return out, nil
+}
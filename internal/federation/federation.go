@@ -0,0 +1,198 @@
+// Package federation searches other backends alongside SearXNG, such as an
+// internal wiki, a Postgres full-text corpus and other Aletis instances, and
+// merges their results into one list. Every backend has its own timeout;
+// backends that fail or run out of time are left out and reported like
+// unresponsive SearXNG engines, so a slow backend never holds up the page.
+package federation
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/AletisSearch/aletis/internal/searxng"
+	"github.com/AletisSearch/aletis/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+const (
+	// WebOrigin labels the results found through SearXNG.
+	WebOrigin = "web"
+	// rrfK damps the difference between the first ranks of a list, so that
+	// a result found by several backends beats one ranked first by a single
+	// backend.
+	rrfK = 60
+	// scoreWeight is how much the normalized score of a result counts next
+	// to its rank. Ranks alone can't tell a close second from a distant one.
+	scoreWeight = 0.5
+	// maxResults bounds the results asked from each backend.
+	maxResults = 20
+)
+
+// Backend is a source of results other than SearXNG.
+type Backend interface {
+	// Search returns the results for query, best first. Scores are only
+	// compared between results of the same backend and may all be zero.
+	Search(ctx context.Context, query string) ([]searxng.Result, error)
+}
+
+// Source is a backend with the name its results are labelled with.
+type Source struct {
+	Name    string
+	Backend Backend
+	Timeout time.Duration
+}
+
+// Federation merges the results of SearXNG and the sources.
+type Federation struct {
+	web     *searxng.Client
+	sources []Source
+}
+
+func New(web *searxng.Client, sources ...Source) *Federation {
+	return &Federation{web: web, sources: sources}
+}
+
+// Web returns the SearXNG client. Feeds are built from SearXNG alone so
+// that instances federating with each other never query each other in a
+// loop.
+func (f *Federation) Web() *searxng.Client {
+	return f.web
+}
+
+// Search returns the merged results for query. Other backends have no
+// pages, so later pages come from SearXNG alone. Like searxng.Client.Search
+// it may return a response along with an error, when SearXNG failed but
+// other backends answered.
+func (f *Federation) Search(ctx context.Context, query string, page ...int) (_ *searxng.SearchResponse, err error) {
+	if len(f.sources) == 0 || (len(page) != 0 && page[0] > 1) {
+		return f.web.Search(ctx, query, page...)
+	}
+	ctx, span := tracing.Start(ctx, "federation.Search", attribute.Int("federation.sources", len(f.sources)))
+	defer func() { tracing.End(span, err) }()
+
+	lists := make([][]searxng.Result, len(f.sources))
+	errs := make([]error, len(f.sources))
+	var wg sync.WaitGroup
+	for i, s := range f.sources {
+		wg.Go(func() {
+			ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+			defer cancel()
+			lists[i], errs[i] = s.Backend.Search(ctx, query)
+		})
+	}
+	sr, err := f.web.Search(ctx, query)
+	wg.Wait()
+
+	out := &searxng.SearchResponse{Query: query}
+	ranked := make([]ranking, 0, len(f.sources)+1)
+	if sr != nil {
+		// sr may be shared through the cache, the lists are copied
+		*out = *sr
+		out.UnresponsiveEngines = slices.Clone(sr.UnresponsiveEngines)
+		ranked = append(ranked, ranking{origin: WebOrigin, results: sr.Results})
+	} else {
+		out.UnresponsiveEngines = append(out.UnresponsiveEngines, searxng.EngineError{Engine: WebOrigin, Error: "unavailable"})
+	}
+	answered := 0
+	for i, s := range f.sources {
+		if errs[i] != nil {
+			slog.Warn("federated backend failed", "Backend", s.Name, "ERROR", errs[i])
+			reason := "error"
+			if errors.Is(errs[i], context.DeadlineExceeded) {
+				reason = "timeout"
+			}
+			out.UnresponsiveEngines = append(out.UnresponsiveEngines, searxng.EngineError{Engine: s.Name, Error: reason})
+			continue
+		}
+		answered++
+		ranked = append(ranked, ranking{origin: s.Name, results: lists[i]})
+	}
+	span.SetAttributes(attribute.Int("federation.answered", answered))
+	if sr == nil && answered == 0 {
+		return nil, err
+	}
+	out.Results = fuse(ranked)
+	out.NumberOfResults = max(out.NumberOfResults, len(out.Results))
+	return out, err
+}
+
+// ranking is the results of one backend, best first.
+type ranking struct {
+	origin  string
+	results []searxng.Result
+}
+
+// fuse merges rankings with reciprocal rank fusion: a result scores
+// 1/(rrfK+rank) in every ranking it appears in, plus its normalized score
+// weighted by scoreWeight. Scores are scaled so that a result ranked first
+// by a single backend scores 1. Results found by several backends are merged
+// by URL and labelled with every origin.
+func fuse(rankings []ranking) []searxng.Result {
+	var out []searxng.Result
+	seen := map[string]int{}
+	for _, rk := range rankings {
+		norm := normalize(rk.results)
+		for i, r := range rk.results {
+			score := (1/float64(rrfK+i+1) + scoreWeight*norm[i]/(rrfK+1)) * (rrfK + 1) / (1 + scoreWeight)
+			key := searxng.DedupeKey(r.URL)
+			j, ok := seen[key]
+			if !ok || key == "" {
+				r.Score = score
+				r.Origins = []string{rk.origin}
+				r.Engines = slices.Clone(r.Engines)
+				seen[key] = len(out)
+				out = append(out, r)
+				continue
+			}
+			merged := &out[j]
+			merged.Score += score
+			if !slices.Contains(merged.Origins, rk.origin) {
+				merged.Origins = append(merged.Origins, rk.origin)
+			}
+			for _, e := range r.Engines {
+				if !slices.Contains(merged.Engines, e) {
+					merged.Engines = append(merged.Engines, e)
+				}
+			}
+			if merged.Content == "" {
+				merged.Content = r.Content
+			}
+			if merged.Thumbnail == "" {
+				merged.Thumbnail = r.Thumbnail
+			}
+			if merged.PublishedDate == nil {
+				merged.PublishedDate = r.PublishedDate
+			}
+		}
+	}
+	slices.SortStableFunc(out, func(a, b searxng.Result) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+	return out
+}
+
+// normalize maps the scores of results onto [0, 1]. Backends that don't
+// score their results are normalized by rank instead.
+func normalize(results []searxng.Result) []float64 {
+	out := make([]float64, len(results))
+	if len(results) == 0 {
+		return out
+	}
+	lo, hi := results[0].Score, results[0].Score
+	for _, r := range results {
+		lo, hi = min(lo, r.Score), max(hi, r.Score)
+	}
+	for i, r := range results {
+		if hi > lo {
+			out[i] = (r.Score - lo) / (hi - lo)
+		} else {
+			out[i] = 1 - float64(i)/float64(len(results))
+		}
+	}
+	return out
+}
@@ -0,0 +1,129 @@
+package federation
+
+import (
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/AletisSearch/aletis/internal/searxng"
+)
+
+func results(urls ...string) []searxng.Result {
+	out := make([]searxng.Result, len(urls))
+	for i, u := range urls {
+		out[i] = searxng.Result{URL: u}
+	}
+	return out
+}
+
+func TestFuse(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		rankings []ranking
+		urls     []string
+		origins  [][]string
+	}{
+		{
+			name:     "single ranking keeps its order",
+			rankings: []ranking{{origin: "web", results: results("https://a.test/", "https://b.test/", "https://c.test/")}},
+			urls:     []string{"https://a.test/", "https://b.test/", "https://c.test/"},
+			origins:  [][]string{{"web"}, {"web"}, {"web"}},
+		},
+		{
+			name: "scores order a ranking",
+			rankings: []ranking{{origin: "docs", results: []searxng.Result{
+				{URL: "https://a.test/", Score: 0.1},
+				{URL: "https://b.test/", Score: 0.9},
+			}}},
+			urls:    []string{"https://b.test/", "https://a.test/"},
+			origins: [][]string{{"docs"}, {"docs"}},
+		},
+		{
+			name: "found by several beats first of one",
+			rankings: []ranking{
+				{origin: "web", results: results("https://a.test/", "https://b.test/")},
+				{origin: "wiki", results: results("https://b.test/", "https://c.test/")},
+			},
+			urls:    []string{"https://b.test/", "https://a.test/", "https://c.test/"},
+			origins: [][]string{{"web", "wiki"}, {"web"}, {"wiki"}},
+		},
+		{
+			name: "merged by canonical URL",
+			rankings: []ranking{
+				{origin: "web", results: results("http://www.example.com/page?utm_source=x")},
+				{origin: "peer", results: results("https://example.com/page/")},
+			},
+			urls:    []string{"http://www.example.com/page?utm_source=x"},
+			origins: [][]string{{"web", "peer"}},
+		},
+		{
+			name: "results without URL are never merged",
+			rankings: []ranking{
+				{origin: "web", results: results("")},
+				{origin: "wiki", results: results("")},
+			},
+			urls:    []string{"", ""},
+			origins: [][]string{{"web"}, {"wiki"}},
+		},
+		{
+			name:     "no rankings",
+			rankings: []ranking{{origin: "web"}},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			got := fuse(tt.rankings)
+			var urls []string
+			var origins [][]string
+			for _, r := range got {
+				urls = append(urls, r.URL)
+				origins = append(origins, r.Origins)
+			}
+			if !reflect.DeepEqual(urls, tt.urls) {
+				t.Errorf("URLs = %q, want %q", urls, tt.urls)
+			}
+			if !reflect.DeepEqual(origins, tt.origins) {
+				t.Errorf("origins = %q, want %q", origins, tt.origins)
+			}
+		})
+	}
+}
+
+func TestFuseScores(t *testing.T) {
+	// A result ranked first by a single backend scores 1
+	got := fuse([]ranking{{origin: "web", results: results("https://a.test/", "https://b.test/")}})
+	if math.Abs(got[0].Score-1) > 1e-9 {
+		t.Errorf("score of the first result = %v, want 1", got[0].Score)
+	}
+	if got[1].Score >= got[0].Score {
+		t.Errorf("score of the second result = %v, want less than %v", got[1].Score, got[0].Score)
+	}
+}
+
+func TestFuseMergesFields(t *testing.T) {
+	date := &searxng.Time{}
+	webEngines := []string{"google"}
+	got := fuse([]ranking{
+		{origin: "web", results: []searxng.Result{{URL: "https://a.test/", Engines: webEngines}}},
+		{origin: "peer", results: []searxng.Result{{
+			URL:           "https://a.test/",
+			Engines:       []string{"google", "bing"},
+			Content:       "content",
+			Thumbnail:     "https://a.test/thumb.png",
+			PublishedDate: date,
+		}}},
+	})
+	if len(got) != 1 {
+		t.Fatalf("got %d results, want 1", len(got))
+	}
+	r := got[0]
+	if !reflect.DeepEqual(r.Engines, []string{"google", "bing"}) {
+		t.Errorf("engines = %q", r.Engines)
+	}
+	if r.Content != "content" || r.Thumbnail != "https://a.test/thumb.png" || r.PublishedDate != date {
+		t.Errorf("fields of the second result not filled in: %+v", r)
+	}
+	// Results may be shared through the cache and are never modified
+	if !reflect.DeepEqual(webEngines, []string{"google"}) {
+		t.Errorf("engines of the input changed to %q", webEngines)
+	}
+}
@@ -0,0 +1,200 @@
+package feed
+
+import (
+	"encoding/json/jsontext"
+	"encoding/json/v2"
+	"encoding/xml"
+	"io"
+	"time"
+)
+
+type Item struct {
+	ID        string
+	Title     string
+	URL       string
+	Content   string
+	Author    string
+	Published time.Time
+}
+
+type Feed struct {
+	ID      string
+	Title   string
+	Link    string
+	Updated time.Time
+	Items   []Item
+}
+
+type atomLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr,omitempty"`
+}
+
+type atomAuthor struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	ID        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Link      atomLink    `xml:"link"`
+	Updated   string      `xml:"updated"`
+	Published string      `xml:"published,omitempty"`
+	Author    *atomAuthor `xml:"author,omitempty"`
+	Summary   string      `xml:"summary,omitempty"`
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Link    []atomLink  `xml:"link"`
+	Updated string      `xml:"updated"`
+	Author  atomAuthor  `xml:"author"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+func (f *Feed) Atom(w io.Writer) error {
+	a := atomFeed{
+		ID:      f.ID,
+		Title:   f.Title,
+		Link:    []atomLink{{Href: f.Link, Rel: "alternate"}, {Href: f.ID, Rel: "self"}},
+		Updated: f.Updated.UTC().Format(time.RFC3339),
+		Author:  atomAuthor{Name: "Aletis"},
+	}
+	for _, i := range f.Items {
+		e := atomEntry{
+			ID:      i.ID,
+			Title:   i.Title,
+			Link:    atomLink{Href: i.URL},
+			Updated: f.Updated.UTC().Format(time.RFC3339),
+			Summary: i.Content,
+		}
+		if !i.Published.IsZero() {
+			e.Updated = i.Published.UTC().Format(time.RFC3339)
+			e.Published = e.Updated
+		}
+		if i.Author != "" {
+			e.Author = &atomAuthor{Name: i.Author}
+		}
+		a.Entries = append(a.Entries, e)
+	}
+	return write(w, a)
+}
+
+type rssGUID struct {
+	Value       string `xml:",chardata"`
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+}
+
+type rssItem struct {
+	Title       string  `xml:"title"`
+	Link        string  `xml:"link"`
+	Description string  `xml:"description,omitempty"`
+	Author      string  `xml:"dc:creator,omitempty"`
+	GUID        rssGUID `xml:"guid"`
+	PubDate     string  `xml:"pubDate,omitempty"`
+}
+
+type rssChannel struct {
+	Title         string    `xml:"title"`
+	Link          string    `xml:"link"`
+	Description   string    `xml:"description"`
+	LastBuildDate string    `xml:"lastBuildDate"`
+	Items         []rssItem `xml:"item"`
+}
+
+type rss struct {
+	XMLName xml.Name   `xml:"rss"`
+	Version string     `xml:"version,attr"`
+	DC      string     `xml:"xmlns:dc,attr"`
+	Channel rssChannel `xml:"channel"`
+}
+
+func (f *Feed) RSS(w io.Writer) error {
+	r := rss{
+		Version: "2.0",
+		DC:      "http://purl.org/dc/elements/1.1/",
+		Channel: rssChannel{
+			Title:         f.Title,
+			Link:          f.Link,
+			Description:   f.Title,
+			LastBuildDate: f.Updated.UTC().Format(time.RFC1123Z),
+		},
+	}
+	for _, i := range f.Items {
+		item := rssItem{
+			Title:       i.Title,
+			Link:        i.URL,
+			Description: i.Content,
+			Author:      i.Author,
+			GUID:        rssGUID{Value: i.ID, IsPermaLink: i.ID == i.URL},
+		}
+		if !i.Published.IsZero() {
+			item.PubDate = i.Published.UTC().Format(time.RFC1123Z)
+		}
+		r.Channel.Items = append(r.Channel.Items, item)
+	}
+	return write(w, r)
+}
+
+func write(w io.Writer, v any) error {
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+type jsonAuthor struct {
+	Name string `json:"name"`
+}
+
+type jsonItem struct {
+	ID            string       `json:"id"`
+	URL           string       `json:"url"`
+	Title         string       `json:"title"`
+	ContentText   string       `json:"content_text"`
+	DatePublished string       `json:"date_published,omitempty"`
+	Authors       []jsonAuthor `json:"authors,omitempty"`
+}
+
+type jsonFeed struct {
+	Version     string     `json:"version"`
+	Title       string     `json:"title"`
+	HomePageURL string     `json:"home_page_url"`
+	FeedURL     string     `json:"feed_url"`
+	Items       []jsonItem `json:"items"`
+}
+
+// JSON writes the feed in the JSON Feed 1.1 format.
+func (f *Feed) JSON(w io.Writer) error {
+	j := jsonFeed{
+		Version:     "https://jsonfeed.org/version/1.1",
+		Title:       f.Title,
+		HomePageURL: f.Link,
+		FeedURL:     f.ID,
+		Items:       make([]jsonItem, 0, len(f.Items)),
+	}
+	for _, i := range f.Items {
+		item := jsonItem{
+			ID:          i.ID,
+			URL:         i.URL,
+			Title:       i.Title,
+			ContentText: i.Content,
+		}
+		if !i.Published.IsZero() {
+			item.DatePublished = i.Published.UTC().Format(time.RFC3339)
+		}
+		if i.Author != "" {
+			item.Authors = []jsonAuthor{{Name: i.Author}}
+		}
+		j.Items = append(j.Items, item)
+	}
+	return json.MarshalWrite(w, j, jsontext.Multiline(true))
+}
@@ -0,0 +1,70 @@
+package feed
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+var update = flag.Bool("update", false, "update golden files")
+
+func testFeed() *Feed {
+	updated := time.Date(2026, 3, 14, 15, 9, 26, 0, time.UTC)
+	return &Feed{
+		ID:      "https://aletis.example/search?q=go+%26+rust&format=atom",
+		Title:   "go & rust - Aletis",
+		Link:    "https://aletis.example/search?q=go+%26+rust",
+		Updated: updated,
+		Items: []Item{
+			{
+				ID:        "https://go.dev/doc/",
+				Title:     "Documentation - The Go Programming Language",
+				URL:       "https://go.dev/doc/",
+				Content:   "Go <docs> & \"tutorials\"",
+				Author:    "The Go Authors",
+				Published: time.Date(2026, 3, 1, 8, 0, 0, 0, time.FixedZone("CET", 3600)),
+			},
+			{
+				ID:      "tag:aletis.example,2026:result/2",
+				Title:   "Rust",
+				URL:     "https://www.rust-lang.org/",
+				Content: "",
+			},
+		},
+	}
+}
+
+func TestGolden(t *testing.T) {
+	for _, tt := range []struct {
+		file  string
+		write func(*Feed, io.Writer) error
+	}{
+		{"feed.rss", (*Feed).RSS},
+		{"feed.atom", (*Feed).Atom},
+		{"feed.json", (*Feed).JSON},
+	} {
+		t.Run(tt.file, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := tt.write(testFeed(), &buf); err != nil {
+				t.Fatal(err)
+			}
+			golden := filepath.Join("testdata", tt.file)
+			if *update {
+				if err := os.WriteFile(golden, buf.Bytes(), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(buf.Bytes(), want) {
+				t.Errorf("output differs from %s, run with -update to accept it:\n%s", golden, buf.Bytes())
+			}
+		})
+	}
+}
@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json/v2"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	sqlcdb "github.com/AletisSearch/aletis/db"
+	"github.com/AletisSearch/aletis/internal/cache"
+	"github.com/AletisSearch/aletis/internal/config"
+	"github.com/AletisSearch/aletis/internal/db"
+	"github.com/AletisSearch/aletis/internal/domainrules"
+	"github.com/AletisSearch/aletis/internal/ratelimit"
+	"github.com/AletisSearch/aletis/internal/searxng"
+	"github.com/AletisSearch/aletis/internal/settings"
+	"github.com/AletisSearch/aletis/web/templates"
+	adminTempl "github.com/AletisSearch/aletis/web/templates/admin"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// llmUsageDays is how far back the dashboard reports LLM spend.
+const llmUsageDays = 30
+
+// cacheStats merges this process's hit and miss counts per namespace with
+// the size of each namespace in the cache table when there is one.
+func cacheStats(ctx context.Context, q *db.Queries) ([]*cache.NamespaceStats, error) {
+	byNamespace := map[string]*cache.NamespaceStats{}
+	var out []*cache.NamespaceStats
+	for _, s := range cache.Statistics() {
+		ns := &cache.NamespaceStats{Stats: s}
+		byNamespace[s.Namespace] = ns
+		out = append(out, ns)
+	}
+	if q == nil {
+		return out, nil
+	}
+	rows, err := q.CacheStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+	for _, row := range rows {
+		ns, ok := byNamespace[row.Namespace]
+		if !ok {
+			ns = &cache.NamespaceStats{Stats: cache.Stats{Namespace: row.Namespace}}
+			out = append(out, ns)
+		}
+		ns.Entries, ns.Bytes = row.Entries, row.Bytes
+	}
+	return out, nil
+}
+
+func AdminCacheStats(q *db.Queries) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		out, err := cacheStats(r.Context(), q)
+		if err != nil {
+			slog.Error("unable to get cache stats", "ERROR", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if err = json.MarshalWrite(w, out); err != nil {
+			slog.Error("unable to write cache stats", "ERROR", err)
+		}
+	}
+}
+
+// adminDone redirects form posts back to the dashboard and answers API
+// clients with JSON.
+func adminDone(w http.ResponseWriter, r *http.Request, result any) {
+	if strings.Contains(r.Header.Get("Accept"), "text/html") {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.MarshalWrite(w, result); err != nil {
+		slog.Error("unable to write admin response", "ERROR", err)
+	}
+}
+
+// AdminCachePurge deletes the entries selected by the namespace, prefix and
+// key form values.
+func AdminCachePurge(store cache.Store) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		f := cache.PurgeFilter{
+			Namespace: r.FormValue("namespace"),
+			Prefix:    r.FormValue("prefix"),
+			Key:       r.FormValue("key"),
+		}
+		n, err := store.Purge(r.Context(), f)
+		if errors.Is(err, cache.ErrEmptyNamespace) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			slog.Error("unable to purge cache", "Namespace", f.Namespace, "ERROR", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		slog.Info("Cache Purged", "Namespace", f.Namespace, "Prefix", f.Prefix, "Key", f.Key, "Count", n)
+		adminDone(w, r, map[string]int64{"purged": n})
+	}
+}
+
+func AdminSetAI(s *settings.Settings) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		enabled, err := strconv.ParseBool(r.FormValue("enabled"))
+		if err != nil {
+			http.Error(w, "enabled must be true or false", http.StatusBadRequest)
+			return
+		}
+		if err = s.SetAIEnabled(r.Context(), enabled); err != nil {
+			slog.Error("unable to toggle ai", "ERROR", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		slog.Info("AI toggled", "Enabled", enabled)
+		adminDone(w, r, map[string]bool{"ai_enabled": enabled})
+	}
+}
+
+func AdminSetRule(rules *domainrules.Rules) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		domain, rule := r.FormValue("domain"), r.FormValue("rule")
+		err := rules.Set(r.Context(), domain, rule)
+		if errors.Is(err, domainrules.ErrInvalidDomain) || errors.Is(err, domainrules.ErrInvalidRule) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err != nil {
+			slog.Error("unable to set domain rule", "ERROR", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		adminDone(w, r, map[string]string{"domain": domain, "rule": rule})
+	}
+}
+
+func AdminDeleteRule(rules *domainrules.Rules) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		domain := r.FormValue("domain")
+		err := rules.Delete(r.Context(), domain)
+		if errors.Is(err, domainrules.ErrRuleNotFound) {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			slog.Error("unable to delete domain rule", "ERROR", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		adminDone(w, r, map[string]string{"deleted": domain})
+	}
+}
+
+// AdminDashboard shows the state of the instance to operators. Sections
+// that need the database are left out without one.
+func AdminDashboard(conf *config.Config, q *db.Queries, searchClient *searxng.Client, s *settings.Settings, rules *domainrules.Rules) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		d := &adminTempl.Dashboard{
+			Config:          conf.Redacted(),
+			ExcludedEngines: searchClient.ExcludedEngines(),
+			Upstreams:       searchClient.Upstreams(),
+			Rejections:      ratelimit.Rejections(),
+			AIConfigured:    conf.AIEnabled,
+			AIEnabled:       s.AIEnabled(),
+			Database:        q != nil,
+		}
+		var err error
+		if d.EngineFailures, err = searchClient.RecentEngineFailures(ctx); err != nil {
+			slog.Error("unable to list engine failures", "ERROR", err)
+		}
+		if d.Cache, err = cacheStats(ctx, q); err != nil {
+			slog.Error("unable to get cache stats", "ERROR", err)
+		}
+		if q != nil {
+			since := pgtype.Date{Time: time.Now().AddDate(0, 0, -llmUsageDays), Valid: true}
+			if d.LLMUsage, err = q.ListLLMUsage(ctx, since); err != nil {
+				slog.Error("unable to list llm usage", "ERROR", err)
+			}
+			if d.Rules, err = rules.List(ctx); err != nil {
+				slog.Error("unable to list domain rules", "ERROR", err)
+			}
+			if d.Migrations, err = sqlcdb.Migrations(conf); err != nil {
+				slog.Error("unable to list migrations", "ERROR", err)
+			}
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		templates.Layout(adminTempl.Head(), adminTempl.Body(d)).Render(ctx, w)
+	}
+}
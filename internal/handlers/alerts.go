@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/AletisSearch/aletis/internal/db"
+	"github.com/AletisSearch/aletis/internal/feed"
+	"github.com/jackc/pgx/v5"
+)
+
+// AlertFeed serves the new results found for a saved search. The feed token
+// in the path is the only credential since feed readers don't keep cookies.
+func AlertFeed(q *db.Queries) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		ss, err := q.GetSavedSearchByFeedToken(r.Context(), r.PathValue("token"))
+		if err != nil {
+			if errors.Is(err, pgx.ErrNoRows) {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			slog.Error("unable to get saved search for feed", "ERROR", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		results, err := q.ListAlertResults(r.Context(), db.ListAlertResultsParams{SavedSearchID: ss.ID, Limit: 100})
+		if err != nil {
+			slog.Error("unable to list alert results", "ERROR", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+
+		base := baseURL(r)
+		f := feed.Feed{
+			ID:      base + r.URL.RequestURI(),
+			Title:   "Aletis alert: " + ss.Query,
+			Link:    base + "/search?q=" + url.QueryEscape(ss.Query),
+			Updated: ss.Created,
+		}
+		if ss.LastRun != nil {
+			f.Updated = *ss.LastRun
+		}
+		for _, res := range results {
+			f.Items = append(f.Items, feed.Item{
+				ID:        res.Url,
+				Title:     res.Title,
+				URL:       res.Url,
+				Content:   res.Content,
+				Published: res.FirstSeen,
+			})
+		}
+		// The token is in the URL, so shared caches must not keep the feed
+		writeFeed(w, r, &f, time.Minute*15, true)
+	}
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/AletisSearch/aletis/internal/domainrules"
+	"github.com/AletisSearch/aletis/internal/feed"
+	"github.com/AletisSearch/aletis/internal/searxng"
+)
+
+// searchFeed serves the results for query as a feed so it can be
+// subscribed to in a feed reader.
+func searchFeed(w http.ResponseWriter, r *http.Request, searchClient *searxng.Client, rules *domainrules.Rules, query string) {
+	// Checked before searching so that bad requests cost nothing upstream
+	if write, _ := feedWriter(r); write == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	sr, err := searchClient.Search(r.Context(), query)
+	if err != nil {
+		if sr == nil {
+			slog.Error("unable to get searxng response for feed", "ERROR", err)
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		slog.Error("able to get searxng response for feed but errored", "ERROR", err)
+	}
+	sr = rules.Apply(sr)
+
+	base := baseURL(r)
+	f := feed.Feed{
+		ID:      base + r.URL.RequestURI(),
+		Title:   "Aletis: " + query,
+		Link:    base + "/search?q=" + url.QueryEscape(query),
+		Updated: time.Now().Truncate(time.Minute * 15),
+	}
+	for _, res := range sr.Results {
+		i := feed.Item{
+			ID:      res.URL,
+			Title:   res.Title,
+			URL:     res.URL,
+			Content: res.Content,
+			Author:  res.Author,
+		}
+		if res.PublishedDate != nil {
+			i.Published = res.PublishedDate.Time
+		}
+		f.Items = append(f.Items, i)
+	}
+	// Matches how long search results are cached
+	writeFeed(w, r, &f, time.Minute*15, false)
+}
+
+// writeFeed renders f in the format requested by the "format" query value.
+// The ETag lets feed readers poll without downloading unchanged feeds.
+// Private feeds are kept out of caches.
+func writeFeed(w http.ResponseWriter, r *http.Request, f *feed.Feed, maxAge time.Duration, private bool) {
+	write, contentType := feedWriter(r)
+	if write == nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	var b bytes.Buffer
+	if err := write(f, &b); err != nil {
+		slog.Error("unable to write feed", "ERROR", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	sum := sha256.Sum256(b.Bytes())
+	etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+
+	w.Header().Set("Content-Type", contentType)
+	if private {
+		w.Header().Set("Cache-Control", "private, no-store")
+	} else {
+		w.Header().Set("Cache-Control", "public, max-age="+strconv.Itoa(int(maxAge.Seconds())))
+	}
+	w.Header().Set("ETag", etag)
+	w.Header().Set("Last-Modified", f.Updated.UTC().Format(http.TimeFormat))
+	if r.Header.Get("If-None-Match") == etag {
+		w.WriteHeader(http.StatusNotModified)
+		return
+	}
+	w.Write(b.Bytes())
+}
+
+// feedWriter returns the function writing the format requested by the
+// "format" query value and its content type, or nil for unknown formats.
+func feedWriter(r *http.Request) (func(*feed.Feed, io.Writer) error, string) {
+	switch r.URL.Query().Get("format") {
+	case "rss":
+		return (*feed.Feed).RSS, "application/rss+xml; charset=utf-8"
+	case "atom", "":
+		return (*feed.Feed).Atom, "application/atom+xml; charset=utf-8"
+	case "jsonfeed":
+		return (*feed.Feed).JSON, "application/feed+json; charset=utf-8"
+	}
+	return nil, ""
+}
+
+func baseURL(r *http.Request) string {
+	scheme := "http"
+	if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+		scheme = "https"
+	}
+	return scheme + "://" + r.Host
+}
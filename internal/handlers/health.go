@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"encoding/json/v2"
+	"log/slog"
+	"net/http"
+
+	"github.com/AletisSearch/aletis/internal/health"
+)
+
+// Healthz reports that the process is alive. It checks nothing else so that
+// an outage of a dependency doesn't get the process restarted.
+func Healthz() http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Write([]byte(health.StatusOK))
+	}
+}
+
+// Readyz reports whether the instance can serve searches, with the status of
+// each dependency check. The errors of failed checks are only logged.
+func Readyz(checker *health.Checker) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report, ok := checker.Ready(r.Context())
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if !ok {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+		if err := json.MarshalWrite(w, report.Summary()); err != nil {
+			slog.Error("unable to write readiness report", "ERROR", err)
+		}
+	}
+}
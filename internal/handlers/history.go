@@ -0,0 +1,224 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json/v2"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AletisSearch/aletis/internal/clicks"
+	"github.com/AletisSearch/aletis/internal/history"
+	"github.com/AletisSearch/aletis/internal/signing"
+	"github.com/AletisSearch/aletis/web/templates"
+	historyTempl "github.com/AletisSearch/aletis/web/templates/history"
+)
+
+func History(h *history.History, retention time.Duration) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := h.UserID(r)
+		if !ok {
+			templates.Layout(historyTempl.Head(), historyTempl.Disabled()).Render(r.Context(), w)
+			return
+		}
+		filter := strings.TrimSpace(r.URL.Query().Get("filter"))
+		e, err := h.List(r.Context(), userID, filter)
+		if err != nil {
+			slog.Error("unable to list history", "ERROR", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		templates.Layout(historyTempl.Head(), historyTempl.Body(filter, e, retention)).Render(r.Context(), w)
+	}
+}
+
+func HistorySaved(h *history.History, alertsEnabled bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := h.UserID(r)
+		if !ok {
+			templates.Layout(historyTempl.Head(), historyTempl.Disabled()).Render(r.Context(), w)
+			return
+		}
+		e, err := h.List(r.Context(), userID, "")
+		if err != nil {
+			slog.Error("unable to list saved searches", "ERROR", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		templates.Layout(historyTempl.Head(), historyTempl.Saved(e.Saved, alertsEnabled)).Render(r.Context(), w)
+	}
+}
+
+func HistoryExport(h *history.History) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := h.UserID(r)
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		e, err := h.List(r.Context(), userID, "")
+		if err != nil {
+			slog.Error("unable to export history", "ERROR", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition", `attachment; filename="aletis-history.json"`)
+		if err = json.MarshalWrite(w, e); err != nil {
+			slog.Error("unable to write history export", "ERROR", err)
+		}
+	}
+}
+
+func HistoryEnable(h *history.History) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		h.Enable(w, r)
+		http.Redirect(w, r, "/history", http.StatusSeeOther)
+	}
+}
+
+func HistoryDisable(h *history.History) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := h.Disable(w, r); err != nil {
+			slog.Error("unable to disable history", "ERROR", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, "/history", http.StatusSeeOther)
+	}
+}
+
+// HistoryAction runs a POST action for a user with history enabled and
+// redirects back to the given page.
+func HistoryAction(h *history.History, back string, action func(ctx context.Context, userID string, r *http.Request) error) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, ok := h.UserID(r)
+		if !ok {
+			http.Redirect(w, r, "/history", http.StatusSeeOther)
+			return
+		}
+		if err := action(r.Context(), userID, r); err != nil {
+			var numErr *strconv.NumError
+			if errors.As(err, &numErr) {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			slog.Error("history action failed", "ERROR", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		http.Redirect(w, r, back, http.StatusSeeOther)
+	}
+}
+
+func formID(r *http.Request) (int64, error) {
+	return strconv.ParseInt(r.FormValue("id"), 10, 64)
+}
+
+func HistoryDelete(h *history.History) http.HandlerFunc {
+	return HistoryAction(h, "/history", func(ctx context.Context, userID string, r *http.Request) error {
+		id, err := formID(r)
+		if err != nil {
+			return err
+		}
+		return h.DeleteSearch(ctx, userID, id)
+	})
+}
+
+func HistoryDeleteClick(h *history.History) http.HandlerFunc {
+	return HistoryAction(h, "/history", func(ctx context.Context, userID string, r *http.Request) error {
+		id, err := formID(r)
+		if err != nil {
+			return err
+		}
+		return h.DeleteClick(ctx, userID, id)
+	})
+}
+
+func HistoryClear(h *history.History) http.HandlerFunc {
+	return HistoryAction(h, "/history", func(ctx context.Context, userID string, r *http.Request) error {
+		return h.Clear(ctx, userID)
+	})
+}
+
+func HistorySave(h *history.History) http.HandlerFunc {
+	return HistoryAction(h, "/history/saved", func(ctx context.Context, userID string, r *http.Request) error {
+		query := strings.TrimSpace(r.FormValue("q"))
+		if query == "" {
+			return nil
+		}
+		return h.Save(ctx, userID, query)
+	})
+}
+
+func HistoryDeleteSaved(h *history.History) http.HandlerFunc {
+	return HistoryAction(h, "/history/saved", func(ctx context.Context, userID string, r *http.Request) error {
+		id, err := formID(r)
+		if err != nil {
+			return err
+		}
+		return h.DeleteSaved(ctx, userID, id)
+	})
+}
+
+func HistorySetAlert(h *history.History) http.HandlerFunc {
+	return HistoryAction(h, "/history/saved", func(ctx context.Context, userID string, r *http.Request) error {
+		id, err := formID(r)
+		if err != nil {
+			return err
+		}
+		return h.SetAlert(ctx, userID, id, r.FormValue("alert") == "on")
+	})
+}
+
+// RedirectLink builds a signed link to Redirect for a result of query.
+func RedirectLink(signer *signing.Signer, query, target string, position int) string {
+	p := strconv.Itoa(position)
+	v := url.Values{}
+	v.Set("q", query)
+	v.Set("u", target)
+	v.Set("p", p)
+	v.Set("s", signer.Sign(signing.Redirect, query, target, p))
+	return "/r?" + v.Encode()
+}
+
+// Redirect records a clicked result for users with history enabled and for
+// the click statistics, then forwards to it. Only signed links are followed
+// so it can't be used as an open redirect.
+func Redirect(h *history.History, c *clicks.Clicks, signer *signing.Signer) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query().Get("q")
+		target := r.URL.Query().Get("u")
+		p := r.URL.Query().Get("p")
+		if !signer.Verify(r.URL.Query().Get("s"), signing.Redirect, query, target, p) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		position, err := strconv.Atoi(p)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		u, err := url.Parse(target)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if userID, ok := h.UserID(r); ok {
+			if err = h.RecordClick(r.Context(), userID, query, target); err != nil {
+				slog.Error("unable to record click", "ERROR", err)
+			}
+		}
+		if c != nil && clicks.Tracked(r) {
+			if err = c.Record(r.Context(), query, target, position, r.RemoteAddr); err != nil {
+				slog.Error("unable to record click event", "ERROR", err)
+			}
+		}
+		w.Header().Set("Cache-Control", "no-store")
+		http.Redirect(w, r, u.String(), http.StatusFound)
+	}
+}
@@ -7,8 +7,8 @@ import (
 	"github.com/AletisSearch/aletis/web/templates/home"
 )
 
-func Home() http.HandlerFunc {
+func Home(historyEnabled bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		templates.Layout(home.Head(), home.Body()).Render(r.Context(), w)
+		templates.Layout(home.Head(), home.Body(historyEnabled)).Render(r.Context(), w)
 	}
 }
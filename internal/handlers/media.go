@@ -6,9 +6,13 @@ import (
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
 
-	"github.com/AletisSearch/aletis/internal/db"
+	"github.com/AletisSearch/aletis/internal/cache"
+	"github.com/AletisSearch/aletis/internal/egress"
 	"github.com/AletisSearch/aletis/internal/icons"
+	"github.com/AletisSearch/aletis/internal/media"
+	"github.com/AletisSearch/aletis/internal/signing"
 	"github.com/AletisSearch/aletis/web"
 	"github.com/go-playground/validator/v10"
 )
@@ -49,15 +53,71 @@ func Assets(dev bool) http.Handler {
 	}))
 }
 
-func Icons(db *db.Queries) http.HandlerFunc {
-	c := icons.New(db)
+// MediaLink builds a signed link to Media for an image, scaled down to width
+// when it is not zero.
+func MediaLink(signer *signing.Signer, src string, width int) string {
+	w := strconv.Itoa(width)
+	v := url.Values{}
+	v.Set("u", src)
+	v.Set("w", w)
+	v.Set("s", signer.Sign(signing.Media, src, w))
+	return "/media?" + v.Encode()
+}
+
+// Media proxies result images so that browsers don't reveal themselves to
+// the hosts serving them. Only signed links are followed so it can't be used
+// as an open relay.
+func Media(store cache.Store, signer *signing.Signer, f *egress.Factory) http.HandlerFunc {
+	p := media.New(store, f)
+	return func(w http.ResponseWriter, r *http.Request) {
+		src := r.URL.Query().Get("u")
+		width := r.URL.Query().Get("w")
+		if !signer.Verify(r.URL.Query().Get("s"), signing.Media, src, width) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		n, err := strconv.Atoi(width)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		i, err := p.Get(r.Context(), src, n)
+		if err != nil {
+			if i == nil {
+				switch {
+				case errors.Is(err, media.ErrBadURL), errors.Is(err, egress.ErrBadURL):
+					w.WriteHeader(http.StatusBadRequest)
+				case errors.Is(err, media.ErrBadContentType), errors.Is(err, media.ErrTooLarge),
+					errors.Is(err, egress.ErrResponseTooLarge), errors.Is(err, egress.ErrPrivateAddress),
+					errors.Is(err, egress.ErrHostDenied):
+					w.WriteHeader(http.StatusUnprocessableEntity)
+				default:
+					w.WriteHeader(http.StatusBadGateway)
+				}
+				slog.Error("unable to proxy media", "ERROR", err)
+				return
+			}
+			slog.Error("able to proxy media but errored", "ERROR", err)
+		}
+		w.Header().Add("Content-Type", i.ContentType)
+		w.Header().Add("Cache-Control", "public, max-age="+strconv.Itoa(int(i.Expiration.Seconds())))
+		w.Header().Add("Content-Security-Policy", "default-src 'none'")
+		w.Write(i.Bytes)
+	}
+}
+
+func Icons(c *icons.Client) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		domainRaw := r.PathValue("domain")
-		i, err := c.Get(r.Context(), domainRaw)
+		size := icons.Size16
+		if s := r.URL.Query().Get("s"); s != "" {
+			size, _ = strconv.Atoi(s)
+		}
+		i, err := c.Get(r.Context(), domainRaw, size)
 		if err != nil {
 			if i == nil {
 				var validateErrs validator.ValidationErrors
-				if errors.As(err, &validateErrs) {
+				if errors.As(err, &validateErrs) || errors.Is(err, icons.ErrBadSize) {
 					w.WriteHeader(http.StatusBadRequest)
 					slog.Error("bad icon request", "ERROR", err)
 					return
@@ -70,6 +130,72 @@ func Icons(db *db.Queries) http.HandlerFunc {
 		}
 		w.Header().Add("Content-Type", i.ContentType)
 		w.Header().Add("Cache-Control", "public, max-age="+strconv.Itoa(int(i.Expiration.Seconds())))
+		// SVG icons come from third parties and must not run scripts when
+		// opened directly
+		w.Header().Add("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'")
 		w.Write(i.IconBytes)
 	}
 }
+
+// IconSpriteLink returns the src of the icon of each domain. Domains that fit
+// in a sprite point into one shared sprite so that a page of results needs a
+// single icon request, the others are served one by one.
+func IconSpriteLink(domains []string) func(domain string) string {
+	sprite := icons.SpriteDomains(domains)
+	index := make(map[string]int, len(sprite))
+	for i, d := range sprite {
+		index[d] = i
+	}
+	src := "/icons/sprite?d=" + strings.Join(sprite, ",")
+	return func(domain string) string {
+		if i, ok := index[icons.NormalizeDomain(domain)]; ok {
+			return src + "#" + icons.SpriteID(i)
+		}
+		return "/icons/" + domain
+	}
+}
+
+// IconSprite serves the icons of a comma separated list of domains as one
+// SVG sprite. Lists not in the order given by icons.SpriteDomains are
+// redirected to it so that each set of domains is cached under one URL.
+func IconSprite(c *icons.Client) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		raw := r.URL.Query().Get("d")
+		size := icons.Size16
+		if s := r.URL.Query().Get("s"); s != "" {
+			size, _ = strconv.Atoi(s)
+		}
+		var requested []string
+		if raw != "" {
+			requested = strings.Split(raw, ",")
+		}
+		domains := icons.SpriteDomains(requested)
+		if len(domains) == 0 || len(requested) > icons.MaxSpriteDomains {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		if canonical := strings.Join(domains, ","); canonical != raw {
+			loc := "/icons/sprite?d=" + canonical
+			if size != icons.Size16 {
+				loc += "&s=" + strconv.Itoa(size)
+			}
+			http.Redirect(w, r, loc, http.StatusMovedPermanently)
+			return
+		}
+		sprite, exp, err := c.Sprite(r.Context(), domains, size)
+		if err != nil {
+			if errors.Is(err, icons.ErrBadSize) {
+				w.WriteHeader(http.StatusBadRequest)
+				slog.Error("bad icon sprite request", "ERROR", err)
+				return
+			}
+			w.WriteHeader(http.StatusInternalServerError)
+			slog.Error("something went wrong with icon sprite request", "ERROR", err)
+			return
+		}
+		w.Header().Add("Content-Type", "image/svg+xml")
+		w.Header().Add("Cache-Control", "public, max-age="+strconv.Itoa(int(exp.Seconds())))
+		w.Header().Add("Content-Security-Policy", "default-src 'none'; img-src data:; style-src 'unsafe-inline'")
+		w.Write(sprite)
+	}
+}
@@ -8,13 +8,27 @@ import (
 	"sync"
 
 	aiclient "github.com/AletisSearch/aletis/internal/aiClient"
+	"github.com/AletisSearch/aletis/internal/apikey"
+	"github.com/AletisSearch/aletis/internal/clicks"
+	"github.com/AletisSearch/aletis/internal/domainrules"
+	"github.com/AletisSearch/aletis/internal/federation"
+	"github.com/AletisSearch/aletis/internal/history"
+	"github.com/AletisSearch/aletis/internal/querylog"
 	"github.com/AletisSearch/aletis/internal/searxng"
+	"github.com/AletisSearch/aletis/internal/settings"
+	"github.com/AletisSearch/aletis/internal/signing"
+	"github.com/AletisSearch/aletis/internal/spelling"
+	"github.com/AletisSearch/aletis/internal/tracing"
 	"github.com/AletisSearch/aletis/web/templates"
 	"github.com/AletisSearch/aletis/web/templates/search"
 	"github.com/a-h/templ"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-func Search(aiClient *aiclient.Client, searchClient *searxng.Client) http.HandlerFunc {
+// thumbnailWidth is twice the displayed width for high density screens.
+const thumbnailWidth = 192
+
+func Search(aiClient *aiclient.Client, fed *federation.Federation, hist *history.History, clickStats *clicks.Clicks, queryLog *querylog.QueryLog, speller *spelling.Speller, signer *signing.Signer, s *settings.Settings, rules *domainrules.Rules) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		query := strings.TrimSpace(r.URL.Query().Get("q"))
 		if query == "" {
@@ -23,11 +37,34 @@ func Search(aiClient *aiclient.Client, searchClient *searxng.Client) http.Handle
 		}
 		queryWSpaces := strings.ReplaceAll(query, "+", " ")
 
+		if r.URL.Query().Has("format") {
+			searchFeed(w, r, fed.Web(), rules, query)
+			return
+		}
+
+		aiEnabled := aiClient != nil && s.AIEnabled() && apikey.AIAllowed(r.Context())
+		ctx, span := tracing.StartRequest(r, "handlers.Search", attribute.Bool("aletis.ai", aiEnabled))
+		defer span.End()
+
+		media := func(src string) string {
+			return MediaLink(signer, src, thumbnailWidth)
+		}
+		userID, historyEnabled := hist.UserID(r)
+		if historyEnabled {
+			if err := hist.RecordSearch(ctx, userID, query, r.URL.Query().Get("src")); err != nil {
+				slog.Error("unable to record search history", "ERROR", err)
+			}
+		}
+		// Clicks go through /r when there is something to record them for
+		redirect := historyEnabled || (clickStats != nil && clicks.Tracked(r))
+
 		dataChan := make(chan templ.Component)
 		var wg sync.WaitGroup
 
 		wg.Go(func() {
-			sr, err := searchClient.Search(r.Context(), query)
+			// Backends other than SearXNG that don't answer in time are
+			// left out of the results
+			sr, err := fed.Search(ctx, query)
 			if err != nil {
 				if sr == nil {
 					slog.Error("unable to get searxng response", "ERROR", err)
@@ -36,17 +73,60 @@ func Search(aiClient *aiclient.Client, searchClient *searxng.Client) http.Handle
 				}
 				slog.Error("able to get searxng response but errored", "ERROR", err)
 			}
+			// Words the results use are real terms, however rare
+			searchQuery := query
+			correction, corrected := speller.Correct(query, spelling.Seen(resultTexts(sr)...))
+			if r.URL.Query().Has("nocorrect") {
+				corrected = false
+			}
+			// With auto-correct on, clear typos are searched corrected
+			if corrected && correction.Auto {
+				csr, err := fed.Search(ctx, correction.Query)
+				if err != nil {
+					slog.Error("unable to search corrected query", "ERROR", err)
+				}
+				if csr != nil && len(csr.Results) > 0 {
+					sr, searchQuery = csr, correction.Query
+				}
+			}
+			if queryLog != nil && clicks.Tracked(r) {
+				if err := queryLog.Record(ctx, searchQuery, r.RemoteAddr); err != nil {
+					slog.Error("unable to record query", "ERROR", err)
+				}
+			}
+			switch {
+			case searchQuery != query:
+				dataChan <- search.Corrected(searchQuery, query)
+			case len(sr.Corrections) > 0:
+				dataChan <- search.DidYouMean(sr.Corrections[0])
+			case corrected:
+				dataChan <- search.DidYouMean(correction.Query)
+			}
+			link := search.DirectLink
+			if redirect {
+				link = func(position int, result searxng.Result) string {
+					return RedirectLink(signer, searchQuery, result.URL, position)
+				}
+			}
+			sr = rules.Apply(sr)
+			if sr, err = clickStats.Apply(ctx, searchQuery, sr); err != nil {
+				slog.Error("unable to rank by click statistics", "ERROR", err)
+			}
 
 			if len(sr.Results) == 0 {
 				dataChan <- search.R("result", "No results")
 				return
 			}
 
-			dataChan <- search.Results(sr)
+			domains := make([]string, len(sr.Results))
+			for i, result := range sr.Results {
+				domains[i] = result.ParsedURL[1]
+			}
+			dataChan <- search.Results(sr, link, media, IconSpriteLink(domains))
 		})
-		if aiClient != nil {
+		if aiEnabled {
 			wg.Go(func() {
-				data, err := aiClient.RunQueryExpand(r.Context(), fmt.Sprintf("[%s]", queryWSpaces))
+				data, err := aiClient.RunQueryExpand(ctx, fmt.Sprintf("[%s]", queryWSpaces))
 				if err != nil {
 					slog.Error("unable to get ai recommendations", "ERROR", err)
 					dataChan <- search.R("recommendations", "Something went wrong")
@@ -61,9 +141,17 @@ func Search(aiClient *aiclient.Client, searchClient *searxng.Client) http.Handle
 			close(dataChan)
 		}()
 
-		aiEnabled := aiClient != nil
-		c := templates.Layout(search.Head(), search.Body(queryWSpaces, aiEnabled, dataChan))
+		c := templates.Layout(search.Head(queryWSpaces), search.Body(queryWSpaces, aiEnabled, historyEnabled, dataChan))
 
 		templ.Handler(c, templ.WithStreaming()).ServeHTTP(w, r)
 	}
 }
+
+// resultTexts are the texts of the results of a search.
+func resultTexts(sr *searxng.SearchResponse) []string {
+	texts := make([]string, 0, 3*len(sr.Results))
+	for _, r := range sr.Results {
+		texts = append(texts, r.Title, r.Content, r.URL)
+	}
+	return texts
+}
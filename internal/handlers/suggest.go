@@ -0,0 +1,22 @@
+package handlers
+
+import (
+	"encoding/json/v2"
+	"log/slog"
+	"net/http"
+
+	"github.com/AletisSearch/aletis/internal/suggest"
+)
+
+// Suggest completes the query being typed. The answer is in the OpenSearch
+// suggestions format: the query followed by the list of completions.
+func Suggest(s *suggest.Suggester) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query().Get("q")
+		w.Header().Set("Content-Type", "application/x-suggestions+json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		if err := json.MarshalWrite(w, []any{q, s.Suggest(q, suggest.MaxSuggestions)}); err != nil {
+			slog.Error("unable to write suggestions", "ERROR", err)
+		}
+	}
+}
@@ -0,0 +1,138 @@
+// Package health reports whether the process and the services it depends on
+// are able to serve traffic.
+package health
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+// checkTimeout bounds a single dependency check so one hanging dependency
+// can't stall the probe.
+const checkTimeout = time.Second * 2
+
+var ErrShuttingDown = errors.New("shutting down")
+
+type CheckFunc func(ctx context.Context) error
+
+// Result is the outcome of the last run of a check.
+type Result struct {
+	Status   string    `json:"status"`
+	Error    string    `json:"error,omitempty"`
+	Optional bool      `json:"optional,omitzero"`
+	Checked  time.Time `json:"checked"`
+	Duration int64     `json:"duration_ms"`
+}
+
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks"`
+}
+
+// Summary is a report with only the status of each check, for anyone to
+// see. Errors can tell internal hosts and credentials; they are logged.
+type Summary struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+func (r Report) Summary() Summary {
+	s := Summary{Status: r.Status, Checks: make(map[string]string, len(r.Checks))}
+	for name, res := range r.Checks {
+		s.Checks[name] = res.Status
+	}
+	return s
+}
+
+type check struct {
+	name     string
+	ttl      time.Duration
+	optional bool
+	fn       CheckFunc
+
+	mu   sync.Mutex
+	last Result
+}
+
+// run returns the cached result while it is younger than the check's TTL.
+func (c *check) run(ctx context.Context) Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !c.last.Checked.IsZero() && time.Since(c.last.Checked) < c.ttl {
+		return c.last
+	}
+	ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+	defer cancel()
+	start := time.Now()
+	err := c.fn(ctx)
+	c.last = Result{Status: StatusOK, Optional: c.optional, Checked: start, Duration: time.Since(start).Milliseconds()}
+	if err != nil {
+		c.last.Status = StatusFail
+		c.last.Error = err.Error()
+		slog.Warn("readiness check failed", "Check", c.name, "Optional", c.optional, "ERROR", err)
+	}
+	return c.last
+}
+
+type Checker struct {
+	checks       []*check
+	shuttingDown atomic.Bool
+}
+
+func New() *Checker {
+	return &Checker{}
+}
+
+// Add registers a required dependency. Its result is reused for ttl.
+func (c *Checker) Add(name string, ttl time.Duration, fn CheckFunc) {
+	c.checks = append(c.checks, &check{name: name, ttl: ttl, fn: fn})
+}
+
+// AddOptional registers a dependency that is reported without failing
+// readiness.
+func (c *Checker) AddOptional(name string, ttl time.Duration, fn CheckFunc) {
+	c.checks = append(c.checks, &check{name: name, ttl: ttl, optional: true, fn: fn})
+}
+
+// Shutdown makes readiness fail from now on so load balancers stop sending
+// traffic before the server drains its connections.
+func (c *Checker) Shutdown() {
+	c.shuttingDown.Store(true)
+}
+
+// Ready runs all checks concurrently and reports whether every required one
+// passed.
+func (c *Checker) Ready(ctx context.Context) (Report, bool) {
+	r := Report{Status: StatusOK, Checks: make(map[string]Result, len(c.checks))}
+	if c.shuttingDown.Load() {
+		r.Status = StatusFail
+		r.Checks["shutdown"] = Result{Status: StatusFail, Error: ErrShuttingDown.Error(), Checked: time.Now()}
+		return r, false
+	}
+
+	results := make([]Result, len(c.checks))
+	var wg sync.WaitGroup
+	for i, ch := range c.checks {
+		wg.Go(func() {
+			results[i] = ch.run(ctx)
+		})
+	}
+	wg.Wait()
+
+	for i, ch := range c.checks {
+		r.Checks[ch.name] = results[i]
+		if results[i].Status != StatusOK && !ch.optional {
+			r.Status = StatusFail
+		}
+	}
+	return r, r.Status == StatusOK
+}
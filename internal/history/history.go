@@ -0,0 +1,167 @@
+package history
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/AletisSearch/aletis/internal/db"
+)
+
+const cookieName = "aletis_history"
+
+// Sources a search can come from.
+const (
+	SourceSearch     = "search"
+	SourceSuggestion = "suggestion"
+	SourceSaved      = "saved"
+)
+
+const maxRows = 500
+
+// History records searches and clicked results for users that opted in. A
+// user is identified only by a random token kept in a cookie; the database
+// stores its hash.
+type History struct {
+	q *db.Queries
+}
+
+func New(q *db.Queries) *History {
+	return &History{q: q}
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// UserID returns the id of a user who enabled history.
+func (h *History) UserID(r *http.Request) (string, bool) {
+	if h == nil {
+		return "", false
+	}
+	c, err := r.Cookie(cookieName)
+	if err != nil || c.Value == "" {
+		return "", false
+	}
+	return hashToken(c.Value), true
+}
+
+func (h *History) Enable(w http.ResponseWriter, r *http.Request) {
+	if _, ok := h.UserID(r); ok {
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieName,
+		Value:    rand.Text(),
+		Path:     "/",
+		Expires:  time.Now().AddDate(5, 0, 0),
+		Secure:   r.TLS != nil,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// Disable deletes everything recorded for the user and forgets the token.
+func (h *History) Disable(w http.ResponseWriter, r *http.Request) error {
+	if userID, ok := h.UserID(r); ok {
+		if err := h.Clear(r.Context(), userID); err != nil {
+			return err
+		}
+		if err := h.q.DeleteSavedSearches(r.Context(), userID); err != nil {
+			return err
+		}
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     cookieName,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+func (h *History) RecordSearch(ctx context.Context, userID, query, source string) error {
+	switch source {
+	case SourceSuggestion, SourceSaved:
+	default:
+		source = SourceSearch
+	}
+	return h.q.InsertSearchHistory(ctx, db.InsertSearchHistoryParams{UserID: userID, Query: query, Source: source})
+}
+
+func (h *History) RecordClick(ctx context.Context, userID, query, url string) error {
+	return h.q.InsertHistoryClick(ctx, db.InsertHistoryClickParams{UserID: userID, Query: query, Url: url})
+}
+
+type Entries struct {
+	Searches []db.SearchHistory `json:"searches"`
+	Clicks   []db.HistoryClick  `json:"clicks"`
+	Saved    []db.SavedSearch   `json:"saved"`
+}
+
+// likeEscaper escapes the wildcards of LIKE patterns with the default
+// escape character.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// List returns the most recent entries containing filter.
+func (h *History) List(ctx context.Context, userID, filter string) (*Entries, error) {
+	filter = likeEscaper.Replace(filter)
+	searches, err := h.q.ListSearchHistory(ctx, db.ListSearchHistoryParams{UserID: userID, Filter: filter, MaxRows: maxRows})
+	if err != nil {
+		return nil, err
+	}
+	clicks, err := h.q.ListHistoryClicks(ctx, db.ListHistoryClicksParams{UserID: userID, Filter: filter, MaxRows: maxRows})
+	if err != nil {
+		return nil, err
+	}
+	saved, err := h.q.ListSavedSearches(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &Entries{Searches: searches, Clicks: clicks, Saved: saved}, nil
+}
+
+func (h *History) DeleteSearch(ctx context.Context, userID string, id int64) error {
+	return h.q.DeleteSearchHistoryEntry(ctx, db.DeleteSearchHistoryEntryParams{ID: id, UserID: userID})
+}
+
+func (h *History) DeleteClick(ctx context.Context, userID string, id int64) error {
+	return h.q.DeleteHistoryClickEntry(ctx, db.DeleteHistoryClickEntryParams{ID: id, UserID: userID})
+}
+
+// Clear deletes the recorded searches and clicks but keeps saved searches.
+func (h *History) Clear(ctx context.Context, userID string) error {
+	if err := h.q.DeleteSearchHistory(ctx, userID); err != nil {
+		return err
+	}
+	return h.q.DeleteHistoryClicks(ctx, userID)
+}
+
+func (h *History) Save(ctx context.Context, userID, query string) error {
+	return h.q.InsertSavedSearch(ctx, db.InsertSavedSearchParams{UserID: userID, Query: query})
+}
+
+func (h *History) DeleteSaved(ctx context.Context, userID string, id int64) error {
+	return h.q.DeleteSavedSearch(ctx, db.DeleteSavedSearchParams{ID: id, UserID: userID})
+}
+
+func (h *History) SetAlert(ctx context.Context, userID string, id int64, alert bool) error {
+	_, err := h.q.SetSavedSearchAlert(ctx, db.SetSavedSearchAlertParams{ID: id, UserID: userID, Alert: alert})
+	return err
+}
+
+// Cleanup enforces the retention policy. Saved searches are kept until the
+// user deletes them.
+func (h *History) Cleanup(ctx context.Context, retention time.Duration) error {
+	before := time.Now().Add(-retention)
+	if err := h.q.DeleteOldSearchHistory(ctx, before); err != nil {
+		return err
+	}
+	return h.q.DeleteOldHistoryClicks(ctx, before)
+}
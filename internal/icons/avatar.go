@@ -0,0 +1,28 @@
+package icons
+
+import (
+	"fmt"
+	"hash/fnv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// avatar draws the first letter of the domain on a color derived from it,
+// for sites without a usable favicon.
+func avatar(domain string) *Icon {
+	name := strings.TrimPrefix(domain, "www.")
+	letter := "?"
+	if r, _ := utf8.DecodeRuneInString(name); unicode.IsLetter(r) || unicode.IsDigit(r) {
+		letter = string(unicode.ToUpper(r))
+	}
+	h := fnv.New32a()
+	h.Write([]byte(name))
+	hue := h.Sum32() % 360
+
+	svg := fmt.Sprintf(`<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 16 16">`+
+		`<rect width="16" height="16" rx="3" fill="hsl(%d,45%%,40%%)"/>`+
+		`<text x="8" y="12" font-family="sans-serif" font-size="11" font-weight="bold" text-anchor="middle" fill="#fff">%s</text>`+
+		`</svg>`, hue, letter)
+	return &Icon{ContentType: svgContentType, IconBytes: []byte(svg)}
+}
@@ -0,0 +1,163 @@
+package icons
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+)
+
+var ErrBadICO = errors.New("bad ico file")
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+type icoEntry struct {
+	width, height int
+	offset, size  uint32
+}
+
+// decodeICO decodes the image of an ICO file closest in size to target,
+// preferring larger ones so that they are scaled down rather than up.
+func decodeICO(data []byte, target int) (image.Image, error) {
+	if len(data) < 6 || binary.LittleEndian.Uint16(data[0:]) != 0 || binary.LittleEndian.Uint16(data[2:]) != 1 {
+		return nil, ErrBadICO
+	}
+	count := int(binary.LittleEndian.Uint16(data[4:]))
+	if count == 0 || len(data) < 6+count*16 {
+		return nil, ErrBadICO
+	}
+	var best *icoEntry
+	for i := range count {
+		d := data[6+i*16:]
+		e := icoEntry{
+			width:  int(d[0]),
+			height: int(d[1]),
+			size:   binary.LittleEndian.Uint32(d[8:]),
+			offset: binary.LittleEndian.Uint32(d[12:]),
+		}
+		// A zero dimension means 256
+		if e.width == 0 {
+			e.width = 256
+		}
+		if e.height == 0 {
+			e.height = 256
+		}
+		if uint64(e.offset)+uint64(e.size) > uint64(len(data)) {
+			continue
+		}
+		if best == nil || closer(e.width, best.width, target) {
+			best = &e
+		}
+	}
+	if best == nil {
+		return nil, ErrBadICO
+	}
+	img := data[best.offset : best.offset+best.size]
+	if bytes.HasPrefix(img, pngSignature) {
+		return decodeImage(img)
+	}
+	return decodeDIB(img)
+}
+
+// closer reports whether size a suits target better than size b.
+func closer(a, b, target int) bool {
+	if (a >= target) != (b >= target) {
+		return a >= target
+	}
+	if a >= target {
+		return a < b
+	}
+	return a > b
+}
+
+// decodeDIB decodes the bitmap of an ICO entry. It is a BMP without the
+// file header, twice as tall as the image because the colors are followed
+// by a 1-bit transparency mask.
+func decodeDIB(data []byte) (image.Image, error) {
+	if len(data) < 40 {
+		return nil, ErrBadICO
+	}
+	headerSize := int(binary.LittleEndian.Uint32(data[0:]))
+	width := int(int32(binary.LittleEndian.Uint32(data[4:])))
+	height := int(int32(binary.LittleEndian.Uint32(data[8:]))) / 2
+	bpp := int(binary.LittleEndian.Uint16(data[14:]))
+	colorsUsed := int(binary.LittleEndian.Uint32(data[32:]))
+	if width <= 0 || height <= 0 || width > 256 || height > 256 || headerSize < 40 || headerSize > len(data) {
+		return nil, ErrBadICO
+	}
+
+	var palette []color.NRGBA
+	pos := headerSize
+	if bpp <= 8 {
+		if colorsUsed == 0 {
+			colorsUsed = 1 << bpp
+		}
+		if pos+colorsUsed*4 > len(data) {
+			return nil, ErrBadICO
+		}
+		for i := range colorsUsed {
+			p := data[pos+i*4:]
+			palette = append(palette, color.NRGBA{R: p[2], G: p[1], B: p[0], A: 0xff})
+		}
+		pos += colorsUsed * 4
+	}
+
+	switch bpp {
+	case 1, 4, 8, 24, 32:
+	default:
+		return nil, ErrBadICO
+	}
+	// Rows are padded to 4 bytes
+	stride := (width*bpp + 31) / 32 * 4
+	maskStride := (width + 31) / 32 * 4
+	if pos+stride*height > len(data) {
+		return nil, ErrBadICO
+	}
+	hasMask := pos+stride*height+maskStride*height <= len(data)
+
+	img := image.NewNRGBA(image.Rect(0, 0, width, height))
+	var anyAlpha bool
+	for y := range height {
+		// Rows are stored bottom-up
+		row := data[pos+(height-1-y)*stride:]
+		for x := range width {
+			var c color.NRGBA
+			switch bpp {
+			case 32:
+				p := row[x*4:]
+				c = color.NRGBA{R: p[2], G: p[1], B: p[0], A: p[3]}
+				anyAlpha = anyAlpha || p[3] != 0
+			case 24:
+				p := row[x*3:]
+				c = color.NRGBA{R: p[2], G: p[1], B: p[0], A: 0xff}
+			default:
+				perByte := 8 / bpp
+				shift := uint(8 - bpp - (x%perByte)*bpp)
+				i := int(row[x/perByte]>>shift) & (1<<bpp - 1)
+				if i < len(palette) {
+					c = palette[i]
+				}
+			}
+			img.SetNRGBA(x, y, c)
+		}
+	}
+
+	// The mask only applies when the colors carry no alpha of their own
+	if hasMask && !anyAlpha {
+		maskPos := pos + stride*height
+		for y := range height {
+			row := data[maskPos+(height-1-y)*maskStride:]
+			for x := range width {
+				if row[x/8]&(0x80>>uint(x%8)) != 0 {
+					img.SetNRGBA(x, y, color.NRGBA{})
+				} else if bpp == 32 {
+					c := img.NRGBAAt(x, y)
+					c.A = 0xff
+					img.SetNRGBA(x, y, c)
+				}
+			}
+		}
+	}
+	return img, nil
+}
@@ -3,18 +3,43 @@
 package icons
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
 	"log/slog"
+	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/AletisSearch/aletis/internal/cache"
-	"github.com/AletisSearch/aletis/internal/db"
+	"github.com/AletisSearch/aletis/internal/egress"
+	"github.com/AletisSearch/aletis/internal/metrics"
+	"github.com/AletisSearch/aletis/internal/tracing"
 	"github.com/go-playground/validator/v10"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
 	"resty.dev/v3"
 )
 
+const (
+	svgContentType = "image/svg+xml"
+	// maxPixels is far more than icons need, and bounds what decoding one
+	// takes to a few megabytes.
+	maxPixels = 1024 * 1024
+)
+
+// Sizes icons can be requested in.
+const (
+	Size16 = 16
+	Size32 = 32
+)
+
 type Icon struct {
 	ContentType string
 	IconBytes   []byte
@@ -22,55 +47,174 @@ type Icon struct {
 }
 
 type Client struct {
+	httpClient *http.Client
+	// pageClient reads pages, which are cut at the end of their head
+	// rather than refused for their size
+	pageClient  *http.Client
 	restyClient *resty.Client
+	fallbackURL string
 	cache       *cache.Cache[Icon, *Icon]
 }
 
 var validate = validator.New(validator.WithRequiredStructEnabled())
 
-func New(q *db.Queries) *Client {
+// New creates a client resolving favicons from the sites themselves. When
+// fallbackURL is set, icons that can't be resolved are fetched from it with
+// the domain appended, before falling back to a letter avatar.
+func New(store cache.Store, fallbackURL string, f *egress.Factory) *Client {
 	return &Client{
-		restyClient: resty.New(),
-		cache:       cache.New[Icon](q),
+		httpClient:  f.Client(egress.WithMaxBodyBytes(maxIconBytes)),
+		pageClient:  f.Client(egress.WithMaxBodyBytes(0)),
+		restyClient: resty.NewWithClient(f.Client(egress.WithTrusted())),
+		fallbackURL: fallbackURL,
+		cache: cache.New[Icon](store, cache.Namespace{Name: "icon", Version: "2"},
+			cache.WithStaleWhileRevalidate(time.Hour*24),
+			cache.WithNegativeCache(time.Minute*5),
+		),
 	}
 }
 
-var ErrBadContentType = errors.New("bad content type")
+var (
+	ErrBadContentType = errors.New("bad content type")
+	ErrBadSize        = errors.New("bad icon size")
+	ErrTooLarge       = errors.New("icon too large")
+)
 
-func (c *Client) Get(ctx context.Context, domain string) (*Icon, error) {
+func (c *Client) Get(ctx context.Context, domain string, size int) (*Icon, error) {
 	err := validate.Var(domain, "required,fqdn")
 	if err != nil {
 		return nil, err
 	}
-	cacheKey := "icon-" + domain
-	i, err := c.cache.Get(ctx, cacheKey)
+	if size != Size16 && size != Size32 {
+		return nil, fmt.Errorf("%w: %d", ErrBadSize, size)
+	}
+	cacheKey := fmt.Sprintf("%s-%d", domain, size)
+	return c.cache.GetOrFetch(ctx, cacheKey, func(ctx context.Context) (*Icon, time.Duration, error) {
+		return c.fetch(ctx, domain, size)
+	})
+}
+
+func (c *Client) fetch(ctx context.Context, domain string, size int) (_ *Icon, _ time.Duration, err error) {
+	ctx, span := tracing.Start(ctx, "icons.Fetch", attribute.String("icons.domain", domain))
+	defer func() { tracing.End(span, err) }()
+
+	start := time.Now()
+	i, err := c.resolve(ctx, domain, size)
+	metrics.ObserveIcon(time.Since(start), err)
+	if err == nil {
+		i.Expiration = time.Hour * 24 * 7
+		return i, i.Expiration, nil
+	}
+	slog.Debug("unable to resolve icon", "Domain", domain, "ERROR", err)
+
+	if c.fallbackURL != "" {
+		i, exp, err := c.fetchFallback(ctx, domain)
+		if err == nil {
+			return i, exp, nil
+		}
+		slog.Debug("unable to fetch fallback icon", "Domain", domain, "ERROR", err)
+	}
+
+	// Sites without an icon are tried again sooner in case they add one
+	i = avatar(domain)
+	i.Expiration = time.Hour * 24
+	return i, i.Expiration, nil
+}
+
+// resolve finds the icon declared by the site, falling back to
+// /favicon.ico, which is also tried when the home page can't be read.
+func (c *Client) resolve(ctx context.Context, domain string, size int) (*Icon, error) {
+	var errs []error
+	candidates, base, err := c.discover(ctx, domain, size)
+	if err != nil {
+		errs = append(errs, err)
+		base = &url.URL{Scheme: "https", Host: domain}
+	}
+	for _, cand := range candidates[:min(len(candidates), maxCandidates)] {
+		i, err := c.fetchIcon(ctx, cand.url, size)
+		if err == nil {
+			return i, nil
+		}
+		errs = append(errs, err)
+	}
+	favicon, err := base.Parse("/favicon.ico")
+	if err != nil {
+		return nil, err
+	}
+	i, err := c.fetchIcon(ctx, favicon.String(), size)
 	if err == nil {
-		slog.Info("Cache Hit", "Key", cacheKey)
 		return i, nil
 	}
-	if !errors.Is(err, cache.ErrNotFoundInCache) && !errors.Is(err, cache.ErrOldCache) {
+	return nil, errors.Join(append(errs, err, ErrNoIcon)...)
+}
+
+// fetchIcon downloads an icon and scales it to size. SVG icons are kept as
+// they are since they scale by themselves.
+func (c *Client) fetchIcon(ctx context.Context, u string, size int) (*Icon, error) {
+	_, data, err := c.get(ctx, c.httpClient, u, 0)
+	if err != nil {
 		return nil, err
 	}
-	r, err := c.restyClient.R().
-		Get("https://f1.allesedv.com/16/" + domain)
+	var img image.Image
+	switch {
+	case bytes.HasPrefix(data, []byte{0, 0, 1, 0}):
+		img, err = decodeICO(data, size)
+	case isSVG(data):
+		return &Icon{ContentType: svgContentType, IconBytes: data}, nil
+	default:
+		img, err = decodeImage(data)
+	}
 	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %w", ErrBadContentType, u, err)
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, dst); err != nil {
 		return nil, err
 	}
+	return &Icon{ContentType: "image/png", IconBytes: buf.Bytes()}, nil
+}
+
+// decodeImage decodes data once its dimensions are known to be within
+// maxPixels, as a small file can claim a size that takes gigabytes to
+// decode.
+func decodeImage(data []byte) (image.Image, error) {
+	conf, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if conf.Width*conf.Height > maxPixels {
+		return nil, fmt.Errorf("%w: %dx%d", ErrTooLarge, conf.Width, conf.Height)
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	return img, err
+}
+
+// fetchFallback gets the icon from the configured external service.
+func (c *Client) fetchFallback(ctx context.Context, domain string) (*Icon, time.Duration, error) {
+	r, err := c.restyClient.R().WithContext(ctx).
+		Get(c.fallbackURL + domain)
+	if err != nil {
+		return nil, 0, err
+	}
 	xs := r.Header().Get("x-source")
 	ct := r.Header().Get("content-type")
 	if ct == "" {
-		return nil, fmt.Errorf("%w: %s", ErrBadContentType, ct)
+		return nil, 0, fmt.Errorf("%w: %s", ErrBadContentType, ct)
 	}
 
-	i = &Icon{ContentType: ct, IconBytes: r.Bytes()}
+	i := &Icon{ContentType: ct, IconBytes: r.Bytes()}
 	exp := time.Hour * 24 * 7
 	if xs != "" {
 		exp = time.Minute * 5
 	}
 	i.Expiration = exp
-	return i, c.cache.Set(ctx, cacheKey, i, exp)
+	return i, exp, nil
 }
 
 func (c *Client) Close() error {
+	c.httpClient.CloseIdleConnections()
 	return c.restyClient.Close()
 }
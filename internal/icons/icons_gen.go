@@ -3,7 +3,11 @@
 package icons
 
 import (
+	_ "image/gif"
+	_ "image/jpeg"
+
 	"github.com/tinylib/msgp/msgp"
+	_ "golang.org/x/image/webp"
 )
 
 // DecodeMsg implements msgp.Decodable
@@ -0,0 +1,250 @@
+package icons
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json/v2"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+const (
+	maxPageBytes = 512 << 10
+	maxIconBytes = 1 << 20
+	// maxCandidates bounds the icons tried from a page before falling back
+	// to /favicon.ico.
+	maxCandidates = 4
+	// sizeAny is the size given to icons declared as scalable.
+	sizeAny = 1 << 16
+)
+
+var ErrNoIcon = errors.New("no icon found")
+
+// candidate is an icon declared by a page or its manifest.
+type candidate struct {
+	url  string
+	size int
+}
+
+func open(ctx context.Context, client *http.Client, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		res.Body.Close()
+		return nil, fmt.Errorf("unable to fetch %s status: %d", u, res.StatusCode)
+	}
+	return res, nil
+}
+
+// get fetches u. Bodies are cut at limit bytes when it is positive.
+func (c *Client) get(ctx context.Context, client *http.Client, u string, limit int64) (*http.Response, []byte, error) {
+	res, err := open(ctx, client, u)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+	var r io.Reader = res.Body
+	if limit > 0 {
+		r = io.LimitReader(r, limit)
+	}
+	data, err := io.ReadAll(r)
+	return res, data, err
+}
+
+// getPage fetches the page at u up to the end of its head, which is all
+// that is looked at, or its first maxPageBytes.
+func (c *Client) getPage(ctx context.Context, u string) (*http.Response, []byte, error) {
+	res, err := open(ctx, c.pageClient, u)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer res.Body.Close()
+	var page bytes.Buffer
+	buf := make([]byte, 32<<10)
+	for page.Len() < maxPageBytes {
+		n, err := res.Body.Read(buf[:min(len(buf), maxPageBytes-page.Len())])
+		// The end tag may span two reads
+		from := max(0, page.Len()-len(headEnd))
+		page.Write(buf[:n])
+		if bytes.Contains(bytes.ToLower(page.Bytes()[from:]), headEnd) || err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return res, page.Bytes(), nil
+}
+
+var headEnd = []byte("</head")
+
+// discover lists the icons declared by the home page of domain, best suited
+// to size first.
+func (c *Client) discover(ctx context.Context, domain string, size int) ([]candidate, *url.URL, error) {
+	res, data, err := c.getPage(ctx, "https://"+domain+"/")
+	if err != nil {
+		res, data, err = c.getPage(ctx, "http://"+domain+"/")
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	// Redirects decide what relative links are relative to
+	base := res.Request.URL
+	candidates, manifest := parseHead(data, base)
+	if manifest != "" {
+		if _, data, err := c.get(ctx, c.pageClient, manifest, maxPageBytes); err == nil {
+			if m, err := url.Parse(manifest); err == nil {
+				candidates = append(candidates, parseManifest(data, m)...)
+			}
+		}
+	}
+	slices.SortStableFunc(candidates, func(a, b candidate) int {
+		return compareSize(a.size, b.size, size)
+	})
+	return candidates, base, nil
+}
+
+// compareSize orders icon sizes by how well they suit target. Icons at
+// least as large as target come first, smallest first, then icons of
+// unknown size, then smaller icons, largest first.
+func compareSize(a, b, target int) int {
+	rank := func(s int) int {
+		switch {
+		case s >= target:
+			return 0
+		case s == 0:
+			return 1
+		}
+		return 2
+	}
+	if r := cmp.Compare(rank(a), rank(b)); r != 0 {
+		return r
+	}
+	if a >= target {
+		return cmp.Compare(a, b)
+	}
+	return cmp.Compare(b, a)
+}
+
+// parseHead reads the icons and manifest linked from the head of a page.
+func parseHead(page []byte, base *url.URL) (candidates []candidate, manifest string) {
+	z := html.NewTokenizer(bytes.NewReader(page))
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			return candidates, manifest
+		case html.EndTagToken:
+			if name, _ := z.TagName(); atom.Lookup(name) == atom.Head {
+				return candidates, manifest
+			}
+			continue
+		case html.StartTagToken, html.SelfClosingTagToken:
+		default:
+			continue
+		}
+		t := z.Token()
+		switch t.DataAtom {
+		case atom.Body:
+			return candidates, manifest
+		case atom.Base:
+			if b, err := base.Parse(attr(t, "href")); err == nil {
+				base = b
+			}
+		case atom.Link:
+			href := attr(t, "href")
+			if href == "" {
+				continue
+			}
+			u, err := base.Parse(href)
+			if err != nil {
+				continue
+			}
+			for rel := range strings.FieldsSeq(strings.ToLower(attr(t, "rel"))) {
+				switch rel {
+				case "icon", "apple-touch-icon", "apple-touch-icon-precomposed":
+					candidates = append(candidates, candidate{url: u.String(), size: parseSizes(attr(t, "sizes"))})
+				case "manifest":
+					manifest = u.String()
+				}
+			}
+		}
+	}
+}
+
+func attr(t html.Token, key string) string {
+	for _, a := range t.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+// parseSizes returns the largest size in a sizes attribute such as
+// "16x16 32x32", or 0 when it is missing.
+func parseSizes(sizes string) int {
+	var largest int
+	for s := range strings.FieldsSeq(strings.ToLower(sizes)) {
+		if s == "any" {
+			return sizeAny
+		}
+		w, _, _ := strings.Cut(s, "x")
+		if n, err := strconv.Atoi(w); err == nil {
+			largest = max(largest, n)
+		}
+	}
+	return largest
+}
+
+type webManifest struct {
+	Icons []struct {
+		Src   string `json:"src"`
+		Sizes string `json:"sizes"`
+	} `json:"icons"`
+}
+
+func parseManifest(data []byte, base *url.URL) []candidate {
+	var m webManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil
+	}
+	var candidates []candidate
+	for _, i := range m.Icons {
+		if u, err := base.Parse(i.Src); err == nil {
+			candidates = append(candidates, candidate{url: u.String(), size: parseSizes(i.Sizes)})
+		}
+	}
+	return candidates
+}
+
+// isSVG reports whether data is an SVG document.
+func isSVG(data []byte) bool {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	for {
+		t, err := d.Token()
+		if err != nil {
+			return false
+		}
+		if s, ok := t.(xml.StartElement); ok {
+			return s.Name.Local == "svg"
+		}
+	}
+}
@@ -0,0 +1,104 @@
+package icons
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"mime"
+	"net"
+	"slices"
+	"strings"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// MaxSpriteDomains bounds the icons in one sprite to about the sites on
+	// a page of results, so that a sprite request can't make many fetches.
+	// Icons of sites past it are requested one by one.
+	MaxSpriteDomains = 20
+	// spriteConcurrency bounds the icons fetched at once for a sprite.
+	spriteConcurrency = 8
+)
+
+// NormalizeDomain turns the host of a result URL into the form icons are
+// cached under.
+func NormalizeDomain(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
+
+// SpriteDomains normalizes, dedupes and sorts domains so that pages showing
+// the same sites share one sprite URL. Domains that can't have an icon are
+// left out, as are any past MaxSpriteDomains.
+func SpriteDomains(domains []string) []string {
+	out := make([]string, 0, len(domains))
+	for _, d := range domains {
+		d = NormalizeDomain(d)
+		if validate.Var(d, "required,fqdn") == nil {
+			out = append(out, d)
+		}
+	}
+	slices.Sort(out)
+	out = slices.Compact(out)
+	return out[:min(len(out), MaxSpriteDomains)]
+}
+
+// SpriteID is the id of the view showing the icon at index in a sprite,
+// used as the fragment of the sprite URL.
+func SpriteID(index int) string {
+	return fmt.Sprintf("i%d", index)
+}
+
+// Sprite draws the icons of domains, as given by SpriteDomains, stacked in
+// one SVG document. Each icon has a view named by SpriteID so that pages can
+// show it with a fragment on the sprite URL. The expiration is the earliest
+// of the icons. Icons that can't be fetched are left blank.
+func (c *Client) Sprite(ctx context.Context, domains []string, size int) ([]byte, time.Duration, error) {
+	if size != Size16 && size != Size32 {
+		return nil, 0, fmt.Errorf("%w: %d", ErrBadSize, size)
+	}
+	if len(domains) > MaxSpriteDomains {
+		return nil, 0, fmt.Errorf("too many domains for a sprite: %d", len(domains))
+	}
+
+	icons := make([]*Icon, len(domains))
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(spriteConcurrency)
+	for i, d := range domains {
+		g.Go(func() error {
+			// Get only fails without an icon for domains that aren't valid,
+			// which shouldn't fail the rest of the sprite
+			icons[i], _ = c.Get(ctx, d, size)
+			return nil
+		})
+	}
+	g.Wait()
+
+	exp := time.Hour * 24 * 7
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%[1]d" height="%[1]d" viewBox="0 0 %[1]d %[1]d">`, size)
+	for i, icon := range icons {
+		y := i * size
+		fmt.Fprintf(&buf, `<view id="%s" viewBox="0 %d %d %d"/>`, SpriteID(i), y, size, size)
+		if icon == nil {
+			continue
+		}
+		// Fallback icons carry the content type of a third party
+		ct, _, err := mime.ParseMediaType(icon.ContentType)
+		if err != nil || !strings.HasPrefix(ct, "image/") {
+			continue
+		}
+		if icon.Expiration > 0 {
+			exp = min(exp, icon.Expiration)
+		}
+		fmt.Fprintf(&buf, `<image x="0" y="%d" width="%d" height="%d" href="data:%s;base64,%s"/>`,
+			y, size, size, ct, base64.StdEncoding.EncodeToString(icon.IconBytes))
+	}
+	buf.WriteString(`</svg>`)
+	return buf.Bytes(), exp, nil
+}
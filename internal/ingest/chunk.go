@@ -0,0 +1,58 @@
+package ingest
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// chunkSize is the size in bytes chunks are cut at, at the next blank
+	// line. Smaller chunks rank better and link closer to what matched.
+	chunkSize = 4000
+	// maxChunkSize cuts chunks without blank lines at a line end, and
+	// truncates single lines longer than that.
+	maxChunkSize = 3 * chunkSize
+)
+
+// lineChunks splits text into chunks of about chunkSize bytes, each linked
+// to the line it starts on.
+func lineChunks(text string) []part {
+	var (
+		parts []part
+		sb    strings.Builder
+		start = 1
+		line  = 0
+	)
+	flush := func() {
+		if strings.TrimSpace(sb.String()) != "" {
+			parts = append(parts, part{
+				text:     truncate(sb.String(), maxChunkSize),
+				fragment: fmt.Sprintf("L%d", start),
+			})
+		}
+		sb.Reset()
+		start = line + 1
+	}
+	for l := range strings.Lines(text) {
+		line++
+		sb.WriteString(l)
+		blank := strings.TrimSpace(l) == ""
+		if (blank && sb.Len() >= chunkSize) || sb.Len() >= maxChunkSize {
+			flush()
+		}
+	}
+	flush()
+	return parts
+}
+
+// truncate cuts s to at most n bytes without splitting a character.
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
@@ -0,0 +1,189 @@
+package ingest
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"go/parser"
+	gotoken "go/token"
+	"path/filepath"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var ErrBinary = errors.New("file is not text")
+
+// document is the text of a file, in parts that are stored as chunks.
+type document struct {
+	title string
+	parts []part
+}
+
+// part is a chunk of text with the URL fragment that leads to it.
+type part struct {
+	text     string
+	fragment string
+}
+
+type extractor func(path string, data []byte) (document, error)
+
+// extractors are keyed by lowercase file extension.
+var extractors = map[string]extractor{
+	".md":       extractMarkdown,
+	".markdown": extractMarkdown,
+	".txt":      extractText,
+	".rst":      extractText,
+	".go":       extractGo,
+	".html":     extractHTML,
+	".htm":      extractHTML,
+	".pdf":      extractPDF,
+}
+
+func text(data []byte) (string, error) {
+	if !utf8.Valid(data) || bytes.IndexByte(data, 0) != -1 {
+		return "", ErrBinary
+	}
+	return string(data), nil
+}
+
+func extractText(path string, data []byte) (document, error) {
+	s, err := text(data)
+	if err != nil {
+		return document{}, err
+	}
+	return document{title: filepath.Base(path), parts: lineChunks(s)}, nil
+}
+
+// extractMarkdown titles the document with its front matter title or its
+// first heading.
+func extractMarkdown(path string, data []byte) (document, error) {
+	s, err := text(data)
+	if err != nil {
+		return document{}, err
+	}
+	title := ""
+	if rest, ok := strings.CutPrefix(s, "---\n"); ok {
+		if front, _, ok := strings.Cut(rest, "\n---"); ok {
+			for line := range strings.Lines(front) {
+				if v, ok := strings.CutPrefix(line, "title:"); ok {
+					title = strings.Trim(strings.TrimSpace(v), `"'`)
+					break
+				}
+			}
+		}
+	}
+	if title == "" {
+		for line := range strings.Lines(s) {
+			if h, ok := strings.CutPrefix(line, "# "); ok {
+				title = strings.TrimSpace(h)
+				break
+			}
+		}
+	}
+	if title == "" {
+		title = filepath.Base(path)
+	}
+	return document{title: title, parts: lineChunks(s)}, nil
+}
+
+// extractGo titles source files with their package, which is what people
+// search for code by.
+func extractGo(path string, data []byte) (document, error) {
+	s, err := text(data)
+	if err != nil {
+		return document{}, err
+	}
+	title := filepath.Base(path)
+	if f, err := parser.ParseFile(gotoken.NewFileSet(), path, data, parser.PackageClauseOnly); err == nil {
+		title = fmt.Sprintf("%s (package %s)", title, f.Name.Name)
+	}
+	return document{title: title, parts: lineChunks(s)}, nil
+}
+
+// skipElements hold no text meant for reading.
+var skipElements = map[atom.Atom]bool{
+	atom.Script:   true,
+	atom.Style:    true,
+	atom.Noscript: true,
+	atom.Template: true,
+	atom.Svg:      true,
+	atom.Nav:      true,
+}
+
+var blockElements = map[atom.Atom]bool{
+	atom.P: true, atom.Div: true, atom.Br: true, atom.Li: true, atom.Tr: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true,
+	atom.Pre: true, atom.Blockquote: true, atom.Section: true, atom.Article: true,
+	atom.Header: true, atom.Footer: true, atom.Table: true, atom.Dt: true, atom.Dd: true,
+}
+
+// extractHTML keeps the text of a page. Lines of HTML don't lead anywhere,
+// so the chunks have no fragment.
+func extractHTML(path string, data []byte) (document, error) {
+	z := html.NewTokenizer(bytes.NewReader(data))
+	var (
+		sb      strings.Builder
+		title   string
+		skip    int
+		inTitle bool
+	)
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if title == "" {
+				title = filepath.Base(path)
+			}
+			parts := lineChunks(sb.String())
+			for i := range parts {
+				parts[i].fragment = ""
+			}
+			return document{title: title, parts: parts}, nil
+		case html.StartTagToken, html.SelfClosingTagToken, html.EndTagToken:
+			name, _ := z.TagName()
+			a := atom.Lookup(name)
+			switch {
+			case a == atom.Title:
+				inTitle = tt == html.StartTagToken
+			case skipElements[a] && tt == html.StartTagToken:
+				skip++
+			case skipElements[a] && tt == html.EndTagToken:
+				skip = max(0, skip-1)
+			case blockElements[a]:
+				sb.WriteByte('\n')
+			}
+		case html.TextToken:
+			t := string(z.Text())
+			switch {
+			case inTitle:
+				title = strings.Join(strings.Fields(t), " ")
+			case skip == 0:
+				sb.WriteString(strings.Join(strings.Fields(t), " "))
+				sb.WriteByte(' ')
+			}
+		}
+	}
+}
+
+// extractPDF stores each page as its own chunk, linked with the page
+// fragment PDF viewers understand.
+func extractPDF(path string, data []byte) (document, error) {
+	title, pages, err := readPDF(data)
+	if err != nil {
+		return document{}, err
+	}
+	if title = strings.TrimSpace(title); title == "" {
+		title = filepath.Base(path)
+	}
+	d := document{title: title}
+	for _, p := range pages {
+		d.parts = append(d.parts, part{
+			text:     truncate(p.text, maxChunkSize),
+			fragment: fmt.Sprintf("page=%d", p.number),
+		})
+	}
+	return d, nil
+}
@@ -0,0 +1,127 @@
+package ingest
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// trackedFiles lists the files git tracks in the clone at dir, relative to
+// dir. Untracked and ignored files are left out.
+func trackedFiles(ctx context.Context, dir string) (map[string]bool, error) {
+	// The clone's config must not get commands run, such as a monitor
+	cmd := exec.CommandContext(ctx, "git", "-C", dir, "-c", "core.fsmonitor=false", "ls-files", "-z")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git ls-files: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	files := map[string]bool{}
+	for f := range strings.SplitSeq(string(out), "\x00") {
+		if f != "" {
+			files[f] = true
+		}
+	}
+	return files, nil
+}
+
+// gitWebURL returns the URL files of the clone at dir are browsed at on the
+// host of its origin remote, such as https://github.com/owner/repo/blob/main,
+// or "" when the clone has no such remote or no branch checked out. GitHub,
+// Gitea and Forgejo serve files under /blob/; GitLab redirects there.
+func gitWebURL(dir string) string {
+	gitDir := filepath.Join(dir, ".git")
+	// Worktrees and submodules have a file pointing at the git directory
+	if b, err := os.ReadFile(gitDir); err == nil {
+		if p, ok := strings.CutPrefix(strings.TrimSpace(string(b)), "gitdir: "); ok {
+			if !filepath.IsAbs(p) {
+				p = filepath.Join(dir, p)
+			}
+			gitDir = p
+		}
+	}
+	head, err := os.ReadFile(filepath.Join(gitDir, "HEAD"))
+	if err != nil {
+		return ""
+	}
+	branch, ok := strings.CutPrefix(strings.TrimSpace(string(head)), "ref: refs/heads/")
+	if !ok {
+		return ""
+	}
+	remote := originURL(filepath.Join(gitDir, "config"))
+	if remote == "" {
+		// Worktrees share the config of the main repository
+		remote = originURL(filepath.Join(gitDir, "..", "..", "config"))
+	}
+	web := webURL(remote)
+	if web == "" {
+		return ""
+	}
+	return web + "/blob/" + branch
+}
+
+// originURL reads the URL of the origin remote from a git config file.
+func originURL(config string) string {
+	f, err := os.Open(config)
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	inOrigin := false
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if strings.HasPrefix(line, "[") {
+			inOrigin = line == `[remote "origin"]`
+			continue
+		}
+		if !inOrigin {
+			continue
+		}
+		if k, v, ok := strings.Cut(line, "="); ok && strings.TrimSpace(k) == "url" {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// webURL turns the URL of a remote, such as git@github.com:owner/repo.git
+// or https://github.com/owner/repo.git, into the URL of its web page.
+func webURL(remote string) string {
+	if remote == "" {
+		return ""
+	}
+	if !strings.Contains(remote, "://") {
+		// scp-like syntax, user@host:path
+		host, path, ok := strings.Cut(remote, ":")
+		if !ok {
+			return ""
+		}
+		if _, h, ok := strings.Cut(host, "@"); ok {
+			host = h
+		}
+		remote = "ssh://" + host + "/" + strings.TrimPrefix(path, "/")
+	}
+	u, err := url.Parse(remote)
+	if err != nil || u.Host == "" {
+		return ""
+	}
+	host := u.Hostname()
+	switch u.Scheme {
+	case "http", "https":
+		// The port of an ssh remote is not that of the web server
+		host = u.Host
+	case "ssh", "git":
+		u.Scheme = "https"
+	default:
+		return ""
+	}
+	return u.Scheme + "://" + host + strings.TrimSuffix(strings.TrimSuffix(u.Path, "/"), ".git")
+}
@@ -0,0 +1,265 @@
+// Package ingest indexes directories of documents, such as a team's docs or
+// local git clones, into the documents table, where the postgres federation
+// backend searches them. Files are split into chunks so that matches link
+// close to where they are. Files whose modification time hasn't changed
+// since they were stored are skipped, so indexing again is cheap.
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/AletisSearch/aletis/internal/config"
+	"github.com/AletisSearch/aletis/internal/db"
+)
+
+// maxFileSize leaves out files too large to be documents, such as data
+// dumps.
+const maxFileSize = 32 << 20
+
+// skipDirs are never documents. Hidden directories, including .git, are
+// skipped as well.
+var skipDirs = map[string]bool{
+	"node_modules": true,
+	"vendor":       true,
+	"__pycache__":  true,
+}
+
+// Stats counts what an Index did to the files of a source.
+type Stats struct {
+	Indexed   int
+	Unchanged int
+	Removed   int
+	Skipped   int
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("%d indexed, %d unchanged, %d removed, %d skipped", s.Indexed, s.Unchanged, s.Removed, s.Skipped)
+}
+
+type Indexer struct {
+	q *db.Queries
+}
+
+func New(q *db.Queries) *Indexer {
+	return &Indexer{q: q}
+}
+
+// Index brings the documents of p.Source up to date with the files under
+// p.Path: new and modified files are stored again and the documents of
+// files that are gone are removed.
+func (ix *Indexer) Index(ctx context.Context, p config.IngestPath) (Stats, error) {
+	var st Stats
+	root, err := filepath.Abs(p.Path)
+	if err != nil {
+		return st, err
+	}
+	if info, err := os.Stat(root); err != nil {
+		return st, err
+	} else if !info.IsDir() {
+		return st, fmt.Errorf("%s is not a directory", root)
+	}
+	files, err := ix.q.ListDocumentFiles(ctx, p.Source)
+	if err != nil {
+		return st, err
+	}
+	stored := make(map[string]time.Time, len(files))
+	for _, f := range files {
+		stored[f.Path] = f.Modified
+	}
+
+	l, err := newLinker(p.BaseURL)
+	if err != nil {
+		return st, err
+	}
+	seen := map[string]bool{}
+	err = filepath.WalkDir(root, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if file == root {
+				return err
+			}
+			slog.Warn("unable to read", "Path", file, "ERROR", err)
+			return nil
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(root, file)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+		if d.IsDir() {
+			if file != root && (strings.HasPrefix(d.Name(), ".") || skipDirs[d.Name()]) {
+				return fs.SkipDir
+			}
+			if err := l.enter(ctx, file, rel); err != nil {
+				slog.Warn("skipping git clone", "Path", rel, "ERROR", err)
+				return fs.SkipDir
+			}
+			return nil
+		}
+		extract := extractors[strings.ToLower(filepath.Ext(file))]
+		if extract == nil || !d.Type().IsRegular() || !l.tracked(rel) {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		// Postgres keeps microseconds
+		modified := info.ModTime().Truncate(time.Microsecond)
+		if t, ok := stored[rel]; ok && t.Equal(modified) {
+			seen[rel] = true
+			st.Unchanged++
+			return nil
+		}
+		if info.Size() > maxFileSize {
+			st.Skipped++
+			return nil
+		}
+		data, err := os.ReadFile(file)
+		if err != nil {
+			slog.Warn("unable to read", "Path", rel, "ERROR", err)
+			st.Skipped++
+			return nil
+		}
+		doc, err := extract(file, data)
+		if err != nil || len(doc.parts) == 0 {
+			if err != nil && !errors.Is(err, ErrBinary) {
+				slog.Warn("unable to extract text", "Path", rel, "ERROR", err)
+			}
+			st.Skipped++
+			return nil
+		}
+		if err := ix.store(ctx, p.Source, rel, l.link(rel), modified, doc); err != nil {
+			return err
+		}
+		seen[rel] = true
+		st.Indexed++
+		return nil
+	})
+	if err != nil {
+		return st, err
+	}
+
+	for rel := range stored {
+		if seen[rel] {
+			continue
+		}
+		if err := ix.q.DeleteDocumentFile(ctx, db.DeleteDocumentFileParams{Source: p.Source, Path: rel}); err != nil {
+			return st, err
+		}
+		st.Removed++
+	}
+	return st, nil
+}
+
+// store replaces the chunks of a file. When interrupted between the two
+// statements the file is missing from the table, so the next Index stores
+// it again.
+func (ix *Indexer) store(ctx context.Context, source, rel, link string, modified time.Time, doc document) error {
+	if err := ix.q.DeleteDocumentFile(ctx, db.DeleteDocumentFileParams{Source: source, Path: rel}); err != nil {
+		return err
+	}
+	arg := db.InsertDocumentChunksParams{
+		Source:   source,
+		Path:     rel,
+		Title:    doc.title,
+		Modified: modified,
+	}
+	for i, p := range doc.parts {
+		u := link
+		if p.fragment != "" {
+			u += "#" + p.fragment
+		}
+		arg.Chunks = append(arg.Chunks, int32(i))
+		arg.Urls = append(arg.Urls, u)
+		// Postgres text can't hold NUL
+		arg.Bodies = append(arg.Bodies, strings.ReplaceAll(p.text, "\x00", ""))
+	}
+	return ix.q.InsertDocumentChunks(ctx, arg)
+}
+
+// linker links files by the web page of the git clone they are in, or by
+// the base URL of their source. It also knows which files git tracks in the
+// clones, as untracked and ignored files are often private.
+type linker struct {
+	base *url.URL
+	// repos maps the directories of git clones to the clones
+	repos map[string]*repo
+}
+
+type repo struct {
+	// web is the URL files are browsed at, empty when unknown
+	web   string
+	files map[string]bool
+}
+
+// newLinker returns an error when base is not an http(s) URL, as other links
+// can't be followed from search results.
+func newLinker(base string) (*linker, error) {
+	u, err := url.Parse(base)
+	if err != nil {
+		return nil, err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("base URL %q is not an http(s) URL", base)
+	}
+	return &linker{base: u, repos: map[string]*repo{}}, nil
+}
+
+// enter notes the directory at rel when it is a git clone. It returns an
+// error when the files git tracks there can't be listed.
+func (l *linker) enter(ctx context.Context, dir, rel string) error {
+	if _, err := os.Stat(filepath.Join(dir, ".git")); err != nil {
+		return nil
+	}
+	files, err := trackedFiles(ctx, dir)
+	if err != nil {
+		return err
+	}
+	l.repos[rel] = &repo{web: gitWebURL(dir), files: files}
+	return nil
+}
+
+// clone returns the innermost clone the file at rel is in and the path of
+// the file in it, or nil when it isn't in one.
+func (l *linker) clone(rel string) (*repo, string) {
+	for dir := path.Dir(rel); ; dir = path.Dir(dir) {
+		if r, ok := l.repos[dir]; ok {
+			if dir == "." {
+				return r, rel
+			}
+			return r, strings.TrimPrefix(rel, dir+"/")
+		}
+		if dir == "." || dir == "/" {
+			return nil, ""
+		}
+	}
+}
+
+// tracked reports whether the file at rel is outside of git clones or
+// tracked by the clone it is in.
+func (l *linker) tracked(rel string) bool {
+	r, inRepo := l.clone(rel)
+	return r == nil || r.files[inRepo]
+}
+
+func (l *linker) link(rel string) string {
+	if r, inRepo := l.clone(rel); r != nil && r.web != "" {
+		if u, err := url.Parse(r.web); err == nil {
+			return u.JoinPath(inRepo).String()
+		}
+	}
+	return l.base.JoinPath(rel).String()
+}
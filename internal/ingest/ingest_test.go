@@ -0,0 +1,99 @@
+package ingest
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// newClone creates a git clone with tracked, untracked and ignored files.
+func newClone(t *testing.T) string {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-C", dir, "-c", "user.name=test", "-c", "user.email=test@example.org"}, args...)...)
+		if out, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v: %v: %s", args, err, out)
+		}
+	}
+	write := func(name, content string) {
+		t.Helper()
+		file := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(file), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git("init", "-q", "-b", "main")
+	git("remote", "add", "origin", "git@github.com:owner/repo.git")
+	write(".gitignore", "*.txt\n")
+	write("README.md", "# Readme\n")
+	write("docs/guide.md", "# Guide\n")
+	git("add", ".")
+	git("commit", "-q", "-m", "initial")
+	write("notes.txt", "ignored\n")
+	write("secrets.md", "untracked\n")
+	write("docs/draft.md", "untracked\n")
+	return dir
+}
+
+func TestLinkerClone(t *testing.T) {
+	dir := newClone(t)
+	l, err := newLinker("https://docs.example/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.enter(t.Context(), dir, "repo"); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		rel     string
+		tracked bool
+		link    string
+	}{
+		{"repo/README.md", true, "https://github.com/owner/repo/blob/main/README.md"},
+		{"repo/docs/guide.md", true, "https://github.com/owner/repo/blob/main/docs/guide.md"},
+		{"repo/docs/draft.md", false, ""},
+		{"repo/secrets.md", false, ""},
+		{"repo/notes.txt", false, ""},
+		// Files outside of clones are all indexed
+		{"handbook/intro.md", true, "https://docs.example/handbook/intro.md"},
+	} {
+		if got := l.tracked(tt.rel); got != tt.tracked {
+			t.Errorf("tracked(%q) = %v, want %v", tt.rel, got, tt.tracked)
+		}
+		if got := l.link(tt.rel); tt.tracked && got != tt.link {
+			t.Errorf("link(%q) = %q, want %q", tt.rel, got, tt.link)
+		}
+	}
+}
+
+func TestLinkerBrokenClone(t *testing.T) {
+	dir := t.TempDir()
+	// Not a repository git can read
+	if err := os.WriteFile(filepath.Join(dir, ".git"), []byte("gitdir: missing\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	l, err := newLinker("https://docs.example/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := l.enter(t.Context(), dir, "repo"); err == nil {
+		t.Error("enter succeeded, want the clone refused")
+	}
+}
+
+func TestNewLinkerBaseURL(t *testing.T) {
+	for _, base := range []string{"", "file:///srv/docs", "/srv/docs", "https://"} {
+		if _, err := newLinker(base); err == nil {
+			t.Errorf("newLinker(%q) succeeded", base)
+		}
+	}
+}
@@ -0,0 +1,891 @@
+package ingest
+
+import (
+	"bytes"
+	"compress/zlib"
+	"errors"
+	"io"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// The PDF reader only goes as far as search needs: it finds the text drawn
+// on each page. Streams must be uncompressed or Flate compressed, and text
+// is decoded through the ToUnicode map of its font, or as Latin-1 for
+// simple fonts without one. Text in form XObjects and annotations is left
+// out.
+
+var ErrEncrypted = errors.New("pdf is encrypted")
+
+// maxDecoded bounds what the streams of a file decompress to, so that a
+// small file can't take all memory.
+const maxDecoded = 64 << 20
+
+var (
+	objectStart = regexp.MustCompile(`(\d+)\s+\d+\s+obj\b`)
+	streamStart = regexp.MustCompile(`>>\s*stream\r?\n`)
+	refPattern  = regexp.MustCompile(`(\d+)\s+\d+\s+R\b`)
+	encryptKey  = regexp.MustCompile(`/Encrypt\s*(\d+\s+\d+\s+R|<<)`)
+	rootKey     = regexp.MustCompile(`/Root\s+(\d+)\s+\d+\s+R`)
+	infoKey     = regexp.MustCompile(`/Info\s+(\d+)\s+\d+\s+R`)
+	fontEntry   = regexp.MustCompile(`/([^\s/<>\[\]()]+)\s+(\d+)\s+\d+\s+R`)
+)
+
+type pdfObject struct {
+	dict string
+	// stream is the decoded stream, nil when there is none or its filter
+	// is not supported
+	stream []byte
+}
+
+type pdfFile struct {
+	objects map[int]*pdfObject
+	cmaps   map[int]*cmap
+	// decoded counts the bytes streams have decompressed to
+	decoded int
+}
+
+// pdfPage is the text of a page, numbered from 1.
+type pdfPage struct {
+	number int
+	text   string
+}
+
+// readPDF returns the title of a PDF, empty when it has none, and the text
+// of its pages.
+func readPDF(data []byte) (string, []pdfPage, error) {
+	if !bytes.HasPrefix(data, []byte("%PDF-")) {
+		return "", nil, errors.New("not a pdf")
+	}
+	if encryptKey.Match(data) {
+		return "", nil, ErrEncrypted
+	}
+	f := &pdfFile{objects: map[int]*pdfObject{}, cmaps: map[int]*cmap{}}
+	f.parseObjects(data)
+
+	var title string
+	if m := lastSubmatch(infoKey, data); m != nil {
+		if info := f.object(m); info != nil {
+			title = pdfTextString(value(info.dict, "Title"))
+		}
+	}
+
+	var pages []pdfPage
+	for i, id := range f.pageIDs(data) {
+		text := f.pageText(id)
+		if strings.TrimSpace(text) != "" {
+			pages = append(pages, pdfPage{number: i + 1, text: text})
+		}
+	}
+	return title, pages, nil
+}
+
+func lastSubmatch(re *regexp.Regexp, data []byte) []byte {
+	all := re.FindAllSubmatch(data, -1)
+	if len(all) == 0 {
+		return nil
+	}
+	return all[len(all)-1][1]
+}
+
+// parseObjects reads the objects in order, so that objects redefined by
+// incremental updates end up with their latest version.
+func (f *pdfFile) parseObjects(data []byte) {
+	pos := 0
+	var objStms []*pdfObject
+	for {
+		loc := objectStart.FindSubmatchIndex(data[pos:])
+		if loc == nil {
+			break
+		}
+		id, _ := strconv.Atoi(string(data[pos+loc[2] : pos+loc[3]]))
+		start := pos + loc[1]
+		end := bytes.Index(data[start:], []byte("endobj"))
+		if end == -1 {
+			end = len(data) - start
+		}
+		obj := &pdfObject{}
+		body := data[start : start+end]
+		if s := streamStart.FindIndex(body); s != nil {
+			obj.dict = string(body[:s[0]+2])
+			raw := data[start+s[1]:]
+			// The stream may contain "endobj", the object ends after it
+			if e := bytes.Index(raw, []byte("endstream")); e != -1 {
+				raw = raw[:e]
+				if e2 := bytes.Index(data[start+s[1]+e:], []byte("endobj")); e2 != -1 {
+					end = s[1] + e + e2
+				}
+			}
+			obj.stream = f.decodeStream(obj.dict, raw)
+		} else {
+			obj.dict = string(body)
+		}
+		f.objects[id] = obj
+		if name(value(obj.dict, "Type")) == "ObjStm" {
+			objStms = append(objStms, obj)
+		}
+		pos = start + end
+	}
+	for _, s := range objStms {
+		f.parseObjectStream(s)
+	}
+}
+
+// parseObjectStream reads the objects compressed together in an object
+// stream. It starts with pairs of object numbers and offsets.
+func (f *pdfFile) parseObjectStream(s *pdfObject) {
+	n, _ := strconv.Atoi(value(s.dict, "N"))
+	first, _ := strconv.Atoi(value(s.dict, "First"))
+	if s.stream == nil || first < 0 || first > len(s.stream) {
+		return
+	}
+	header := strings.Fields(string(s.stream[:first]))
+	for i := 0; i < n && 2*i+1 < len(header); i++ {
+		id, err1 := strconv.Atoi(header[2*i])
+		off, err2 := strconv.Atoi(header[2*i+1])
+		if err1 != nil || err2 != nil || off < 0 || off > len(s.stream)-first {
+			return
+		}
+		end := len(s.stream)
+		if 2*i+3 < len(header) {
+			if next, err := strconv.Atoi(header[2*i+3]); err == nil && next >= off && next <= end-first {
+				end = first + next
+			}
+		}
+		if _, ok := f.objects[id]; !ok {
+			f.objects[id] = &pdfObject{dict: string(s.stream[first+off : end])}
+		}
+	}
+}
+
+// decodeStream decompresses a stream, cutting it short once the streams of
+// the file have decompressed to maxDecoded bytes.
+func (f *pdfFile) decodeStream(dict string, raw []byte) []byte {
+	raw = bytes.TrimRight(raw, "\r\n")
+	filters := value(dict, "Filter")
+	if filters == "" {
+		return raw
+	}
+	for _, filter := range strings.Fields(strings.NewReplacer("[", " ", "]", " ", "/", " /").Replace(filters)) {
+		if filter != "/FlateDecode" {
+			return nil
+		}
+	}
+	r, err := zlib.NewReader(bytes.NewReader(raw))
+	if err != nil {
+		return nil
+	}
+	// Streams often end with bytes zlib complains about after the data
+	out, _ := io.ReadAll(io.LimitReader(r, int64(maxDecoded-f.decoded)))
+	f.decoded += len(out)
+	return out
+}
+
+func (f *pdfFile) object(id []byte) *pdfObject {
+	n, err := strconv.Atoi(string(id))
+	if err != nil {
+		return nil
+	}
+	return f.objects[n]
+}
+
+// resolve returns the dictionary v is, or refers to.
+func (f *pdfFile) resolve(v string) string {
+	if m := refPattern.FindStringSubmatch(v); m != nil && strings.HasPrefix(strings.TrimSpace(v), m[0]) {
+		if o := f.object([]byte(m[1])); o != nil {
+			return o.dict
+		}
+		return ""
+	}
+	return v
+}
+
+// pageIDs lists the pages in the order of the page tree, or by object
+// number when the tree can't be followed.
+func (f *pdfFile) pageIDs(data []byte) []int {
+	var ids []int
+	if root := lastSubmatch(rootKey, data); root != nil {
+		if catalog := f.object(root); catalog != nil {
+			seen := map[int]bool{}
+			var walk func(v string)
+			walk = func(v string) {
+				for _, m := range refPattern.FindAllStringSubmatch(v, -1) {
+					id, _ := strconv.Atoi(m[1])
+					o := f.objects[id]
+					if o == nil || seen[id] {
+						continue
+					}
+					seen[id] = true
+					switch name(value(o.dict, "Type")) {
+					case "Pages":
+						walk(value(o.dict, "Kids"))
+					case "Page":
+						ids = append(ids, id)
+					}
+				}
+			}
+			walk(value(catalog.dict, "Pages"))
+		}
+	}
+	if len(ids) > 0 {
+		return ids
+	}
+	for id, o := range f.objects {
+		if name(value(o.dict, "Type")) == "Page" {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+func (f *pdfFile) pageText(id int) string {
+	page := f.objects[id]
+	fonts := f.fonts(page)
+	var content []byte
+	for _, m := range refPattern.FindAllStringSubmatch(value(page.dict, "Contents"), -1) {
+		if o := f.object([]byte(m[1])); o != nil && o.stream != nil {
+			content = append(content, o.stream...)
+			content = append(content, '\n')
+		}
+	}
+	return showText(content, fonts)
+}
+
+// fonts maps the font names used by the content of page to the maps
+// decoding their text, inheriting resources from the parents of the page.
+func (f *pdfFile) fonts(page *pdfObject) map[string]*cmap {
+	resources := ""
+	for o, depth := page, 0; o != nil && depth < 32; depth++ {
+		if r := value(o.dict, "Resources"); r != "" {
+			resources = f.resolve(r)
+			break
+		}
+		m := refPattern.FindStringSubmatch(value(o.dict, "Parent"))
+		if m == nil {
+			break
+		}
+		o = f.object([]byte(m[1]))
+	}
+	fonts := map[string]*cmap{}
+	dict := f.resolve(value(resources, "Font"))
+	for _, entry := range fontEntry.FindAllStringSubmatch(dict, -1) {
+		font := f.object([]byte(entry[2]))
+		if font == nil {
+			continue
+		}
+		m := refPattern.FindStringSubmatch(value(font.dict, "ToUnicode"))
+		if m == nil {
+			fonts[entry[1]] = f.differences(font)
+			continue
+		}
+		id, _ := strconv.Atoi(m[1])
+		c, ok := f.cmaps[id]
+		if !ok {
+			if o := f.objects[id]; o != nil && o.stream != nil {
+				c = parseCMap(o.stream)
+			}
+			f.cmaps[id] = c
+		}
+		fonts[entry[1]] = c
+	}
+	return fonts
+}
+
+// differences maps the codes a simple font without a ToUnicode map
+// redefines through the /Differences of its encoding, which is how TeX and
+// others reach ligatures and typographic quotes. It returns nil when there
+// are none.
+func (f *pdfFile) differences(font *pdfObject) *cmap {
+	diffs := value(f.resolve(value(font.dict, "Encoding")), "Differences")
+	if diffs == "" {
+		return nil
+	}
+	c := &cmap{codeLen: 1, simple: true, codes: map[uint32]string{}}
+	toks, _ := (&lexer{data: []byte(diffs)}).next()
+	n := uint32(0)
+	for _, t := range toks.arr {
+		switch t.kind {
+		case tokenNumber:
+			n = uint32(t.num)
+		case tokenName:
+			if s := glyphText(t.op); s != "" {
+				c.codes[n] = s
+			}
+			n++
+		}
+	}
+	return c
+}
+
+// glyphs are the glyph names whose text isn't the name itself.
+var glyphs = map[string]string{
+	"space": " ", "hyphen": "-", "minus": "-", "period": ".", "comma": ",",
+	"colon": ":", "semicolon": ";", "exclam": "!", "question": "?",
+	"parenleft": "(", "parenright": ")", "bracketleft": "[", "bracketright": "]",
+	"slash": "/", "quotesingle": "'", "quotedbl": "\"",
+	"fi": "fi", "fl": "fl", "ff": "ff", "ffi": "ffi", "ffl": "ffl",
+	"quoteright": "’", "quoteleft": "‘", "quotedblleft": "“", "quotedblright": "”",
+	"endash": "–", "emdash": "—", "bullet": "•", "ellipsis": "…",
+	"periodcentered": "·", "dotlessi": "ı", "copyright": "©",
+	"registered": "®", "trademark": "™", "degree": "°",
+	"zero": "0", "one": "1", "two": "2", "three": "3", "four": "4",
+	"five": "5", "six": "6", "seven": "7", "eight": "8", "nine": "9",
+}
+
+func glyphText(name string) string {
+	if s, ok := glyphs[name]; ok {
+		return s
+	}
+	if len(name) == 1 {
+		return name
+	}
+	if h, ok := strings.CutPrefix(name, "uni"); ok && len(h) == 4 {
+		if n, err := strconv.ParseUint(h, 16, 32); err == nil {
+			return string(rune(n))
+		}
+	}
+	return ""
+}
+
+// winAnsi holds the characters of WinAnsiEncoding that differ from Latin-1.
+var winAnsi = map[byte]rune{
+	0x80: '€', 0x82: '‚', 0x83: 'ƒ', 0x84: '„', 0x85: '…',
+	0x86: '†', 0x87: '‡', 0x88: 'ˆ', 0x89: '‰', 0x8a: 'Š',
+	0x8b: '‹', 0x8c: 'Œ', 0x8e: 'Ž', 0x91: '‘', 0x92: '’',
+	0x93: '“', 0x94: '”', 0x95: '•', 0x96: '–', 0x97: '—',
+	0x98: '˜', 0x99: '™', 0x9a: 'š', 0x9b: '›', 0x9c: 'œ',
+	0x9e: 'ž', 0x9f: 'Ÿ',
+}
+
+// simpleText decodes the text of simple fonts, most of which use
+// WinAnsiEncoding or a close relative.
+func simpleText(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		if r, ok := winAnsi[c]; ok {
+			sb.WriteRune(r)
+		} else if c >= 0x20 && (c < 0x7f || c >= 0xa0) {
+			sb.WriteRune(rune(c))
+		}
+	}
+	return sb.String()
+}
+
+// value returns the raw value of key in the dictionary text dict: a name,
+// number, reference, string, or a whole array or dictionary. Only the keys
+// of dict itself are looked at, not those of dictionaries inside it.
+func value(dict, key string) string {
+	s := strings.TrimSpace(dict)
+	if !strings.HasPrefix(s, "<<") {
+		return ""
+	}
+	s = s[2:]
+	for {
+		s = strings.TrimLeft(s, " \t\r\n\f")
+		if s == "" || s[0] != '/' {
+			return ""
+		}
+		e := 1
+		for e < len(s) && !isDelimiter(s[e]) && !isSpace(s[e]) {
+			e++
+		}
+		k := s[1:e]
+		s = strings.TrimLeft(s[e:], " \t\r\n\f")
+		v := firstValue(s)
+		if k == key {
+			return v
+		}
+		if v == "" {
+			return ""
+		}
+		s = s[len(v):]
+	}
+}
+
+// firstValue returns the value s starts with.
+func firstValue(s string) string {
+	if s == "" {
+		return ""
+	}
+	switch {
+	case strings.HasPrefix(s, "<<"):
+		return balanced(s, "<<", ">>")
+	case s[0] == '[':
+		return balanced(s, "[", "]")
+	case s[0] == '(':
+		return balanced(s, "(", ")")
+	case s[0] == '<':
+		if e := strings.IndexByte(s, '>'); e != -1 {
+			return s[:e+1]
+		}
+		return s
+	case s[0] == '/':
+		e := 1
+		for e < len(s) && !isDelimiter(s[e]) && !isSpace(s[e]) {
+			e++
+		}
+		return s[:e]
+	}
+	if m := refPattern.FindStringIndex(s); m != nil && m[0] == 0 {
+		return s[:m[1]]
+	}
+	e := 0
+	for e < len(s) && !isDelimiter(s[e]) && !isSpace(s[e]) {
+		e++
+	}
+	return s[:e]
+}
+
+// balanced returns the prefix of s from open to its matching close.
+func balanced(s, open, close string) string {
+	depth := 0
+	for i := 0; i < len(s); {
+		switch {
+		case open == "(" && s[i] == '\\':
+			i += 2
+			continue
+		case strings.HasPrefix(s[i:], open):
+			depth++
+			i += len(open)
+		case strings.HasPrefix(s[i:], close):
+			depth--
+			i += len(close)
+			if depth == 0 {
+				return s[:i]
+			}
+		default:
+			i++
+		}
+	}
+	return s
+}
+
+func name(v string) string {
+	return strings.TrimPrefix(v, "/")
+}
+
+// pdfTextString decodes a string outside content streams, which is UTF-16
+// when it starts with a byte order mark.
+func pdfTextString(v string) string {
+	if v == "" {
+		return ""
+	}
+	tok, ok := (&lexer{data: []byte(v)}).next()
+	if !ok || tok.kind != tokenString {
+		return ""
+	}
+	b := tok.str
+	if len(b) >= 2 && b[0] == 0xfe && b[1] == 0xff {
+		return decodeUTF16(b[2:])
+	}
+	return latin1(b)
+}
+
+func decodeUTF16(b []byte) string {
+	u := make([]uint16, 0, len(b)/2)
+	for i := 0; i+1 < len(b); i += 2 {
+		u = append(u, uint16(b[i])<<8|uint16(b[i+1]))
+	}
+	return string(utf16.Decode(u))
+}
+
+func latin1(b []byte) string {
+	var sb strings.Builder
+	for _, c := range b {
+		if c >= 0x20 || c == '\t' || c == '\n' {
+			sb.WriteRune(rune(c))
+		}
+	}
+	return sb.String()
+}
+
+// cmap maps character codes of a font to text.
+type cmap struct {
+	codeLen int
+	codes   map[uint32]string
+	// simple maps are only the differences of a simple font, other codes
+	// are read as WinAnsiEncoding
+	simple bool
+}
+
+// maxCMapCodes bounds the codes of a map, which is more than fonts have
+// glyphs.
+const maxCMapCodes = 1 << 17
+
+func parseCMap(data []byte) *cmap {
+	c := &cmap{codeLen: 2, codes: map[uint32]string{}}
+	l := &lexer{data: data}
+	var operands []token
+	for {
+		tok, ok := l.next()
+		if !ok {
+			break
+		}
+		if tok.kind != tokenOperator {
+			operands = append(operands, tok)
+			continue
+		}
+		switch tok.op {
+		case "endcodespacerange":
+			if len(operands) > 0 && operands[0].kind == tokenString && len(operands[0].str) > 0 {
+				c.codeLen = len(operands[0].str)
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands) && len(c.codes) < maxCMapCodes; i += 2 {
+				if operands[i].kind == tokenString && operands[i+1].kind == tokenString {
+					c.codes[code(operands[i].str)] = decodeUTF16(operands[i+1].str)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, hi, dst := code(operands[i].str), code(operands[i+1].str), operands[i+2]
+				if hi < lo || hi-lo > 0xffff {
+					continue
+				}
+				// A 64-bit counter so that a range ending at the largest
+				// code still ends
+				for n64 := uint64(lo); n64 <= uint64(hi) && len(c.codes) < maxCMapCodes; n64++ {
+					n := uint32(n64)
+					switch dst.kind {
+					case tokenString:
+						// The last unit of the destination counts up
+						b := slices.Clone(dst.str)
+						if len(b) >= 2 {
+							v := uint32(b[len(b)-2])<<8 | uint32(b[len(b)-1]) + n - lo
+							b[len(b)-2], b[len(b)-1] = byte(v>>8), byte(v)
+						}
+						c.codes[n] = decodeUTF16(b)
+					case tokenArray:
+						if k := int(n - lo); k < len(dst.arr) && dst.arr[k].kind == tokenString {
+							c.codes[n] = decodeUTF16(dst.arr[k].str)
+						}
+					}
+				}
+			}
+		}
+		operands = operands[:0]
+	}
+	return c
+}
+
+func code(b []byte) uint32 {
+	var n uint32
+	for _, c := range b {
+		n = n<<8 | uint32(c)
+	}
+	return n
+}
+
+func (c *cmap) decode(b []byte) string {
+	if c == nil {
+		return simpleText(b)
+	}
+	var sb strings.Builder
+	for i := 0; i+c.codeLen <= len(b); i += c.codeLen {
+		s, ok := c.codes[code(b[i:i+c.codeLen])]
+		if !ok && c.simple {
+			s = simpleText(b[i : i+1])
+		}
+		sb.WriteString(s)
+	}
+	return sb.String()
+}
+
+// showText runs the text operators of a content stream and returns the
+// text they draw, with lines where the text moves down.
+func showText(content []byte, fonts map[string]*cmap) string {
+	var (
+		sb       strings.Builder
+		font     *cmap
+		operands []token
+		lastY    float64
+	)
+	newline := func() {
+		if sb.Len() > 0 && !strings.HasSuffix(sb.String(), "\n") {
+			sb.WriteByte('\n')
+		}
+	}
+	space := func() {
+		if s := sb.String(); s != "" && !strings.HasSuffix(s, " ") && !strings.HasSuffix(s, "\n") {
+			sb.WriteByte(' ')
+		}
+	}
+	show := func(t token) {
+		if t.kind == tokenString {
+			sb.WriteString(font.decode(t.str))
+		}
+	}
+	l := &lexer{data: content}
+	for {
+		tok, ok := l.next()
+		if !ok {
+			break
+		}
+		if tok.kind != tokenOperator {
+			operands = append(operands, tok)
+			continue
+		}
+		switch tok.op {
+		case "Tf":
+			if len(operands) >= 2 && operands[0].kind == tokenName {
+				font = fonts[operands[0].op]
+			}
+		case "Tj":
+			if len(operands) >= 1 {
+				show(operands[len(operands)-1])
+			}
+		case "'":
+			newline()
+			if len(operands) >= 1 {
+				show(operands[len(operands)-1])
+			}
+		case "\"":
+			newline()
+			if len(operands) >= 3 {
+				show(operands[2])
+			}
+		case "TJ":
+			if len(operands) >= 1 && operands[len(operands)-1].kind == tokenArray {
+				for _, t := range operands[len(operands)-1].arr {
+					// Wide gaps between strings separate words
+					if t.kind == tokenNumber && t.num < -150 {
+						space()
+					}
+					show(t)
+				}
+			}
+		case "Td", "TD":
+			if len(operands) >= 2 && operands[1].kind == tokenNumber && operands[1].num != 0 {
+				newline()
+			} else {
+				space()
+			}
+		case "Tm":
+			if len(operands) >= 6 && operands[5].kind == tokenNumber {
+				if operands[5].num != lastY {
+					newline()
+				} else {
+					space()
+				}
+				lastY = operands[5].num
+			}
+		case "T*", "ET":
+			newline()
+		case "BI":
+			l.skipInlineImage()
+		}
+		operands = operands[:0]
+	}
+	return sb.String()
+}
+
+type tokenKind int
+
+const (
+	tokenNumber tokenKind = iota
+	tokenString
+	tokenName
+	tokenArray
+	tokenDict
+	tokenOperator
+)
+
+type token struct {
+	kind tokenKind
+	num  float64
+	str  []byte
+	// op is the operator or the name without its slash
+	op  string
+	arr []token
+}
+
+type lexer struct {
+	data []byte
+	pos  int
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\n' || c == '\f' || c == 0
+}
+
+func isDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) != -1
+}
+
+func (l *lexer) next() (token, bool) {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case isSpace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		case c == '(':
+			return token{kind: tokenString, str: l.literal()}, true
+		case c == '<' && l.pos+1 < len(l.data) && l.data[l.pos+1] == '<':
+			l.pos += 2
+			l.collect(">>")
+			return token{kind: tokenDict}, true
+		case c == '<':
+			return token{kind: tokenString, str: l.hex()}, true
+		case c == '[':
+			l.pos++
+			return token{kind: tokenArray, arr: l.collect("]")}, true
+		case c == '/':
+			l.pos++
+			return token{kind: tokenName, op: l.word()}, true
+		case c == ']' || c == '>' || c == ')' || c == '{' || c == '}':
+			l.pos++
+		default:
+			w := l.word()
+			if w == "" {
+				l.pos++
+				continue
+			}
+			if n, err := strconv.ParseFloat(w, 64); err == nil {
+				return token{kind: tokenNumber, num: n}, true
+			}
+			return token{kind: tokenOperator, op: w}, true
+		}
+	}
+	return token{}, false
+}
+
+// collect returns the tokens up to end, which closes an array or a
+// dictionary.
+func (l *lexer) collect(end string) []token {
+	var out []token
+	for l.pos < len(l.data) {
+		for l.pos < len(l.data) && isSpace(l.data[l.pos]) {
+			l.pos++
+		}
+		if bytes.HasPrefix(l.data[l.pos:], []byte(end)) {
+			l.pos += len(end)
+			return out
+		}
+		tok, ok := l.next()
+		if !ok {
+			break
+		}
+		out = append(out, tok)
+	}
+	return out
+}
+
+func (l *lexer) word() string {
+	start := l.pos
+	for l.pos < len(l.data) && !isSpace(l.data[l.pos]) && !isDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	return string(l.data[start:l.pos])
+}
+
+func (l *lexer) literal() []byte {
+	var out []byte
+	depth := 0
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+			if depth == 1 {
+				continue
+			}
+		case ')':
+			depth--
+			if depth == 0 {
+				return out
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return out
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+			case '\n':
+			default:
+				if e >= '0' && e <= '7' {
+					n := int(e - '0')
+					for k := 0; k < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; k++ {
+						n = n*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					out = append(out, byte(n))
+				} else {
+					out = append(out, e)
+				}
+			}
+			continue
+		}
+		out = append(out, c)
+	}
+	return out
+}
+
+func (l *lexer) hex() []byte {
+	l.pos++
+	var digits []byte
+	for l.pos < len(l.data) && l.data[l.pos] != '>' {
+		if c := l.data[l.pos]; !isSpace(c) {
+			digits = append(digits, c)
+		}
+		l.pos++
+	}
+	l.pos++
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	out := make([]byte, 0, len(digits)/2)
+	for i := 0; i < len(digits); i += 2 {
+		n, err := strconv.ParseUint(string(digits[i:i+2]), 16, 8)
+		if err != nil {
+			return out
+		}
+		out = append(out, byte(n))
+	}
+	return out
+}
+
+// skipInlineImage moves past the binary data of an inline image, which
+// ends with EI.
+func (l *lexer) skipInlineImage() {
+	i := bytes.Index(l.data[l.pos:], []byte("ID"))
+	if i == -1 {
+		l.pos = len(l.data)
+		return
+	}
+	l.pos += i + 2
+	for l.pos < len(l.data) {
+		i := bytes.Index(l.data[l.pos:], []byte("EI"))
+		if i == -1 {
+			l.pos = len(l.data)
+			return
+		}
+		l.pos += i + 2
+		if isSpace(l.data[l.pos-3]) && (l.pos == len(l.data) || isSpace(l.data[l.pos])) {
+			return
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package ingest
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+func TestReadPDF(t *testing.T) {
+	for _, tt := range []struct {
+		file  string
+		title string
+		pages []pdfPage
+	}{
+		{"simple.pdf", "Seed document", []pdfPage{
+			{number: 1, text: "Hello, world!\nSecond (line)\n"},
+			{number: 2, text: "Kerned text\n"},
+		}},
+		// Flate streams, a ToUnicode map and an object stream
+		{"compressed.pdf", "", []pdfPage{{number: 1, text: "Hélmn\n"}}},
+		// A bfrange ending at the largest code
+		{"cmap-range-end.pdf", "", []pdfPage{{number: 1, text: "A\n"}}},
+	} {
+		t.Run(tt.file, func(t *testing.T) {
+			data, err := os.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			title, pages, err := readPDF(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if title != tt.title || !slices.Equal(pages, tt.pages) {
+				t.Errorf("readPDF = %q, %+v, want %q, %+v", title, pages, tt.title, tt.pages)
+			}
+		})
+	}
+}
+
+func TestReadPDFRefused(t *testing.T) {
+	if _, _, err := readPDF([]byte("%PDF-1.7\ntrailer << /Root 1 0 R /Encrypt 5 0 R >>")); !errors.Is(err, ErrEncrypted) {
+		t.Errorf("readPDF of an encrypted file = %v, want ErrEncrypted", err)
+	}
+	if _, _, err := readPDF([]byte("<html></html>")); err == nil {
+		t.Error("readPDF of html succeeded")
+	}
+}
+
+func TestParseCMapBounded(t *testing.T) {
+	// Ranges of 0x10000 codes each, more than any font has glyphs
+	data := []byte("begincmap\n")
+	for i := range 8 {
+		data = append(data, []byte("1 beginbfrange\n<"+string("01234567"[i])+"0000> <"+string("01234567"[i])+"FFFF> <0041>\nendbfrange\n")...)
+	}
+	if c := parseCMap(data); len(c.codes) > maxCMapCodes {
+		t.Errorf("parseCMap kept %d codes, want at most %d", len(c.codes), maxCMapCodes)
+	}
+}
+
+func FuzzReadPDF(f *testing.F) {
+	seeds, err := filepath.Glob(filepath.Join("testdata", "*.pdf"))
+	if err != nil {
+		f.Fatal(err)
+	}
+	for _, s := range seeds {
+		data, err := os.ReadFile(s)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(data)
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		readPDF(data)
+	})
+}
@@ -0,0 +1,175 @@
+//go:generate msgp -tests=false
+
+// Package media proxies images shown with search results so that browsers
+// never contact third-party hosts directly.
+package media
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/AletisSearch/aletis/internal/cache"
+	"github.com/AletisSearch/aletis/internal/egress"
+	"github.com/AletisSearch/aletis/internal/metrics"
+	"github.com/AletisSearch/aletis/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+const (
+	// MaxWidth is the largest width images can be resized to.
+	MaxWidth = 1024
+	maxBytes = 5 << 20
+	// maxPixels guards against images that are small on the wire but huge
+	// once decoded.
+	maxPixels = 40_000_000
+)
+
+var (
+	ErrBadURL         = errors.New("bad media url")
+	ErrBadContentType = errors.New("bad content type")
+	ErrTooLarge       = errors.New("media too large")
+)
+
+// allowedTypes are the image formats passed through. SVG is left out as it
+// can carry scripts.
+var allowedTypes = []string{"image/jpeg", "image/png", "image/gif", "image/webp", "image/avif"}
+
+type Image struct {
+	ContentType string
+	Bytes       []byte
+	Expiration  time.Duration
+}
+
+type Proxy struct {
+	httpClient *http.Client
+	cache      *cache.Cache[Image, *Image]
+}
+
+func New(store cache.Store, f *egress.Factory) *Proxy {
+	return &Proxy{
+		httpClient: f.Client(egress.WithMaxBodyBytes(maxBytes)),
+		cache: cache.New[Image](store, cache.Namespace{Name: "media", Version: "1"},
+			cache.WithStaleWhileRevalidate(time.Hour*24),
+			cache.WithNegativeCache(time.Minute*5),
+		),
+	}
+}
+
+// Get returns the image at rawURL, scaled down to width when it is wider.
+// A zero width keeps the original.
+func (p *Proxy) Get(ctx context.Context, rawURL string, width int) (*Image, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, ErrBadURL
+	}
+	if width < 0 || width > MaxWidth {
+		return nil, fmt.Errorf("%w: width %d", ErrBadURL, width)
+	}
+	cacheKey := fmt.Sprintf("%d-%s", width, u)
+	return p.cache.GetOrFetch(ctx, cacheKey, func(ctx context.Context) (*Image, time.Duration, error) {
+		return p.fetch(ctx, u.String(), width)
+	})
+}
+
+func (p *Proxy) fetch(ctx context.Context, rawURL string, width int) (_ *Image, _ time.Duration, err error) {
+	ctx, span := tracing.Start(ctx, "media.Fetch", attribute.Int("media.width", width))
+	defer func() { tracing.End(span, err) }()
+
+	start := time.Now()
+	defer func() { metrics.ObserveMedia(time.Since(start), err) }()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+	req.Header.Set("Accept", strings.Join(allowedTypes, ", "))
+	res, err := p.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, 0, fmt.Errorf("unable to fetch media status: %d", res.StatusCode)
+	}
+	data, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// The declared type is only trusted for formats the sniffer can't detect
+	ct := http.DetectContentType(data)
+	if ct == "application/octet-stream" {
+		ct, _, _ = strings.Cut(res.Header.Get("Content-Type"), ";")
+		ct = strings.TrimSpace(strings.ToLower(ct))
+	}
+	if !slices.Contains(allowedTypes, ct) {
+		return nil, 0, fmt.Errorf("%w: %s", ErrBadContentType, ct)
+	}
+
+	i := &Image{ContentType: ct, Bytes: data, Expiration: time.Hour * 24 * 7}
+	if width > 0 {
+		if err := i.resize(width); err != nil {
+			return nil, 0, err
+		}
+	}
+	return i, i.Expiration, nil
+}
+
+// resize scales the image down to width and re-encodes it, which also drops
+// any metadata. Formats that can't be decoded are served as they are.
+func (i *Image) resize(width int) error {
+	conf, format, err := image.DecodeConfig(bytes.NewReader(i.Bytes))
+	if err != nil {
+		if errors.Is(err, image.ErrFormat) {
+			return nil
+		}
+		return err
+	}
+	if conf.Width*conf.Height > maxPixels {
+		return fmt.Errorf("%w: %dx%d", ErrTooLarge, conf.Width, conf.Height)
+	}
+	if conf.Width <= width {
+		return nil
+	}
+	src, _, err := image.Decode(bytes.NewReader(i.Bytes))
+	if err != nil {
+		return err
+	}
+	height := max(conf.Height*width/conf.Width, 1)
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	draw.ApproxBiLinear.Scale(dst, dst.Bounds(), src, src.Bounds(), draw.Src, nil)
+
+	var buf bytes.Buffer
+	switch format {
+	case "png", "gif":
+		// Keep transparency
+		err = png.Encode(&buf, dst)
+		i.ContentType = "image/png"
+	default:
+		err = jpeg.Encode(&buf, dst, &jpeg.Options{Quality: 80})
+		i.ContentType = "image/jpeg"
+	}
+	if err != nil {
+		return err
+	}
+	i.Bytes = buf.Bytes()
+	return nil
+}
+
+func (p *Proxy) Close() {
+	p.httpClient.CloseIdleConnections()
+}
@@ -0,0 +1,179 @@
+package media
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func encode(t *testing.T, format string, width, height int) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "png":
+		err = png.Encode(&buf, img)
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, nil)
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+// pngHeader returns the start of a PNG declaring the given size, which is
+// all image.DecodeConfig reads.
+func pngHeader(width, height uint32) []byte {
+	ihdr := binary.BigEndian.AppendUint32([]byte("IHDR"), width)
+	ihdr = binary.BigEndian.AppendUint32(ihdr, height)
+	ihdr = append(ihdr, 8, 2, 0, 0, 0)
+	b := []byte("\x89PNG\r\n\x1a\n")
+	b = binary.BigEndian.AppendUint32(b, uint32(len(ihdr)-4))
+	b = append(b, ihdr...)
+	return binary.BigEndian.AppendUint32(b, crc32.ChecksumIEEE(ihdr))
+}
+
+func TestFetch(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		contentType string
+		body        []byte
+		width       int
+		wantType    string
+		wantWidth   int
+		wantErr     error
+	}{
+		{
+			name:      "png kept",
+			body:      encode(t, "png", 40, 20),
+			wantType:  "image/png",
+			wantWidth: 40,
+		},
+		{
+			name:      "png narrower than width",
+			body:      encode(t, "png", 40, 20),
+			width:     100,
+			wantType:  "image/png",
+			wantWidth: 40,
+		},
+		{
+			name:      "jpeg scaled down",
+			body:      encode(t, "jpeg", 400, 200),
+			width:     100,
+			wantType:  "image/jpeg",
+			wantWidth: 100,
+		},
+		{
+			name:      "gif scaled down to png",
+			body:      encode(t, "gif", 400, 200),
+			width:     100,
+			wantType:  "image/png",
+			wantWidth: 100,
+		},
+		{
+			name:        "declared type ignored for sniffed formats",
+			contentType: "image/webp",
+			body:        encode(t, "png", 40, 20),
+			wantType:    "image/png",
+			wantWidth:   40,
+		},
+		{
+			name:        "declared avif",
+			contentType: "image/avif; charset=binary",
+			body:        []byte("\x00\x00\x00\x1cftypavif"),
+			width:       100,
+			wantType:    "image/avif",
+		},
+		{
+			name:        "html served as an image",
+			contentType: "image/png",
+			body:        []byte("<html><script>alert(1)</script></html>"),
+			wantErr:     ErrBadContentType,
+		},
+		{
+			name:        "svg",
+			contentType: "image/svg+xml",
+			body:        []byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`),
+			wantErr:     ErrBadContentType,
+		},
+		{
+			name:        "unknown binary",
+			contentType: "application/octet-stream",
+			body:        []byte{0, 1, 2, 3},
+			wantErr:     ErrBadContentType,
+		},
+		{
+			name:    "too many pixels to decode",
+			body:    pngHeader(10000, 10000),
+			width:   100,
+			wantErr: ErrTooLarge,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if tt.contentType != "" {
+					w.Header().Set("Content-Type", tt.contentType)
+				}
+				w.Write(tt.body)
+			}))
+			t.Cleanup(srv.Close)
+			p := &Proxy{httpClient: srv.Client()}
+
+			i, _, err := p.fetch(context.Background(), srv.URL, tt.width)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Fatalf("fetch = %v, want %v", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if i.ContentType != tt.wantType {
+				t.Errorf("ContentType = %q, want %q", i.ContentType, tt.wantType)
+			}
+			if tt.wantWidth == 0 {
+				return
+			}
+			conf, _, err := image.DecodeConfig(bytes.NewReader(i.Bytes))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if conf.Width != tt.wantWidth {
+				t.Errorf("width = %d, want %d", conf.Width, tt.wantWidth)
+			}
+		})
+	}
+}
+
+func TestGetRefused(t *testing.T) {
+	p := &Proxy{}
+	for _, tt := range []struct {
+		url   string
+		width int
+	}{
+		{"javascript:alert(1)", 0},
+		{"file:///etc/passwd", 0},
+		{"//example.com/a.png", 0},
+		{"https:///a.png", 0},
+		{"https://example.com/a.png", -1},
+		{"https://example.com/a.png", MaxWidth + 1},
+	} {
+		if _, err := p.Get(context.Background(), tt.url, tt.width); !errors.Is(err, ErrBadURL) {
+			t.Errorf("Get(%q, %d) = %v, want ErrBadURL", tt.url, tt.width, err)
+		}
+	}
+}
@@ -0,0 +1,351 @@
+// Package metrics exposes Prometheus metrics for the search, AI, cache and
+// icon subsystems. They are served on their own port so that they are never
+// reachable through the public listener.
+package metrics
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/AletisSearch/aletis/internal/cache"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-chi/chi/v5/middleware"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "aletis"
+
+var registry = prometheus.NewRegistry()
+
+var (
+	httpDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "http_request_duration_seconds",
+		Help:      "Time to serve HTTP requests by route.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"route", "method", "code"})
+
+	searxngDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "searxng_request_duration_seconds",
+		Help:      "Time taken by SearXNG to answer a search.",
+		Buckets:   []float64{.1, .25, .5, 1, 2, 4, 8, 16},
+	}, []string{"upstream"})
+	searxngErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "searxng_errors_total",
+		Help:      "SearXNG requests that failed.",
+	}, []string{"upstream"})
+	searxngRetries = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "searxng_retries_total",
+		Help:      "Searches retried on another SearXNG upstream.",
+	})
+	searxngHealthy = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "searxng_upstream_healthy",
+		Help:      "Whether the last health check of a SearXNG upstream passed.",
+	}, []string{"upstream"})
+	searxngBreaker = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "searxng_upstream_breaker_state",
+		Help:      "Circuit breaker of a SearXNG upstream: 0 closed, 1 half-open, 2 open.",
+	}, []string{"upstream"})
+	searxngUnresponsive = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "searxng_unresponsive_engines_total",
+		Help:      "Engines reported unresponsive by SearXNG.",
+	}, []string{"engine", "reason"})
+
+	llmDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "llm_request_duration_seconds",
+		Help:      "Time taken by the LLM to answer.",
+		Buckets:   []float64{.25, .5, 1, 2, 4, 8, 16, 32},
+	}, []string{"model"})
+	llmErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "llm_errors_total",
+		Help:      "LLM requests that failed.",
+	}, []string{"model"})
+	llmTokens = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "llm_tokens_total",
+		Help:      "Tokens used by LLM requests.",
+	}, []string{"model", "type"})
+	llmCost = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "llm_cost_dollars_total",
+		Help:      "Cost of LLM requests as reported by the provider.",
+	}, []string{"model"})
+
+	iconDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "icon_fetch_duration_seconds",
+		Help:      "Time taken to fetch a favicon.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2, 4},
+	})
+	iconErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "icon_fetch_errors_total",
+		Help:      "Favicon fetches that failed.",
+	})
+
+	mediaDuration = prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "media_fetch_duration_seconds",
+		Help:      "Time taken to fetch a proxied image.",
+		Buckets:   []float64{.05, .1, .25, .5, 1, 2, 4},
+	})
+	mediaErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "media_fetch_errors_total",
+		Help:      "Proxied image fetches that failed.",
+	})
+
+	rateLimitRejections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "rate_limit_rejections_total",
+		Help:      "Requests rejected by a rate limit or quota.",
+	}, []string{"route"})
+
+	cleanupRuns = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cleanup_runs_total",
+		Help:      "Runs of the database cleanup jobs by result.",
+	}, []string{"job", "result"})
+	cacheEvicted = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "cache_evicted_total",
+		Help:      "Cache rows evicted to keep the table within its budget.",
+	})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		httpDuration,
+		searxngDuration,
+		searxngErrors,
+		searxngRetries,
+		searxngHealthy,
+		searxngBreaker,
+		searxngUnresponsive,
+		llmDuration,
+		llmErrors,
+		llmTokens,
+		llmCost,
+		iconDuration,
+		iconErrors,
+		mediaDuration,
+		mediaErrors,
+		rateLimitRejections,
+		cleanupRuns,
+		cacheEvicted,
+		cacheCollector{},
+	)
+}
+
+// Handler serves the metrics in the Prometheus exposition format.
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{Registry: registry})
+}
+
+// RegisterPool exports the connection statistics of the database pool.
+func RegisterPool(pool *pgxpool.Pool) {
+	registry.MustRegister(poolCollector{pool: pool})
+}
+
+// Middleware records the duration of requests under their route pattern so
+// that the label values stay bounded. It goes inside the panic recoverer;
+// requests that panic are recorded as the 500 the recoverer answers with.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+		status := http.StatusInternalServerError
+		defer func() {
+			route := chi.RouteContext(r.Context()).RoutePattern()
+			if route == "" {
+				route = "unmatched"
+			}
+			httpDuration.WithLabelValues(route, r.Method, strconv.Itoa(status)).Observe(time.Since(start).Seconds())
+		}()
+		next.ServeHTTP(ww, r)
+		status = ww.Status()
+	})
+}
+
+func ObserveSearxng(upstream string, d time.Duration, err error) {
+	searxngDuration.WithLabelValues(upstream).Observe(d.Seconds())
+	if err != nil {
+		searxngErrors.WithLabelValues(upstream).Inc()
+	}
+}
+
+func SearxngRetry() {
+	searxngRetries.Inc()
+}
+
+func SearxngUpstream(upstream string, healthy bool, breaker int) {
+	var h float64
+	if healthy {
+		h = 1
+	}
+	searxngHealthy.WithLabelValues(upstream).Set(h)
+	searxngBreaker.WithLabelValues(upstream).Set(float64(breaker))
+}
+
+func UnresponsiveEngine(engine, reason string) {
+	searxngUnresponsive.WithLabelValues(engine, engineReason(reason)).Inc()
+}
+
+// engineReason maps the free text SearXNG gives as the reason an engine
+// didn't answer onto a fixed set of label values.
+func engineReason(reason string) string {
+	reason = strings.ToLower(reason)
+	switch {
+	case strings.Contains(reason, "timeout"):
+		return "timeout"
+	case strings.Contains(reason, "captcha"):
+		return "captcha"
+	case strings.Contains(reason, "too many requests"):
+		return "too_many_requests"
+	case strings.Contains(reason, "access denied"):
+		return "access_denied"
+	case strings.Contains(reason, "ssl"):
+		return "ssl"
+	case strings.Contains(reason, "http"):
+		return "http"
+	case strings.Contains(reason, "network"):
+		return "network"
+	case strings.Contains(reason, "parsing"):
+		return "parsing"
+	case strings.Contains(reason, "crash"):
+		return "crash"
+	case strings.Contains(reason, "suspended"):
+		return "suspended"
+	}
+	return "other"
+}
+
+func ObserveLLM(model string, d time.Duration, err error) {
+	llmDuration.WithLabelValues(model).Observe(d.Seconds())
+	if err != nil {
+		llmErrors.WithLabelValues(model).Inc()
+	}
+}
+
+func LLMUsage(model string, promptTokens, completionTokens int64, cost float64) {
+	llmTokens.WithLabelValues(model, "prompt").Add(float64(promptTokens))
+	llmTokens.WithLabelValues(model, "completion").Add(float64(completionTokens))
+	llmCost.WithLabelValues(model).Add(cost)
+}
+
+func ObserveIcon(d time.Duration, err error) {
+	iconDuration.Observe(d.Seconds())
+	if err != nil {
+		iconErrors.Inc()
+	}
+}
+
+func ObserveMedia(d time.Duration, err error) {
+	mediaDuration.Observe(d.Seconds())
+	if err != nil {
+		mediaErrors.Inc()
+	}
+}
+
+func RateLimitRejected(route string) {
+	rateLimitRejections.WithLabelValues(route).Inc()
+}
+
+func CleanupRun(job string, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	cleanupRuns.WithLabelValues(job, result).Inc()
+}
+
+func CacheEvicted(n int64) {
+	cacheEvicted.Add(float64(n))
+}
+
+var cacheRequestsDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "cache", "requests_total"),
+	"Cache lookups by namespace and result.",
+	[]string{"namespace", "result"}, nil,
+)
+
+// cacheCollector reads the counters kept by the cache package so they don't
+// have to be counted twice.
+type cacheCollector struct{}
+
+func (cacheCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- cacheRequestsDesc
+}
+
+func (cacheCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, s := range cache.Statistics() {
+		ch <- prometheus.MustNewConstMetric(cacheRequestsDesc, prometheus.CounterValue, float64(s.Hits), s.Namespace, "hit")
+		ch <- prometheus.MustNewConstMetric(cacheRequestsDesc, prometheus.CounterValue, float64(s.StaleHits), s.Namespace, "stale")
+		ch <- prometheus.MustNewConstMetric(cacheRequestsDesc, prometheus.CounterValue, float64(s.Misses), s.Namespace, "miss")
+	}
+}
+
+var (
+	poolAcquiredDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "db_pool", "acquired_connections"),
+		"Connections currently in use.", nil, nil,
+	)
+	poolIdleDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "db_pool", "idle_connections"),
+		"Connections currently idle.", nil, nil,
+	)
+	poolTotalDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "db_pool", "total_connections"),
+		"Connections currently open.", nil, nil,
+	)
+	poolMaxDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "db_pool", "max_connections"),
+		"Maximum size of the pool.", nil, nil,
+	)
+	poolAcquireDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "db_pool", "acquires_total"),
+		"Connections acquired from the pool.", nil, nil,
+	)
+	poolEmptyAcquireDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "db_pool", "empty_acquires_total"),
+		"Acquires that had to wait for a connection.", nil, nil,
+	)
+	poolAcquireDurationDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "db_pool", "acquire_duration_seconds_total"),
+		"Time spent acquiring connections.", nil, nil,
+	)
+)
+
+type poolCollector struct {
+	pool *pgxpool.Pool
+}
+
+func (c poolCollector) Describe(ch chan<- *prometheus.Desc) {
+	prometheus.DescribeByCollect(c, ch)
+}
+
+func (c poolCollector) Collect(ch chan<- prometheus.Metric) {
+	s := c.pool.Stat()
+	ch <- prometheus.MustNewConstMetric(poolAcquiredDesc, prometheus.GaugeValue, float64(s.AcquiredConns()))
+	ch <- prometheus.MustNewConstMetric(poolIdleDesc, prometheus.GaugeValue, float64(s.IdleConns()))
+	ch <- prometheus.MustNewConstMetric(poolTotalDesc, prometheus.GaugeValue, float64(s.TotalConns()))
+	ch <- prometheus.MustNewConstMetric(poolMaxDesc, prometheus.GaugeValue, float64(s.MaxConns()))
+	ch <- prometheus.MustNewConstMetric(poolAcquireDesc, prometheus.CounterValue, float64(s.AcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolEmptyAcquireDesc, prometheus.CounterValue, float64(s.EmptyAcquireCount()))
+	ch <- prometheus.MustNewConstMetric(poolAcquireDurationDesc, prometheus.CounterValue, s.AcquireDuration().Seconds())
+}
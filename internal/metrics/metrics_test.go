@@ -0,0 +1,28 @@
+package metrics
+
+import "testing"
+
+func TestEngineReason(t *testing.T) {
+	for _, tt := range []struct {
+		reason string
+		want   string
+	}{
+		{"timeout", "timeout"},
+		{"HTTP error", "http"},
+		{"HTTP protocol error", "http"},
+		{"Suspended: CAPTCHA", "captcha"},
+		{"Suspended: too many requests", "too_many_requests"},
+		{"Suspended: access denied", "access_denied"},
+		{"SSL error: certificate verify failed", "ssl"},
+		{"network error", "network"},
+		{"parsing error", "parsing"},
+		{"unexpected crash", "crash"},
+		{"Suspended", "suspended"},
+		{"unavailable", "other"},
+		{"", "other"},
+	} {
+		if got := engineReason(tt.reason); got != tt.want {
+			t.Errorf("engineReason(%q) = %q, want %q", tt.reason, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+// Package querylog counts how many people search queries, without recording
+// who searched them, so that spelling correction and autocomplete can learn
+// from what people search on this instance. Clients are only told apart
+// within a day, by a hash keyed with a salt that is deleted once the day is
+// over.
+package querylog
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"net"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/AletisSearch/aletis/internal/db"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+const (
+	// maxQueryLength keeps pasted text out of the log.
+	maxQueryLength = 100
+	// minSearches keeps queries searched by only a few people private; they
+	// are never returned as popular. Searches count once per client and
+	// day, so that one person searching a query again doesn't publish it.
+	minSearches = 20
+	// repeatedMinSearches is how many people search a query before its
+	// words are taken as real terms. Typos are rarely searched twice.
+	repeatedMinSearches = 2
+	// saltTTL is how long the salt of the day is used before it is read
+	// again, to follow the day changing.
+	saltTTL = time.Minute
+)
+
+// QueryLog keeps a count of searches per query and day.
+type QueryLog struct {
+	q *db.Queries
+
+	mu          sync.Mutex
+	salt        []byte
+	saltExpires time.Time
+}
+
+func New(q *db.Queries) *QueryLog {
+	return &QueryLog{q: q}
+}
+
+// Normalize lowercases query and collapses its spaces, so that queries
+// differing only in those are counted together.
+func Normalize(query string) string {
+	return strings.Join(strings.Fields(strings.ToLower(query)), " ")
+}
+
+// Record counts a search of query by client, the address of who searched
+// it, unless client already searched it today.
+func (l *QueryLog) Record(ctx context.Context, query, client string) error {
+	query = Normalize(query)
+	if query == "" || utf8.RuneCountInString(query) > maxQueryLength {
+		return nil
+	}
+	salt, err := l.daySalt(ctx)
+	if err != nil {
+		return err
+	}
+	if host, _, err := net.SplitHostPort(client); err == nil {
+		client = host
+	}
+	mac := hmac.New(sha256.New, salt)
+	mac.Write([]byte(client))
+	return l.q.IncrementQueryLog(ctx, db.IncrementQueryLogParams{
+		Query:  query,
+		Client: mac.Sum(nil)[:16],
+	})
+}
+
+// daySalt returns the salt of the day, shared by all replicas through the
+// database.
+func (l *QueryLog) daySalt(ctx context.Context) ([]byte, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.salt != nil && time.Now().Before(l.saltExpires) {
+		return l.salt, nil
+	}
+	salt, err := l.q.GetQueryLogSalt(ctx, []byte(rand.Text()))
+	if err != nil {
+		return nil, err
+	}
+	l.salt, l.saltExpires = salt, time.Now().Add(saltTTL)
+	return salt, nil
+}
+
+// Popular returns up to limit of the queries searched most within window.
+func (l *QueryLog) Popular(ctx context.Context, window time.Duration, limit int32) ([]db.ListPopularQueriesRow, error) {
+	return l.q.ListPopularQueries(ctx, db.ListPopularQueriesParams{
+		Since:       pgtype.Date{Time: time.Now().Add(-window), Valid: true},
+		MinSearches: minSearches,
+		MaxRows:     limit,
+	})
+}
+
+// Repeated returns up to limit of the queries searched again within window.
+// Unlike popular queries they may be private, and must not be shown.
+func (l *QueryLog) Repeated(ctx context.Context, window time.Duration, limit int32) ([]db.ListPopularQueriesRow, error) {
+	return l.q.ListPopularQueries(ctx, db.ListPopularQueriesParams{
+		Since:       pgtype.Date{Time: time.Now().Add(-window), Valid: true},
+		MinSearches: repeatedMinSearches,
+		MaxRows:     limit,
+	})
+}
+
+// Cleanup deletes the counts of days past retention, and the clients and
+// salts of past days.
+func (l *QueryLog) Cleanup(ctx context.Context, retention time.Duration) error {
+	if err := l.q.DeleteOldQueryLogClients(ctx); err != nil {
+		return err
+	}
+	return l.q.DeleteOldQueryLog(ctx, pgtype.Date{Time: time.Now().Add(-retention), Valid: true})
+}
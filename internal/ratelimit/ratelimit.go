@@ -0,0 +1,105 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/AletisSearch/aletis/internal/config"
+	"github.com/AletisSearch/aletis/internal/db"
+	"github.com/go-chi/httprate"
+)
+
+// Store keeps the per-window request counters used by the sliding window
+// limiter. Each route gets its own Store since httprate configures the window
+// length on it.
+type Store interface {
+	httprate.LimitCounter
+}
+
+// NewStore returns a Store for the given route using the configured backend.
+func NewStore(conf *config.Config, q *db.Queries, route string) (Store, error) {
+	switch conf.RateLimitStore {
+	case config.RateLimitStoreMemory:
+		return httprate.NewLocalLimitCounter(time.Minute), nil
+	case config.RateLimitStorePostgres:
+		return NewPostgresStore(q, route), nil
+	}
+	return nil, fmt.Errorf("unknown rate limit store: %q", conf.RateLimitStore)
+}
+
+// Limit limits requests to a route per client IP.
+func Limit(route string, limit config.RateLimit, store Store) func(http.Handler) http.Handler {
+	if limit.Requests == 0 {
+		return func(next http.Handler) http.Handler { return next }
+	}
+	return httprate.Limit(limit.Requests, limit.Window,
+		httprate.WithKeyByIP(),
+		httprate.WithLimitCounter(store),
+		httprate.WithErrorHandler(ErrorHandler),
+		httprate.WithLimitHandler(LimitHandler(route)),
+	)
+}
+
+// ErrorHandler responds to requests whose limit couldn't be checked, such as
+// when the store is unreachable, without showing the error to the client.
+func ErrorHandler(w http.ResponseWriter, r *http.Request, err error) {
+	slog.Error("unable to check rate limit", "Path", r.URL.Path, "ERROR", err)
+	http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+}
+
+var _ Store = (*PostgresStore)(nil)
+
+// PostgresStore shares counters between replicas through the rate_limits
+// table. httprate reads the counters with Get and increments them with
+// IncrementBy once the request is allowed; between the two, other replicas
+// could let the same requests through. Get therefore takes the request in
+// the same statement that reads the counters, and IncrementBy only adds
+// what exceeds it. Rejected requests stay counted.
+type PostgresStore struct {
+	q       *db.Queries
+	route   string
+	timeout time.Duration
+}
+
+func NewPostgresStore(q *db.Queries, route string) *PostgresStore {
+	return &PostgresStore{q: q, route: route, timeout: time.Second * 2}
+}
+
+func (s *PostgresStore) Config(requestLimit int, windowLength time.Duration) {}
+
+func (s *PostgresStore) Increment(key string, currentWindow time.Time) error {
+	return s.IncrementBy(key, currentWindow, 1)
+}
+
+// IncrementBy adds amount to the counter of the current window, less the
+// request already taken by Get.
+func (s *PostgresStore) IncrementBy(key string, currentWindow time.Time, amount int) error {
+	if amount <= 1 {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	return s.q.IncrementRateLimit(ctx, db.IncrementRateLimitParams{
+		Key:         s.route + "-" + key,
+		WindowStart: currentWindow,
+		Count:       int32(amount - 1),
+	})
+}
+
+// Get takes a request and returns the counters as they were before it.
+func (s *PostgresStore) Get(key string, currentWindow, previousWindow time.Time) (int, int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.timeout)
+	defer cancel()
+	r, err := s.q.TakeRateLimit(ctx, db.TakeRateLimitParams{
+		Key:            s.route + "-" + key,
+		CurrentWindow:  currentWindow,
+		PreviousWindow: previousWindow,
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return int(r.CurrentCount) - 1, int(r.PreviousCount), nil
+}
@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"crypto/rand"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AletisSearch/aletis/internal/config"
+	"github.com/AletisSearch/aletis/internal/db/dbtest"
+	"github.com/go-chi/httprate"
+)
+
+func TestMemoryStoreConcurrent(t *testing.T) {
+	testStoreConcurrent(t, httprate.NewLocalLimitCounter(time.Minute))
+}
+
+// TestPostgresStoreReplicas sends requests for the same client through
+// limiters of several replicas sharing the table, and checks that together
+// they let no more than the limit through.
+func TestPostgresStoreReplicas(t *testing.T) {
+	q := dbtest.New(t)
+	const replicas, requests, limit = 8, 20, 50
+	// A fresh route keeps counters of earlier runs out of the way
+	route := "test-" + rand.Text()
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for range replicas {
+		h := Limit(route, config.RateLimit{Requests: limit, Window: time.Hour}, NewPostgresStore(q, route))(
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				allowed.Add(1)
+			}))
+		wg.Go(func() {
+			for range requests {
+				r := httptest.NewRequest(http.MethodGet, "/", nil)
+				r.RemoteAddr = "203.0.113.7:4242"
+				w := httptest.NewRecorder()
+				h.ServeHTTP(w, r)
+				if w.Code != http.StatusOK && w.Code != http.StatusTooManyRequests {
+					t.Errorf("status = %d", w.Code)
+				}
+			}
+		})
+	}
+	wg.Wait()
+	if n := allowed.Load(); n != limit {
+		t.Errorf("allowed %d requests, want %d", n, limit)
+	}
+}
+
+// testStoreConcurrent increments the same counter from many goroutines and
+// checks that no increment is lost and other keys and windows are untouched.
+func testStoreConcurrent(t *testing.T, store Store) {
+	const workers, increments = 16, 25
+	store.Config(workers*increments, time.Minute)
+	current := time.Now().UTC().Truncate(time.Minute)
+	previous := current.Add(-time.Minute)
+
+	if err := store.IncrementBy("client", previous, 3); err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	errs := make(chan error, workers)
+	for range workers {
+		wg.Go(func() {
+			for range increments {
+				if err := store.Increment("client", current); err != nil {
+					errs <- err
+					return
+				}
+			}
+		})
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+
+	cur, prev, err := store.Get("client", current, previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cur != workers*increments || prev != 3 {
+		t.Errorf("Get = %d, %d, want %d, 3", cur, prev, workers*increments)
+	}
+	cur, prev, err = store.Get("other", current, previous)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cur != 0 || prev != 0 {
+		t.Errorf("Get of another key = %d, %d, want 0, 0", cur, prev)
+	}
+}
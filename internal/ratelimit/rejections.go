@@ -0,0 +1,39 @@
+package ratelimit
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/AletisSearch/aletis/internal/metrics"
+)
+
+var rejections sync.Map
+
+// Reject records a rejected request for route. Counts are per process and
+// reset on restart.
+func Reject(route string) {
+	c, _ := rejections.LoadOrStore(route, new(atomic.Uint64))
+	c.(*atomic.Uint64).Add(1)
+	metrics.RateLimitRejected(route)
+}
+
+// Rejections returns the number of rejected requests per route since the
+// process started.
+func Rejections() map[string]uint64 {
+	out := map[string]uint64{}
+	rejections.Range(func(k, v any) bool {
+		out[k.(string)] = v.(*atomic.Uint64).Load()
+		return true
+	})
+	return out
+}
+
+// LimitHandler responds to rate limited requests the same way httprate does
+// while counting them.
+func LimitHandler(route string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		Reject(route)
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+	}
+}
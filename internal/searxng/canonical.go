@@ -0,0 +1,187 @@
+package searxng
+
+import (
+	"net"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+// trackingParams are query parameters that only identify where a visitor
+// came from. Parameters starting with utm_ are dropped as well.
+var trackingParams = map[string]bool{
+	"fbclid":      true,
+	"gclid":       true,
+	"gclsrc":      true,
+	"dclid":       true,
+	"gbraid":      true,
+	"wbraid":      true,
+	"msclkid":     true,
+	"yclid":       true,
+	"twclid":      true,
+	"ttclid":      true,
+	"igshid":      true,
+	"mc_cid":      true,
+	"mc_eid":      true,
+	"_hsenc":      true,
+	"_hsmi":       true,
+	"mkt_tok":     true,
+	"oly_anon_id": true,
+	"oly_enc_id":  true,
+	"vero_id":     true,
+	"ref_src":     true,
+	"ref_url":     true,
+	"_ga":         true,
+	"_gl":         true,
+}
+
+// CanonicalURL removes tracking parameters from raw and turns pages on AMP
+// caches into the pages they were made from. The host is lowercased and
+// default ports are dropped. URLs that can't be parsed are returned as they
+// are.
+func CanonicalURL(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return raw
+	}
+	u = deAMP(u)
+	u.Host = canonicalHost(u)
+
+	if u.RawQuery != "" {
+		q := u.Query()
+		for k := range q {
+			if trackingParams[strings.ToLower(k)] || strings.HasPrefix(strings.ToLower(k), "utm_") {
+				q.Del(k)
+			}
+		}
+		// Only re-encode when something was removed so that the order of
+		// the parameters is kept otherwise
+		if len(q) != len(u.Query()) {
+			u.RawQuery = q.Encode()
+		}
+	}
+	if u.Path == "" {
+		u.Path = "/"
+	}
+	return u.String()
+}
+
+func canonicalHost(u *url.URL) string {
+	host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	port := u.Port()
+	if port == "" || (u.Scheme == "https" && port == "443") || (u.Scheme == "http" && port == "80") {
+		if strings.Contains(host, ":") {
+			return "[" + host + "]"
+		}
+		return host
+	}
+	return net.JoinHostPort(host, port)
+}
+
+// deAMP returns the page an AMP page was made from when u is on an AMP
+// cache, which serves pages of other sites under its own host. Sites' own
+// /amp paths and amp parameters are left alone, as they can't be told from
+// paths and parameters that mean something else.
+func deAMP(u *url.URL) *url.URL {
+	host := strings.ToLower(u.Hostname())
+	switch {
+	case strings.HasSuffix(host, ".cdn.ampproject.org"):
+		// /c/s/example.com/page is https://example.com/page, /c/ is http
+		if rest, ok := strings.CutPrefix(u.Path, "/c/s/"); ok {
+			return origin("https", rest, u)
+		}
+		if rest, ok := strings.CutPrefix(u.Path, "/c/"); ok {
+			return origin("http", rest, u)
+		}
+	case host == "google.com" || strings.HasPrefix(host, "www.google."):
+		if rest, ok := strings.CutPrefix(u.Path, "/amp/s/"); ok {
+			return origin("https", rest, u)
+		}
+	}
+	return u
+}
+
+// origin builds the URL of the page whose host and path are in rest.
+func origin(scheme, rest string, u *url.URL) *url.URL {
+	o, err := url.Parse(scheme + "://" + rest)
+	if err != nil || o.Host == "" {
+		return u
+	}
+	o.RawQuery = u.RawQuery
+	o.Fragment = u.Fragment
+	return o
+}
+
+// dedupeKey identifies the page at a canonical URL regardless of the scheme,
+// a www. prefix, a trailing slash, the fragment and the order of parameters.
+func dedupeKey(canonical string) string {
+	u, err := url.Parse(canonical)
+	if err != nil {
+		return canonical
+	}
+	host := strings.TrimPrefix(u.Host, "www.")
+	path := strings.TrimSuffix(u.EscapedPath(), "/")
+	key := host + path
+	if u.RawQuery != "" {
+		// Encode sorts the parameters by name
+		key += "?" + u.Query().Encode()
+	}
+	return key
+}
+
+// DedupeKey identifies the page at raw, so that results of different
+// sources can be matched.
+func DedupeKey(raw string) string {
+	return dedupeKey(CanonicalURL(raw))
+}
+
+// mergeDuplicates canonicalizes the URLs of results and merges the results
+// that point at the same page. Merged results count every engine and
+// position that returned them and add up their scores, so they rank as a
+// single result found by all those engines.
+func mergeDuplicates(results []Result) []Result {
+	out := make([]Result, 0, len(results))
+	seen := make(map[string]int, len(results))
+	for _, r := range results {
+		r.URL = CanonicalURL(r.URL)
+		u, err := url.Parse(r.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+			// Nothing to compare other kinds of links by, such as magnets
+			out = append(out, r)
+			continue
+		}
+		r.ParsedURL = [6]string{u.Scheme, u.Host, u.EscapedPath(), "", u.RawQuery, u.Fragment}
+		key := dedupeKey(r.URL)
+		i, ok := seen[key]
+		if !ok {
+			seen[key] = len(out)
+			out = append(out, r)
+			continue
+		}
+		merged := &out[i]
+		for _, e := range r.Engines {
+			if !slices.Contains(merged.Engines, e) {
+				merged.Engines = append(merged.Engines, e)
+			}
+		}
+		merged.Positions = append(merged.Positions, r.Positions...)
+		merged.Score += r.Score
+		// Prefer the secure version of the page
+		if merged.ParsedURL[0] == "http" && r.ParsedURL[0] == "https" {
+			merged.URL, merged.ParsedURL = r.URL, r.ParsedURL
+		}
+		if merged.Content == "" {
+			merged.Content = r.Content
+		}
+		if merged.Thumbnail == "" {
+			merged.Thumbnail = r.Thumbnail
+		}
+		if merged.ImgSrc == "" {
+			merged.ImgSrc = r.ImgSrc
+		}
+		if merged.PublishedDate == nil {
+			merged.PublishedDate = r.PublishedDate
+		}
+	}
+	return out
+}
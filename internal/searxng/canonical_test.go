@@ -0,0 +1,106 @@
+package searxng
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCanonicalURL(t *testing.T) {
+	for _, tt := range []struct {
+		raw  string
+		want string
+	}{
+		{"https://example.com", "https://example.com/"},
+		{"https://Example.COM./page", "https://example.com/page"},
+		{"https://example.com:443/page", "https://example.com/page"},
+		{"http://example.com:80/page", "http://example.com/page"},
+		{"https://example.com:8443/page", "https://example.com:8443/page"},
+		{"https://[2001:DB8::1]:443/page", "https://[2001:db8::1]/page"},
+		{"https://example.com/page?utm_source=x&UTM_Medium=y", "https://example.com/page"},
+		{"https://example.com/page?b=2&fbclid=x&a=1", "https://example.com/page?a=1&b=2"},
+		// Nothing removed keeps the order of the parameters
+		{"https://example.com/page?b=2&a=1", "https://example.com/page?b=2&a=1"},
+		{"https://example-com.cdn.ampproject.org/c/s/example.com/page?x=1#top", "https://example.com/page?x=1#top"},
+		{"https://example-com.cdn.ampproject.org/c/example.com/page", "http://example.com/page"},
+		{"https://www.google.com/amp/s/example.com/page", "https://example.com/page"},
+		// Sites' own AMP pages are left alone
+		{"https://example.com/amp/page?amp=1", "https://example.com/amp/page?amp=1"},
+		{"magnet:?xt=urn:btih:abc&utm_source=x", "magnet:?xt=urn:btih:abc&utm_source=x"},
+		{"https://example.com/%zz", "https://example.com/%zz"},
+		{"/relative", "/relative"},
+	} {
+		if got := CanonicalURL(tt.raw); got != tt.want {
+			t.Errorf("CanonicalURL(%q) = %q, want %q", tt.raw, got, tt.want)
+		}
+	}
+}
+
+func TestDedupeKey(t *testing.T) {
+	for _, tt := range []struct {
+		a, b string
+		same bool
+	}{
+		{"http://example.com/page", "https://example.com/page", true},
+		{"https://www.example.com/page", "https://example.com/page", true},
+		{"https://example.com/page/", "https://example.com/page", true},
+		{"https://example.com/page#a", "https://example.com/page#b", true},
+		{"https://example.com/page?a=1&b=2", "https://example.com/page?b=2&a=1", true},
+		{"https://example.com/page?utm_source=x", "https://example.com/page", true},
+		{"https://example.com/page", "https://example.com/other", false},
+		{"https://example.com/page?a=1", "https://example.com/page?a=2", false},
+		{"https://example.com/page", "https://example.org/page", false},
+		{"https://example.com:8443/page", "https://example.com/page", false},
+	} {
+		if same := DedupeKey(tt.a) == DedupeKey(tt.b); same != tt.same {
+			t.Errorf("DedupeKey(%q) == DedupeKey(%q) is %v, want %v", tt.a, tt.b, same, tt.same)
+		}
+	}
+}
+
+func TestMergeDuplicates(t *testing.T) {
+	date := &Time{}
+	results := []Result{
+		{URL: "http://www.example.com/page?utm_source=x", Engines: []string{"google"}, Positions: []int{1}, Score: 1},
+		{URL: "https://example.org/", Engines: []string{"bing"}, Positions: []int{2}, Score: 0.5},
+		{URL: "magnet:?xt=urn:btih:abc", Engines: []string{"piratebay"}, Positions: []int{1}, Score: 0.25},
+		{
+			URL:           "https://example.com/page/",
+			Engines:       []string{"bing", "google"},
+			Positions:     []int{1},
+			Score:         2,
+			Content:       "content",
+			Thumbnail:     "https://example.com/thumb.png",
+			PublishedDate: date,
+		},
+		{URL: "magnet:?xt=urn:btih:abc", Engines: []string{"nyaa"}, Positions: []int{3}, Score: 0.25},
+	}
+	got := mergeDuplicates(results)
+
+	want := []Result{
+		{
+			// The secure URL wins, the other fields fill in what the first
+			// result lacks
+			URL:           "https://example.com/page/",
+			ParsedURL:     [6]string{"https", "example.com", "/page/", "", "", ""},
+			Engines:       []string{"google", "bing"},
+			Positions:     []int{1, 1},
+			Score:         3,
+			Content:       "content",
+			Thumbnail:     "https://example.com/thumb.png",
+			PublishedDate: date,
+		},
+		{
+			URL:       "https://example.org/",
+			ParsedURL: [6]string{"https", "example.org", "/", "", "", ""},
+			Engines:   []string{"bing"},
+			Positions: []int{2},
+			Score:     0.5,
+		},
+		// Links that aren't web pages are never merged
+		{URL: "magnet:?xt=urn:btih:abc", Engines: []string{"piratebay"}, Positions: []int{1}, Score: 0.25},
+		{URL: "magnet:?xt=urn:btih:abc", Engines: []string{"nyaa"}, Positions: []int{3}, Score: 0.25},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("mergeDuplicates =\n%+v\nwant\n%+v", got, want)
+	}
+}
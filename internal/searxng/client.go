@@ -5,29 +5,40 @@ import (
 	"encoding/json/v2"
 	"errors"
 	"fmt"
-	"log/slog"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/AletisSearch/aletis/internal/cache"
 	"github.com/AletisSearch/aletis/internal/db"
-	"resty.dev/v3"
+	"github.com/AletisSearch/aletis/internal/egress"
+	"github.com/AletisSearch/aletis/internal/metrics"
+	"github.com/AletisSearch/aletis/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
 )
 
+var ErrBadStatus = errors.New("bad response status")
+
 type Client struct {
-	url         string
-	restyClient *resty.Client
-	cache       *cache.Cache[SearchResponse, *SearchResponse]
+	upstreams []*upstream
+	cache     *cache.Cache[SearchResponse, *SearchResponse]
+	engines   engineHealth
 }
 
-func NewClient(url string, q *db.Queries) *Client {
-	return &Client{
-		url: url,
-		restyClient: resty.New().
-			SetHeader("Accept", "application/json, text/html").
-			SetHeader("Accept-Language", "*").SetBaseURL(url),
-		cache: cache.New[SearchResponse](q),
+// NewClient creates a client spreading searches over the upstreams. Engine
+// failures are shared through q when it is not nil.
+func NewClient(upstreams []Upstream, store cache.Store, q *db.Queries, f *egress.Factory) *Client {
+	c := &Client{
+		engines: engineHealth{q: q},
+		cache: cache.New[SearchResponse](store, cache.Namespace{Name: "search", Version: "5"},
+			cache.WithStaleWhileRevalidate(time.Minute*15),
+			cache.WithNegativeCache(time.Second*30),
+		),
+	}
+	for _, u := range upstreams {
+		c.upstreams = append(c.upstreams, newUpstream(u, f))
 	}
+	return c
 }
 
 func (c *Client) Search(ctx context.Context, query string, page ...int) (*SearchResponse, error) {
@@ -36,41 +47,118 @@ func (c *Client) Search(ctx context.Context, query string, page ...int) (*Search
 		pageno = strconv.Itoa(page[0])
 	}
 
-	cacheKey := "search-" + query + "-" + pageno
-	s, err := c.cache.Get(ctx, cacheKey)
-	if err == nil {
-		slog.Info("Cache Hit", "Key", cacheKey)
-		return s, nil
-	}
-	if !errors.Is(err, cache.ErrNotFoundInCache) && !errors.Is(err, cache.ErrOldCache) {
-		return nil, err
-	}
+	cacheKey := query + "-" + pageno
+	return c.cache.GetOrFetch(ctx, cacheKey, func(ctx context.Context) (*SearchResponse, time.Duration, error) {
+		return c.fetch(ctx, query, page...)
+	})
+}
+
+func (c *Client) fetch(ctx context.Context, query string, page ...int) (_ *SearchResponse, _ time.Duration, err error) {
 	queryParams := map[string]string{
 		"q":      query,
 		"format": "json",
 	}
 	if len(page) != 0 {
-		queryParams["pageno"] = pageno
+		queryParams["pageno"] = strconv.Itoa(page[0])
 	}
 
-	res, err := c.restyClient.R().WithContext(ctx).
-		SetQueryParams(queryParams).
-		Get("/search")
-	if err != nil || res.StatusCode() >= 400 {
-		return nil, fmt.Errorf("unable to fetch searxng response status: %d error: %w", res.StatusCode(), err)
+	ctx, span := tracing.Start(ctx, "searxng.Search",
+		attribute.String("searxng.pageno", queryParams["pageno"]),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	// A failed search is retried on another upstream after a short backoff
+	var tried []*upstream
+	var errs []error
+	var sr *SearchResponse
+	for attempt := range min(maxAttempts, len(c.upstreams)) {
+		if attempt > 0 {
+			metrics.SearxngRetry()
+			select {
+			case <-time.After(retryBackoff << (attempt - 1)):
+			case <-ctx.Done():
+				return nil, 0, errors.Join(append(errs, ctx.Err())...)
+			}
+		}
+		u := c.pick(tried)
+		if u == nil {
+			break
+		}
+		tried = append(tried, u)
+		sr, err = c.fetchFrom(ctx, u, queryParams)
+		if err == nil {
+			span.SetAttributes(attribute.String("searxng.upstream", u.name), attribute.Int("searxng.attempts", attempt+1))
+			break
+		}
+		errs = append(errs, fmt.Errorf("%s: %w", u.name, err))
+	}
+	if sr == nil {
+		if len(errs) == 0 {
+			return nil, 0, ErrNoUpstream
+		}
+		return nil, 0, errors.Join(errs...)
+	}
+
+	for _, e := range sr.UnresponsiveEngines {
+		metrics.UnresponsiveEngine(e.Engine, e.Error)
+	}
+	c.engines.record(ctx, sr.UnresponsiveEngines)
+	sr.Results = mergeDuplicates(sr.Results)
+	OrderResults(&sr.Results)
+
+	// Partial results are kept briefly so the engines get another chance
+	if len(sr.UnresponsiveEngines) > 0 {
+		return sr, time.Minute, nil
+	}
+	return sr, time.Minute * 15, nil
+}
+
+func (c *Client) fetchFrom(ctx context.Context, u *upstream, queryParams map[string]string) (_ *SearchResponse, err error) {
+	u.begin()
+	start := time.Now()
+	defer func() {
+		d := time.Since(start)
+		u.done(d, err)
+		metrics.ObserveSearxng(u.name, d, err)
+	}()
+
+	req := u.restyClient.R().WithContext(ctx).SetQueryParams(queryParams)
+	engines, skipped := u.enginesExcluding(c.engines.excludedEngines())
+	if engines != nil {
+		req.SetQueryParam("engines", strings.Join(engines, ","))
+	}
+	res, err := req.Get("/search")
+	if err != nil {
+		return nil, fmt.Errorf("unable to fetch searxng response error: %w", err)
 	}
 	defer res.Body.Close()
+	if res.StatusCode() >= 400 {
+		return nil, fmt.Errorf("unable to fetch searxng response %w: %d", ErrBadStatus, res.StatusCode())
+	}
 
 	rawJSON := res.Bytes()
 	var sr SearchResponse
 	if err = json.Unmarshal(rawJSON, &sr); err != nil {
 		return nil, fmt.Errorf("unable to unmarshal searxng response error: %w\nraw JSON:\n%s\n", err, rawJSON)
 	}
-	OrderResults(&sr.Results)
-
-	return &sr, c.cache.Set(ctx, cacheKey, &sr, time.Minute*15)
+	sr.ExcludedEngines = skipped
+	return &sr, nil
 }
 
 func (c *Client) Close() {
-	c.restyClient.Close()
+	for _, u := range c.upstreams {
+		u.restyClient.Close()
+	}
+}
+
+// Ping reports whether any upstream can take searches, going by the last
+// health checks and the state of the breakers.
+func (c *Client) Ping(ctx context.Context) error {
+	now := time.Now()
+	for _, u := range c.upstreams {
+		if u.allowed(now) {
+			return nil
+		}
+	}
+	return ErrNoUpstream
 }
@@ -5,6 +5,7 @@ package searxng
 import (
 	"cmp"
 	"encoding/json/v2"
+	"errors"
 	"slices"
 	"strings"
 	"time"
@@ -59,6 +60,13 @@ type SearchResponse struct {
 	Infoboxes           []Infobox     `json:"infoboxes"`
 	Suggestions         []string      `json:"suggestions"`
 	UnresponsiveEngines []EngineError `json:"unresponsive_engines"`
+	// ExcludedEngines were left out of the search for failing repeatedly
+	ExcludedEngines []string `json:"excluded_engines,omitempty"`
+}
+
+// Partial reports whether some engines did not contribute to the results.
+func (sr *SearchResponse) Partial() bool {
+	return len(sr.UnresponsiveEngines) > 0 || len(sr.ExcludedEngines) > 0
 }
 
 func OrderResults(r *[]Result) {
@@ -111,6 +119,8 @@ type Result struct {
 	Positions     []int    `json:"positions,omitempty"`
 	Score         float64  `json:"score,omitempty"`
 	Category      string   `json:"category,omitempty"`
+	// Origins are the federated backends that returned the result
+	Origins []string `json:"origins,omitempty"`
 }
 
 // Answer represents an answer result type
@@ -147,14 +157,29 @@ type InfoboxAttribute struct {
 	Image map[string]string `json:"image,omitempty"`
 }
 
-// EngineError represents an unresponsive engine error
-type EngineError []string
-
-/*type EngineError struct {
+// EngineError represents an unresponsive engine error. SearXNG sends it as
+// an [engine, error] pair.
+type EngineError struct {
 	Engine string `json:"engine"`
 	Error  string `json:"error"`
-	Type   string `json:"type,omitempty"`
-}*/
+}
+
+func (e *EngineError) UnmarshalJSON(data []byte) error {
+	var pair []string
+	if err := json.Unmarshal(data, &pair); err != nil {
+		return err
+	}
+	if len(pair) == 0 {
+		return errors.New("empty unresponsive engine entry")
+	}
+	e.Engine = pair[0]
+	e.Error = strings.Join(pair[1:], " ")
+	return nil
+}
+
+func (e EngineError) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]string{e.Engine, e.Error})
+}
 
 // LegacyResult represents a legacy dictionary-based result for backward compatibility
 type LegacyResult struct {
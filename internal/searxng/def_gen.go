@@ -211,40 +211,67 @@ func (z *Answer) Msgsize() (s int) {
 
 // DecodeMsg implements msgp.Decodable
 func (z *EngineError) DecodeMsg(dc *msgp.Reader) (err error) {
-	var zb0002 uint32
-	zb0002, err = dc.ReadArrayHeader()
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, err = dc.ReadMapHeader()
 	if err != nil {
 		err = msgp.WrapError(err)
 		return
 	}
-	if cap((*z)) >= int(zb0002) {
-		(*z) = (*z)[:zb0002]
-	} else {
-		(*z) = make(EngineError, zb0002)
-	}
-	for zb0001 := range *z {
-		(*z)[zb0001], err = dc.ReadString()
+	for zb0001 > 0 {
+		zb0001--
+		field, err = dc.ReadMapKeyPtr()
 		if err != nil {
-			err = msgp.WrapError(err, zb0001)
+			err = msgp.WrapError(err)
 			return
 		}
+		switch msgp.UnsafeString(field) {
+		case "Engine":
+			z.Engine, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Engine")
+				return
+			}
+		case "Error":
+			z.Error, err = dc.ReadString()
+			if err != nil {
+				err = msgp.WrapError(err, "Error")
+				return
+			}
+		default:
+			err = dc.Skip()
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
 	}
 	return
 }
 
 // EncodeMsg implements msgp.Encodable
 func (z EngineError) EncodeMsg(en *msgp.Writer) (err error) {
-	err = en.WriteArrayHeader(uint32(len(z)))
+	// map header, size 2
+	// write "Engine"
+	err = en.Append(0x82, 0xa6, 0x45, 0x6e, 0x67, 0x69, 0x6e, 0x65)
 	if err != nil {
-		err = msgp.WrapError(err)
 		return
 	}
-	for zb0003 := range z {
-		err = en.WriteString(z[zb0003])
-		if err != nil {
-			err = msgp.WrapError(err, zb0003)
-			return
-		}
+	err = en.WriteString(z.Engine)
+	if err != nil {
+		err = msgp.WrapError(err, "Engine")
+		return
+	}
+	// write "Error"
+	err = en.Append(0xa5, 0x45, 0x72, 0x72, 0x6f, 0x72)
+	if err != nil {
+		return
+	}
+	err = en.WriteString(z.Error)
+	if err != nil {
+		err = msgp.WrapError(err, "Error")
+		return
 	}
 	return
 }
@@ -252,32 +279,53 @@ func (z EngineError) EncodeMsg(en *msgp.Writer) (err error) {
 // MarshalMsg implements msgp.Marshaler
 func (z EngineError) MarshalMsg(b []byte) (o []byte, err error) {
 	o = msgp.Require(b, z.Msgsize())
-	o = msgp.AppendArrayHeader(o, uint32(len(z)))
-	for zb0003 := range z {
-		o = msgp.AppendString(o, z[zb0003])
-	}
+	// map header, size 2
+	// string "Engine"
+	o = append(o, 0x82, 0xa6, 0x45, 0x6e, 0x67, 0x69, 0x6e, 0x65)
+	o = msgp.AppendString(o, z.Engine)
+	// string "Error"
+	o = append(o, 0xa5, 0x45, 0x72, 0x72, 0x6f, 0x72)
+	o = msgp.AppendString(o, z.Error)
 	return
 }
 
 // UnmarshalMsg implements msgp.Unmarshaler
 func (z *EngineError) UnmarshalMsg(bts []byte) (o []byte, err error) {
-	var zb0002 uint32
-	zb0002, bts, err = msgp.ReadArrayHeaderBytes(bts)
+	var field []byte
+	_ = field
+	var zb0001 uint32
+	zb0001, bts, err = msgp.ReadMapHeaderBytes(bts)
 	if err != nil {
 		err = msgp.WrapError(err)
 		return
 	}
-	if cap((*z)) >= int(zb0002) {
-		(*z) = (*z)[:zb0002]
-	} else {
-		(*z) = make(EngineError, zb0002)
-	}
-	for zb0001 := range *z {
-		(*z)[zb0001], bts, err = msgp.ReadStringBytes(bts)
+	for zb0001 > 0 {
+		zb0001--
+		field, bts, err = msgp.ReadMapKeyZC(bts)
 		if err != nil {
-			err = msgp.WrapError(err, zb0001)
+			err = msgp.WrapError(err)
 			return
 		}
+		switch msgp.UnsafeString(field) {
+		case "Engine":
+			z.Engine, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Engine")
+				return
+			}
+		case "Error":
+			z.Error, bts, err = msgp.ReadStringBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Error")
+				return
+			}
+		default:
+			bts, err = msgp.Skip(bts)
+			if err != nil {
+				err = msgp.WrapError(err)
+				return
+			}
+		}
 	}
 	o = bts
 	return
@@ -285,10 +333,7 @@ func (z *EngineError) UnmarshalMsg(bts []byte) (o []byte, err error) {
 
 // Msgsize returns an upper bound estimate of the number of bytes occupied by the serialized message
 func (z EngineError) Msgsize() (s int) {
-	s = msgp.ArrayHeaderSize
-	for zb0003 := range z {
-		s += msgp.StringPrefixSize + len(z[zb0003])
-	}
+	s = 1 + 7 + msgp.StringPrefixSize + len(z.Engine) + 6 + msgp.StringPrefixSize + len(z.Error)
 	return
 }
 
@@ -2272,6 +2317,25 @@ func (z *Result) DecodeMsg(dc *msgp.Reader) (err error) {
 				err = msgp.WrapError(err, "Category")
 				return
 			}
+		case "Origins":
+			var zb0006 uint32
+			zb0006, err = dc.ReadArrayHeader()
+			if err != nil {
+				err = msgp.WrapError(err, "Origins")
+				return
+			}
+			if cap(z.Origins) >= int(zb0006) {
+				z.Origins = (z.Origins)[:zb0006]
+			} else {
+				z.Origins = make([]string, zb0006)
+			}
+			for za0004 := range z.Origins {
+				z.Origins[za0004], err = dc.ReadString()
+				if err != nil {
+					err = msgp.WrapError(err, "Origins", za0004)
+					return
+				}
+			}
 		default:
 			err = dc.Skip()
 			if err != nil {
@@ -2285,9 +2349,9 @@ func (z *Result) DecodeMsg(dc *msgp.Reader) (err error) {
 
 // EncodeMsg implements msgp.Encodable
 func (z *Result) EncodeMsg(en *msgp.Writer) (err error) {
-	// map header, size 23
+	// map header, size 24
 	// write "URL"
-	err = en.Append(0xde, 0x0, 0x17, 0xa3, 0x55, 0x52, 0x4c)
+	err = en.Append(0xde, 0x0, 0x18, 0xa3, 0x55, 0x52, 0x4c)
 	if err != nil {
 		return
 	}
@@ -2550,15 +2614,32 @@ func (z *Result) EncodeMsg(en *msgp.Writer) (err error) {
 		err = msgp.WrapError(err, "Category")
 		return
 	}
+	// write "Origins"
+	err = en.Append(0xa7, 0x4f, 0x72, 0x69, 0x67, 0x69, 0x6e, 0x73)
+	if err != nil {
+		return
+	}
+	err = en.WriteArrayHeader(uint32(len(z.Origins)))
+	if err != nil {
+		err = msgp.WrapError(err, "Origins")
+		return
+	}
+	for za0004 := range z.Origins {
+		err = en.WriteString(z.Origins[za0004])
+		if err != nil {
+			err = msgp.WrapError(err, "Origins", za0004)
+			return
+		}
+	}
 	return
 }
 
 // MarshalMsg implements msgp.Marshaler
 func (z *Result) MarshalMsg(b []byte) (o []byte, err error) {
 	o = msgp.Require(b, z.Msgsize())
-	// map header, size 23
+	// map header, size 24
 	// string "URL"
-	o = append(o, 0xde, 0x0, 0x17, 0xa3, 0x55, 0x52, 0x4c)
+	o = append(o, 0xde, 0x0, 0x18, 0xa3, 0x55, 0x52, 0x4c)
 	o = msgp.AppendString(o, z.URL)
 	// string "Engine"
 	o = append(o, 0xa6, 0x45, 0x6e, 0x67, 0x69, 0x6e, 0x65)
@@ -2642,6 +2723,12 @@ func (z *Result) MarshalMsg(b []byte) (o []byte, err error) {
 	// string "Category"
 	o = append(o, 0xa8, 0x43, 0x61, 0x74, 0x65, 0x67, 0x6f, 0x72, 0x79)
 	o = msgp.AppendString(o, z.Category)
+	// string "Origins"
+	o = append(o, 0xa7, 0x4f, 0x72, 0x69, 0x67, 0x69, 0x6e, 0x73)
+	o = msgp.AppendArrayHeader(o, uint32(len(z.Origins)))
+	for za0004 := range z.Origins {
+		o = msgp.AppendString(o, z.Origins[za0004])
+	}
 	return
 }
 
@@ -2873,6 +2960,25 @@ func (z *Result) UnmarshalMsg(bts []byte) (o []byte, err error) {
 				err = msgp.WrapError(err, "Category")
 				return
 			}
+		case "Origins":
+			var zb0006 uint32
+			zb0006, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "Origins")
+				return
+			}
+			if cap(z.Origins) >= int(zb0006) {
+				z.Origins = (z.Origins)[:zb0006]
+			} else {
+				z.Origins = make([]string, zb0006)
+			}
+			for za0004 := range z.Origins {
+				z.Origins[za0004], bts, err = msgp.ReadStringBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "Origins", za0004)
+					return
+				}
+			}
 		default:
 			bts, err = msgp.Skip(bts)
 			if err != nil {
@@ -2901,7 +3007,10 @@ func (z *Result) Msgsize() (s int) {
 	for za0002 := range z.Engines {
 		s += msgp.StringPrefixSize + len(z.Engines[za0002])
 	}
-	s += 10 + msgp.BoolSize + 11 + msgp.BoolSize + 10 + msgp.ArrayHeaderSize + (len(z.Positions) * (msgp.IntSize)) + 6 + msgp.Float64Size + 9 + msgp.StringPrefixSize + len(z.Category)
+	s += 10 + msgp.BoolSize + 11 + msgp.BoolSize + 10 + msgp.ArrayHeaderSize + (len(z.Positions) * (msgp.IntSize)) + 6 + msgp.Float64Size + 9 + msgp.StringPrefixSize + len(z.Category) + 8 + msgp.ArrayHeaderSize
+	for za0004 := range z.Origins {
+		s += msgp.StringPrefixSize + len(z.Origins[za0004])
+	}
 	return
 }
 
@@ -3044,22 +3153,57 @@ func (z *SearchResponse) DecodeMsg(dc *msgp.Reader) (err error) {
 			}
 			for za0006 := range z.UnresponsiveEngines {
 				var zb0008 uint32
-				zb0008, err = dc.ReadArrayHeader()
+				zb0008, err = dc.ReadMapHeader()
 				if err != nil {
 					err = msgp.WrapError(err, "UnresponsiveEngines", za0006)
 					return
 				}
-				if cap(z.UnresponsiveEngines[za0006]) >= int(zb0008) {
-					z.UnresponsiveEngines[za0006] = (z.UnresponsiveEngines[za0006])[:zb0008]
-				} else {
-					z.UnresponsiveEngines[za0006] = make(EngineError, zb0008)
-				}
-				for za0007 := range z.UnresponsiveEngines[za0006] {
-					z.UnresponsiveEngines[za0006][za0007], err = dc.ReadString()
+				for zb0008 > 0 {
+					zb0008--
+					field, err = dc.ReadMapKeyPtr()
 					if err != nil {
-						err = msgp.WrapError(err, "UnresponsiveEngines", za0006, za0007)
+						err = msgp.WrapError(err, "UnresponsiveEngines", za0006)
 						return
 					}
+					switch msgp.UnsafeString(field) {
+					case "Engine":
+						z.UnresponsiveEngines[za0006].Engine, err = dc.ReadString()
+						if err != nil {
+							err = msgp.WrapError(err, "UnresponsiveEngines", za0006, "Engine")
+							return
+						}
+					case "Error":
+						z.UnresponsiveEngines[za0006].Error, err = dc.ReadString()
+						if err != nil {
+							err = msgp.WrapError(err, "UnresponsiveEngines", za0006, "Error")
+							return
+						}
+					default:
+						err = dc.Skip()
+						if err != nil {
+							err = msgp.WrapError(err, "UnresponsiveEngines", za0006)
+							return
+						}
+					}
+				}
+			}
+		case "ExcludedEngines":
+			var zb0009 uint32
+			zb0009, err = dc.ReadArrayHeader()
+			if err != nil {
+				err = msgp.WrapError(err, "ExcludedEngines")
+				return
+			}
+			if cap(z.ExcludedEngines) >= int(zb0009) {
+				z.ExcludedEngines = (z.ExcludedEngines)[:zb0009]
+			} else {
+				z.ExcludedEngines = make([]string, zb0009)
+			}
+			for za0007 := range z.ExcludedEngines {
+				z.ExcludedEngines[za0007], err = dc.ReadString()
+				if err != nil {
+					err = msgp.WrapError(err, "ExcludedEngines", za0007)
+					return
 				}
 			}
 		default:
@@ -3075,9 +3219,9 @@ func (z *SearchResponse) DecodeMsg(dc *msgp.Reader) (err error) {
 
 // EncodeMsg implements msgp.Encodable
 func (z *SearchResponse) EncodeMsg(en *msgp.Writer) (err error) {
-	// map header, size 8
+	// map header, size 9
 	// write "Query"
-	err = en.Append(0x88, 0xa5, 0x51, 0x75, 0x65, 0x72, 0x79)
+	err = en.Append(0x89, 0xa5, 0x51, 0x75, 0x65, 0x72, 0x79)
 	if err != nil {
 		return
 	}
@@ -3192,17 +3336,43 @@ func (z *SearchResponse) EncodeMsg(en *msgp.Writer) (err error) {
 		return
 	}
 	for za0006 := range z.UnresponsiveEngines {
-		err = en.WriteArrayHeader(uint32(len(z.UnresponsiveEngines[za0006])))
+		// map header, size 2
+		// write "Engine"
+		err = en.Append(0x82, 0xa6, 0x45, 0x6e, 0x67, 0x69, 0x6e, 0x65)
 		if err != nil {
-			err = msgp.WrapError(err, "UnresponsiveEngines", za0006)
 			return
 		}
-		for za0007 := range z.UnresponsiveEngines[za0006] {
-			err = en.WriteString(z.UnresponsiveEngines[za0006][za0007])
-			if err != nil {
-				err = msgp.WrapError(err, "UnresponsiveEngines", za0006, za0007)
-				return
-			}
+		err = en.WriteString(z.UnresponsiveEngines[za0006].Engine)
+		if err != nil {
+			err = msgp.WrapError(err, "UnresponsiveEngines", za0006, "Engine")
+			return
+		}
+		// write "Error"
+		err = en.Append(0xa5, 0x45, 0x72, 0x72, 0x6f, 0x72)
+		if err != nil {
+			return
+		}
+		err = en.WriteString(z.UnresponsiveEngines[za0006].Error)
+		if err != nil {
+			err = msgp.WrapError(err, "UnresponsiveEngines", za0006, "Error")
+			return
+		}
+	}
+	// write "ExcludedEngines"
+	err = en.Append(0xaf, 0x45, 0x78, 0x63, 0x6c, 0x75, 0x64, 0x65, 0x64, 0x45, 0x6e, 0x67, 0x69, 0x6e, 0x65, 0x73)
+	if err != nil {
+		return
+	}
+	err = en.WriteArrayHeader(uint32(len(z.ExcludedEngines)))
+	if err != nil {
+		err = msgp.WrapError(err, "ExcludedEngines")
+		return
+	}
+	for za0007 := range z.ExcludedEngines {
+		err = en.WriteString(z.ExcludedEngines[za0007])
+		if err != nil {
+			err = msgp.WrapError(err, "ExcludedEngines", za0007)
+			return
 		}
 	}
 	return
@@ -3211,9 +3381,9 @@ func (z *SearchResponse) EncodeMsg(en *msgp.Writer) (err error) {
 // MarshalMsg implements msgp.Marshaler
 func (z *SearchResponse) MarshalMsg(b []byte) (o []byte, err error) {
 	o = msgp.Require(b, z.Msgsize())
-	// map header, size 8
+	// map header, size 9
 	// string "Query"
-	o = append(o, 0x88, 0xa5, 0x51, 0x75, 0x65, 0x72, 0x79)
+	o = append(o, 0x89, 0xa5, 0x51, 0x75, 0x65, 0x72, 0x79)
 	o = msgp.AppendString(o, z.Query)
 	// string "NumberOfResults"
 	o = append(o, 0xaf, 0x4e, 0x75, 0x6d, 0x62, 0x65, 0x72, 0x4f, 0x66, 0x52, 0x65, 0x73, 0x75, 0x6c, 0x74, 0x73)
@@ -3264,10 +3434,19 @@ func (z *SearchResponse) MarshalMsg(b []byte) (o []byte, err error) {
 	o = append(o, 0xb3, 0x55, 0x6e, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x69, 0x76, 0x65, 0x45, 0x6e, 0x67, 0x69, 0x6e, 0x65, 0x73)
 	o = msgp.AppendArrayHeader(o, uint32(len(z.UnresponsiveEngines)))
 	for za0006 := range z.UnresponsiveEngines {
-		o = msgp.AppendArrayHeader(o, uint32(len(z.UnresponsiveEngines[za0006])))
-		for za0007 := range z.UnresponsiveEngines[za0006] {
-			o = msgp.AppendString(o, z.UnresponsiveEngines[za0006][za0007])
-		}
+		// map header, size 2
+		// string "Engine"
+		o = append(o, 0x82, 0xa6, 0x45, 0x6e, 0x67, 0x69, 0x6e, 0x65)
+		o = msgp.AppendString(o, z.UnresponsiveEngines[za0006].Engine)
+		// string "Error"
+		o = append(o, 0xa5, 0x45, 0x72, 0x72, 0x6f, 0x72)
+		o = msgp.AppendString(o, z.UnresponsiveEngines[za0006].Error)
+	}
+	// string "ExcludedEngines"
+	o = append(o, 0xaf, 0x45, 0x78, 0x63, 0x6c, 0x75, 0x64, 0x65, 0x64, 0x45, 0x6e, 0x67, 0x69, 0x6e, 0x65, 0x73)
+	o = msgp.AppendArrayHeader(o, uint32(len(z.ExcludedEngines)))
+	for za0007 := range z.ExcludedEngines {
+		o = msgp.AppendString(o, z.ExcludedEngines[za0007])
 	}
 	return
 }
@@ -3411,22 +3590,57 @@ func (z *SearchResponse) UnmarshalMsg(bts []byte) (o []byte, err error) {
 			}
 			for za0006 := range z.UnresponsiveEngines {
 				var zb0008 uint32
-				zb0008, bts, err = msgp.ReadArrayHeaderBytes(bts)
+				zb0008, bts, err = msgp.ReadMapHeaderBytes(bts)
 				if err != nil {
 					err = msgp.WrapError(err, "UnresponsiveEngines", za0006)
 					return
 				}
-				if cap(z.UnresponsiveEngines[za0006]) >= int(zb0008) {
-					z.UnresponsiveEngines[za0006] = (z.UnresponsiveEngines[za0006])[:zb0008]
-				} else {
-					z.UnresponsiveEngines[za0006] = make(EngineError, zb0008)
-				}
-				for za0007 := range z.UnresponsiveEngines[za0006] {
-					z.UnresponsiveEngines[za0006][za0007], bts, err = msgp.ReadStringBytes(bts)
+				for zb0008 > 0 {
+					zb0008--
+					field, bts, err = msgp.ReadMapKeyZC(bts)
 					if err != nil {
-						err = msgp.WrapError(err, "UnresponsiveEngines", za0006, za0007)
+						err = msgp.WrapError(err, "UnresponsiveEngines", za0006)
 						return
 					}
+					switch msgp.UnsafeString(field) {
+					case "Engine":
+						z.UnresponsiveEngines[za0006].Engine, bts, err = msgp.ReadStringBytes(bts)
+						if err != nil {
+							err = msgp.WrapError(err, "UnresponsiveEngines", za0006, "Engine")
+							return
+						}
+					case "Error":
+						z.UnresponsiveEngines[za0006].Error, bts, err = msgp.ReadStringBytes(bts)
+						if err != nil {
+							err = msgp.WrapError(err, "UnresponsiveEngines", za0006, "Error")
+							return
+						}
+					default:
+						bts, err = msgp.Skip(bts)
+						if err != nil {
+							err = msgp.WrapError(err, "UnresponsiveEngines", za0006)
+							return
+						}
+					}
+				}
+			}
+		case "ExcludedEngines":
+			var zb0009 uint32
+			zb0009, bts, err = msgp.ReadArrayHeaderBytes(bts)
+			if err != nil {
+				err = msgp.WrapError(err, "ExcludedEngines")
+				return
+			}
+			if cap(z.ExcludedEngines) >= int(zb0009) {
+				z.ExcludedEngines = (z.ExcludedEngines)[:zb0009]
+			} else {
+				z.ExcludedEngines = make([]string, zb0009)
+			}
+			for za0007 := range z.ExcludedEngines {
+				z.ExcludedEngines[za0007], bts, err = msgp.ReadStringBytes(bts)
+				if err != nil {
+					err = msgp.WrapError(err, "ExcludedEngines", za0007)
+					return
 				}
 			}
 		default:
@@ -3465,10 +3679,11 @@ func (z *SearchResponse) Msgsize() (s int) {
 	}
 	s += 20 + msgp.ArrayHeaderSize
 	for za0006 := range z.UnresponsiveEngines {
-		s += msgp.ArrayHeaderSize
-		for za0007 := range z.UnresponsiveEngines[za0006] {
-			s += msgp.StringPrefixSize + len(z.UnresponsiveEngines[za0006][za0007])
-		}
+		s += 1 + 7 + msgp.StringPrefixSize + len(z.UnresponsiveEngines[za0006].Engine) + 6 + msgp.StringPrefixSize + len(z.UnresponsiveEngines[za0006].Error)
+	}
+	s += 16 + msgp.ArrayHeaderSize
+	for za0007 := range z.ExcludedEngines {
+		s += msgp.StringPrefixSize + len(z.ExcludedEngines[za0007])
 	}
 	return
 }
@@ -0,0 +1,193 @@
+package searxng
+
+import (
+	"context"
+	"encoding/json/v2"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/AletisSearch/aletis/internal/db"
+)
+
+const (
+	// maxEngineFailures is how many of the latest engine failures are kept.
+	maxEngineFailures = 50
+	// An engine that failed engineFailureThreshold times within
+	// engineFailureWindow is left out of searches. It is tried again once
+	// enough failures have aged out of the window, which acts as its
+	// cool-down.
+	engineFailureThreshold = 3
+	engineFailureWindow    = time.Minute * 15
+)
+
+// EngineFailure is an engine SearXNG reported as unresponsive.
+type EngineFailure struct {
+	Engine string
+	Reason string
+	Time   time.Time
+}
+
+// engineHealth tracks failing engines. Failures are stored in Postgres when
+// it is available so that every replica excludes the same engines, and kept
+// in memory otherwise.
+type engineHealth struct {
+	q *db.Queries
+
+	mu       sync.Mutex
+	failures []EngineFailure
+	excluded []string
+}
+
+func (h *engineHealth) record(ctx context.Context, errs []EngineError) {
+	now := time.Now()
+	for _, e := range errs {
+		if h.q != nil {
+			err := h.q.InsertEngineFailure(ctx, db.InsertEngineFailureParams{Engine: e.Engine, Reason: e.Error})
+			if err != nil {
+				slog.Error("unable to record engine failure", "ERROR", err)
+			}
+		}
+		h.mu.Lock()
+		h.failures = append(h.failures, EngineFailure{Engine: e.Engine, Reason: e.Error, Time: now})
+		if len(h.failures) > maxEngineFailures {
+			h.failures = slices.Delete(h.failures, 0, len(h.failures)-maxEngineFailures)
+		}
+		h.mu.Unlock()
+	}
+}
+
+// refresh recomputes the engines to exclude from the failures within the
+// window.
+func (h *engineHealth) refresh(ctx context.Context) error {
+	since := time.Now().Add(-engineFailureWindow)
+	var excluded []string
+	if h.q != nil {
+		counts, err := h.q.CountEngineFailures(ctx, since)
+		if err != nil {
+			return err
+		}
+		for _, c := range counts {
+			if c.Failures >= engineFailureThreshold {
+				excluded = append(excluded, c.Engine)
+			}
+		}
+	} else {
+		counts := map[string]int{}
+		h.mu.Lock()
+		for _, f := range h.failures {
+			if f.Time.After(since) {
+				counts[f.Engine]++
+			}
+		}
+		h.mu.Unlock()
+		for engine, n := range counts {
+			if n >= engineFailureThreshold {
+				excluded = append(excluded, engine)
+			}
+		}
+		slices.Sort(excluded)
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !slices.Equal(excluded, h.excluded) {
+		slog.Info("searxng excluded engines changed", "Engines", excluded)
+	}
+	h.excluded = excluded
+	return nil
+}
+
+func (h *engineHealth) excludedEngines() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.excluded
+}
+
+// RecentEngineFailures returns the latest engine failures, newest first.
+func (c *Client) RecentEngineFailures(ctx context.Context) ([]EngineFailure, error) {
+	if c.engines.q != nil {
+		rows, err := c.engines.q.ListEngineFailures(ctx, maxEngineFailures)
+		if err != nil {
+			return nil, err
+		}
+		out := make([]EngineFailure, len(rows))
+		for i, r := range rows {
+			out[i] = EngineFailure{Engine: r.Engine, Reason: r.Reason, Time: r.Created}
+		}
+		return out, nil
+	}
+	c.engines.mu.Lock()
+	defer c.engines.mu.Unlock()
+	out := slices.Clone(c.engines.failures)
+	slices.Reverse(out)
+	return out, nil
+}
+
+// ExcludedEngines returns the engines currently left out of searches.
+func (c *Client) ExcludedEngines() []string {
+	return c.engines.excludedEngines()
+}
+
+// instanceConfig is the part of the SearXNG /config response needed to
+// know which engines a search would use by default.
+type instanceConfig struct {
+	Engines []struct {
+		Name       string   `json:"name"`
+		Categories []string `json:"categories"`
+		Enabled    bool     `json:"enabled"`
+	} `json:"engines"`
+}
+
+// loadEngines fetches the engines enabled for general searches on the
+// upstream. SearXNG has no parameter to disable engines for one search, so
+// exclusion works by listing the remaining ones.
+func (u *upstream) loadEngines(ctx context.Context) error {
+	res, err := u.restyClient.R().WithContext(ctx).Get("/config")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode() >= 400 {
+		return fmt.Errorf("%w: %d", ErrBadStatus, res.StatusCode())
+	}
+	var conf instanceConfig
+	if err := json.Unmarshal(res.Bytes(), &conf); err != nil {
+		return err
+	}
+	var engines []string
+	for _, e := range conf.Engines {
+		if e.Enabled && slices.Contains(e.Categories, "general") {
+			engines = append(engines, e.Name)
+		}
+	}
+	u.mu.Lock()
+	u.engines = engines
+	u.mu.Unlock()
+	return nil
+}
+
+// enginesExcluding returns the general engines of the upstream without the
+// excluded ones, and the excluded engines it actually uses. It returns nil
+// when nothing needs excluding or the engines of the upstream are unknown.
+func (u *upstream) enginesExcluding(excluded []string) (engines, skipped []string) {
+	if len(excluded) == 0 {
+		return nil, nil
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	for _, e := range u.engines {
+		if slices.Contains(excluded, e) {
+			skipped = append(skipped, e)
+		} else {
+			engines = append(engines, e)
+		}
+	}
+	// Searching with no engine at all would return nothing
+	if len(skipped) == 0 || len(engines) == 0 {
+		return nil, nil
+	}
+	return engines, skipped
+}
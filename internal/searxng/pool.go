@@ -0,0 +1,337 @@
+package searxng
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/AletisSearch/aletis/internal/egress"
+	"github.com/AletisSearch/aletis/internal/metrics"
+	"resty.dev/v3"
+)
+
+var ErrNoUpstream = errors.New("no searxng upstream available")
+
+const (
+	// breakerThreshold is how many failures in a row open the breaker of an
+	// upstream.
+	breakerThreshold = 3
+	// breakerCooldown is how long an open breaker keeps an upstream out of
+	// rotation before a single request is let through to probe it.
+	breakerCooldown = time.Second * 30
+	// maxAttempts bounds the upstreams tried for one search.
+	maxAttempts  = 3
+	retryBackoff = time.Millisecond * 100
+	// latencyWeight is how much the latest request moves the moving average
+	// of an upstream's latency.
+	latencyWeight = 0.2
+	// enginesRefresh is how often the engines enabled on an upstream are
+	// fetched again.
+	enginesRefresh = time.Hour
+)
+
+// Upstream is a SearXNG instance and its share of the traffic.
+type Upstream struct {
+	URL    string
+	Weight int
+}
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerHalfOpen
+	BreakerOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerHalfOpen:
+		return "half-open"
+	case BreakerOpen:
+		return "open"
+	}
+	return "unknown"
+}
+
+// UpstreamStatus is a snapshot of the state of an upstream.
+type UpstreamStatus struct {
+	URL       string
+	Weight    int
+	Healthy   bool
+	Breaker   BreakerState
+	Latency   time.Duration
+	Requests  uint64
+	Errors    uint64
+	LastError string
+}
+
+type upstream struct {
+	// name is the URL without credentials, safe for logs and metrics
+	name        string
+	weight      int
+	restyClient *resty.Client
+
+	mu        sync.Mutex
+	healthy   bool
+	state     BreakerState
+	failures  int
+	openedAt  time.Time
+	latency   time.Duration
+	requests  uint64
+	errors    uint64
+	lastError string
+	// engines are the engines enabled for general searches
+	engines       []string
+	enginesLoaded time.Time
+}
+
+func newUpstream(u Upstream, f *egress.Factory) *upstream {
+	// Names are shown on /admin and in metrics, without the credentials
+	// given in the user info or query
+	name := u.URL
+	if parsed, err := url.Parse(u.URL); err == nil {
+		parsed.User = nil
+		parsed.RawQuery = ""
+		name = parsed.String()
+	}
+	return &upstream{
+		name:   name,
+		weight: max(u.Weight, 1),
+		restyClient: resty.NewWithClient(f.Client(
+			egress.WithTrusted(),
+			egress.WithTimeout(time.Second*20),
+			egress.WithMaxBodyBytes(16<<20),
+		)).
+			SetHeader("Accept", "application/json, text/html").
+			SetHeader("Accept-Language", "*").SetBaseURL(u.URL),
+		healthy: true,
+	}
+}
+
+// allowed reports whether the upstream can take a request. An open breaker
+// lets a request through once its cool-down has passed.
+func (u *upstream) allowed(now time.Time) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	switch u.state {
+	case BreakerOpen:
+		return u.healthy && now.Sub(u.openedAt) >= breakerCooldown
+	case BreakerHalfOpen:
+		// A probe is already in flight
+		return false
+	}
+	return u.healthy
+}
+
+// begin marks the start of a request, moving an open breaker to half-open.
+func (u *upstream) begin() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if u.state == BreakerOpen {
+		u.state = BreakerHalfOpen
+		u.publish()
+	}
+}
+
+// done records the outcome of a request started with begin.
+func (u *upstream) done(d time.Duration, err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.requests++
+	if err != nil {
+		u.errors++
+		u.failures++
+		u.lastError = err.Error()
+		if u.state == BreakerHalfOpen || u.failures >= breakerThreshold {
+			if u.state != BreakerOpen {
+				slog.Warn("searxng upstream breaker open", "upstream", u.name, "ERROR", err)
+			}
+			u.state = BreakerOpen
+			u.openedAt = time.Now()
+		}
+		u.publish()
+		return
+	}
+	if u.state != BreakerClosed {
+		slog.Info("searxng upstream breaker closed", "upstream", u.name)
+	}
+	u.failures = 0
+	u.state = BreakerClosed
+	if u.latency == 0 {
+		u.latency = d
+	} else {
+		u.latency = time.Duration(float64(u.latency)*(1-latencyWeight) + float64(d)*latencyWeight)
+	}
+	u.publish()
+}
+
+func (u *upstream) setHealthy(err error) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	healthy := err == nil
+	if healthy != u.healthy {
+		if healthy {
+			slog.Info("searxng upstream healthy", "upstream", u.name)
+		} else {
+			slog.Warn("searxng upstream unhealthy", "upstream", u.name, "ERROR", err)
+		}
+	}
+	u.healthy = healthy
+	if err != nil {
+		u.lastError = err.Error()
+	}
+	u.publish()
+}
+
+// publish exports the state to metrics. The caller must hold u.mu.
+func (u *upstream) publish() {
+	metrics.SearxngUpstream(u.name, u.healthy, int(u.state))
+}
+
+func (u *upstream) status() UpstreamStatus {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return UpstreamStatus{
+		URL:       u.name,
+		Weight:    u.weight,
+		Healthy:   u.healthy,
+		Breaker:   u.state,
+		Latency:   u.latency,
+		Requests:  u.requests,
+		Errors:    u.errors,
+		LastError: u.lastError,
+	}
+}
+
+func (u *upstream) consecutiveFailures() int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.failures
+}
+
+func (u *upstream) ping(ctx context.Context) error {
+	res, err := u.restyClient.R().WithContext(ctx).Get("/healthz")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode() != http.StatusOK {
+		return fmt.Errorf("%w: %d", ErrBadStatus, res.StatusCode())
+	}
+	return nil
+}
+
+// pick chooses an upstream that was not tried yet. Upstreams are drawn at
+// random in proportion to their weight divided by their average latency, so
+// faster instances get more of the traffic. When every remaining upstream is
+// unhealthy or has an open breaker, the one with the fewest failures in a
+// row is tried anyway rather than failing the search outright.
+func (c *Client) pick(tried []*upstream) *upstream {
+	now := time.Now()
+	var candidates, fallback []*upstream
+	for _, u := range c.upstreams {
+		if slices.Contains(tried, u) {
+			continue
+		}
+		fallback = append(fallback, u)
+		if u.allowed(now) {
+			candidates = append(candidates, u)
+		}
+	}
+	if len(candidates) == 0 {
+		if len(fallback) == 0 {
+			return nil
+		}
+		return slices.MinFunc(fallback, func(a, b *upstream) int {
+			return a.consecutiveFailures() - b.consecutiveFailures()
+		})
+	}
+
+	latencies := make([]time.Duration, len(candidates))
+	var known time.Duration
+	var n int
+	for i, u := range candidates {
+		latencies[i] = u.status().Latency
+		if latencies[i] > 0 {
+			known += latencies[i]
+			n++
+		}
+	}
+	// Upstreams without a measurement yet are assumed to be average
+	average := time.Second
+	if n > 0 {
+		average = known / time.Duration(n)
+	}
+	scores := make([]float64, len(candidates))
+	var total float64
+	for i, u := range candidates {
+		latency := cmp.Or(latencies[i], average)
+		scores[i] = float64(u.weight) / max(latency.Seconds(), 0.01)
+		total += scores[i]
+	}
+	r := rand.Float64() * total
+	for i, s := range scores {
+		if r < s {
+			return candidates[i]
+		}
+		r -= s
+	}
+	return candidates[len(candidates)-1]
+}
+
+// CheckHealth pings every upstream and takes the ones that fail out of
+// rotation until they answer again. It also updates the engines left out of
+// searches for failing repeatedly.
+func (c *Client) CheckHealth(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, u := range c.upstreams {
+		wg.Go(func() {
+			ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+			defer cancel()
+			err := u.ping(ctx)
+			u.setHealthy(err)
+			if err != nil {
+				return
+			}
+			u.mu.Lock()
+			stale := time.Since(u.enginesLoaded) > enginesRefresh
+			u.mu.Unlock()
+			if !stale {
+				return
+			}
+			if err := u.loadEngines(ctx); err != nil {
+				slog.Warn("unable to load searxng engines", "upstream", u.name, "ERROR", err)
+				return
+			}
+			u.mu.Lock()
+			u.enginesLoaded = time.Now()
+			u.mu.Unlock()
+		})
+	}
+	wg.Go(func() {
+		if err := c.engines.refresh(ctx); err != nil {
+			slog.Error("unable to refresh excluded engines", "ERROR", err)
+		}
+	})
+	wg.Wait()
+}
+
+// Upstreams returns the state of every upstream in configuration order.
+func (c *Client) Upstreams() []UpstreamStatus {
+	out := make([]UpstreamStatus, len(c.upstreams))
+	for i, u := range c.upstreams {
+		out[i] = u.status()
+	}
+	return out
+}
@@ -0,0 +1,197 @@
+package searxng
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AletisSearch/aletis/internal/cache"
+	"github.com/AletisSearch/aletis/internal/egress"
+)
+
+// fakeUpstream is a SearXNG instance answering with status, which can be
+// changed while it runs.
+type fakeUpstream struct {
+	*httptest.Server
+	status   atomic.Int32
+	searches atomic.Int32
+}
+
+func newFakeUpstream(t *testing.T, status int) *fakeUpstream {
+	t.Helper()
+	f := &fakeUpstream{}
+	f.status.Store(int32(status))
+	f.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/search" {
+			f.searches.Add(1)
+		}
+		if status := int(f.status.Load()); status != http.StatusOK {
+			w.WriteHeader(status)
+			return
+		}
+		switch r.URL.Path {
+		case "/healthz":
+		case "/config":
+			fmt.Fprint(w, `{"engines":[]}`)
+		case "/search":
+			fmt.Fprintf(w, `{"query":%q,"results":[{"url":"https://go.dev/","title":"Go","engine":"duckduckgo"}]}`, r.URL.Query().Get("q"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(f.Close)
+	return f
+}
+
+func newTestClient(t *testing.T, upstreams ...*fakeUpstream) *Client {
+	t.Helper()
+	var us []Upstream
+	for _, u := range upstreams {
+		us = append(us, Upstream{URL: u.URL, Weight: 1})
+	}
+	c := NewClient(us, cache.NewMemoryStore(1<<20), nil, egress.New())
+	t.Cleanup(c.Close)
+	return c
+}
+
+func TestSearchFailover(t *testing.T) {
+	bad := newFakeUpstream(t, http.StatusBadGateway)
+	good := newFakeUpstream(t, http.StatusOK)
+	c := newTestClient(t, bad, good)
+
+	const searches = 10
+	for i := range searches {
+		q := fmt.Sprintf("query %d", i)
+		sr, err := c.Search(t.Context(), q)
+		if err != nil {
+			t.Fatalf("Search(%q) = %v", q, err)
+		}
+		if sr.Query != q || len(sr.Results) != 1 {
+			t.Errorf("Search(%q) = %+v", q, sr)
+		}
+	}
+
+	if n := good.searches.Load(); n != searches {
+		t.Errorf("good upstream got %d searches, want %d", n, searches)
+	}
+	// The breaker keeps the failing upstream out once it opened
+	if n := bad.searches.Load(); n > breakerThreshold {
+		t.Errorf("failing upstream got %d searches, want at most %d", n, breakerThreshold)
+	}
+	status := c.Upstreams()
+	if n := bad.searches.Load(); n == breakerThreshold && status[0].Breaker != BreakerOpen {
+		t.Errorf("failing upstream breaker is %v, want open", status[0].Breaker)
+	}
+	if status[1].Breaker != BreakerClosed || status[1].Errors != 0 {
+		t.Errorf("good upstream status = %+v", status[1])
+	}
+}
+
+func TestSearchAllUpstreamsFail(t *testing.T) {
+	a := newFakeUpstream(t, http.StatusInternalServerError)
+	b := newFakeUpstream(t, http.StatusServiceUnavailable)
+	c := newTestClient(t, a, b)
+
+	_, err := c.Search(t.Context(), "go")
+	if !errors.Is(err, ErrBadStatus) {
+		t.Fatalf("Search = %v, want ErrBadStatus", err)
+	}
+	// Both upstreams are tried and named in the error
+	for _, u := range []*fakeUpstream{a, b} {
+		if n := u.searches.Load(); n != 1 {
+			t.Errorf("%s got %d searches, want 1", u.URL, n)
+		}
+		if !strings.Contains(err.Error(), u.URL) {
+			t.Errorf("error %q doesn't name %s", err, u.URL)
+		}
+	}
+
+	// The failure is cached briefly instead of hitting the upstreams again
+	if _, err = c.Search(t.Context(), "go"); !errors.Is(err, cache.ErrUpstreamFailed) {
+		t.Errorf("second Search = %v, want ErrUpstreamFailed", err)
+	}
+	if n := a.searches.Load() + b.searches.Load(); n != 2 {
+		t.Errorf("upstreams got %d searches, want 2", n)
+	}
+}
+
+func TestCheckHealth(t *testing.T) {
+	down := newFakeUpstream(t, http.StatusServiceUnavailable)
+	up := newFakeUpstream(t, http.StatusOK)
+	c := newTestClient(t, down, up)
+
+	c.CheckHealth(t.Context())
+	status := c.Upstreams()
+	if status[0].Healthy || !status[1].Healthy {
+		t.Fatalf("healthy = %v, %v, want false, true", status[0].Healthy, status[1].Healthy)
+	}
+	if err := c.Ping(t.Context()); err != nil {
+		t.Errorf("Ping = %v", err)
+	}
+	// Unhealthy upstreams are out of rotation
+	for i := range 5 {
+		if _, err := c.Search(t.Context(), fmt.Sprint(i)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := down.searches.Load(); n != 0 {
+		t.Errorf("unhealthy upstream got %d searches, want 0", n)
+	}
+
+	up.status.Store(http.StatusServiceUnavailable)
+	c.CheckHealth(t.Context())
+	if err := c.Ping(t.Context()); !errors.Is(err, ErrNoUpstream) {
+		t.Errorf("Ping with every upstream down = %v, want ErrNoUpstream", err)
+	}
+
+	// Upstreams return to rotation once they answer again
+	down.status.Store(http.StatusOK)
+	c.CheckHealth(t.Context())
+	if err := c.Ping(t.Context()); err != nil {
+		t.Errorf("Ping after recovery = %v", err)
+	}
+}
+
+func TestBreaker(t *testing.T) {
+	u := newUpstream(Upstream{URL: "http://searxng.invalid"}, egress.New())
+	errDown := errors.New("down")
+
+	for range breakerThreshold - 1 {
+		u.begin()
+		u.done(time.Millisecond, errDown)
+	}
+	if !u.allowed(time.Now()) {
+		t.Fatal("breaker opened before the threshold")
+	}
+	u.begin()
+	u.done(time.Millisecond, errDown)
+	if u.status().Breaker != BreakerOpen || u.allowed(time.Now()) {
+		t.Fatalf("breaker is %v after %d failures, want open", u.status().Breaker, breakerThreshold)
+	}
+
+	// After the cool-down a single probe is let through
+	later := time.Now().Add(breakerCooldown)
+	if !u.allowed(later) {
+		t.Fatal("breaker didn't allow a probe after the cool-down")
+	}
+	u.begin()
+	if u.status().Breaker != BreakerHalfOpen || u.allowed(later) {
+		t.Fatalf("breaker is %v during the probe, want half-open", u.status().Breaker)
+	}
+	// A failed probe opens it again at once
+	u.done(time.Millisecond, errDown)
+	if u.status().Breaker != BreakerOpen {
+		t.Fatalf("breaker is %v after a failed probe, want open", u.status().Breaker)
+	}
+
+	u.begin()
+	u.done(time.Millisecond, nil)
+	if s := u.status(); s.Breaker != BreakerClosed || s.Latency != time.Millisecond {
+		t.Errorf("status after a successful probe = %+v, want closed", s)
+	}
+}
@@ -0,0 +1,66 @@
+// Package settings holds operator toggles that can be changed at runtime
+// from the admin dashboard. They are stored in Postgres so every replica
+// picks them up on its next refresh.
+package settings
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/AletisSearch/aletis/internal/db"
+	"github.com/jackc/pgx/v5"
+)
+
+const keyAIEnabled = "ai_enabled"
+
+type Settings struct {
+	q         *db.Queries
+	aiEnabled atomic.Bool
+}
+
+// New returns settings with their defaults. Without a database changes only
+// last until the process exits.
+func New(q *db.Queries) *Settings {
+	s := &Settings{q: q}
+	s.aiEnabled.Store(true)
+	return s
+}
+
+// AIEnabled reports whether AI answers are switched on. AI also has to be
+// enabled in the config for this to matter.
+func (s *Settings) AIEnabled() bool {
+	return s == nil || s.aiEnabled.Load()
+}
+
+func (s *Settings) SetAIEnabled(ctx context.Context, enabled bool) error {
+	if s.q != nil {
+		err := s.q.SetSetting(ctx, db.SetSettingParams{Key: keyAIEnabled, Value: strconv.FormatBool(enabled)})
+		if err != nil {
+			return err
+		}
+	}
+	s.aiEnabled.Store(enabled)
+	return nil
+}
+
+// Refresh loads the stored settings, keeping defaults for unset ones.
+func (s *Settings) Refresh(ctx context.Context) error {
+	if s.q == nil {
+		return nil
+	}
+	v, err := s.q.GetSetting(ctx, keyAIEnabled)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	enabled, err := strconv.ParseBool(v)
+	if err != nil {
+		return err
+	}
+	s.aiEnabled.Store(enabled)
+	return nil
+}
@@ -0,0 +1,50 @@
+package signing
+
+import "testing"
+
+func TestVerify(t *testing.T) {
+	s := New("key")
+	sig := s.Sign(Media, "https://example.com/a.png", "200")
+	for _, tt := range []struct {
+		name    string
+		signer  *Signer
+		sig     string
+		purpose Purpose
+		parts   []string
+		valid   bool
+	}{
+		{"same parts", s, sig, Media, []string{"https://example.com/a.png", "200"}, true},
+		{"other key", New("other"), sig, Media, []string{"https://example.com/a.png", "200"}, false},
+		{"other purpose", s, sig, Redirect, []string{"https://example.com/a.png", "200"}, false},
+		{"other part", s, sig, Media, []string{"https://example.com/b.png", "200"}, false},
+		{"parts moved across the boundary", s, sig, Media, []string{"https://example.com/a.png2", "00"}, false},
+		{"parts joined", s, sig, Media, []string{"https://example.com/a.png200"}, false},
+		{"part left out", s, sig, Media, []string{"https://example.com/a.png"}, false},
+		{"truncated", s, sig[:len(sig)-1], Media, []string{"https://example.com/a.png", "200"}, false},
+		{"not base64", s, "!" + sig[1:], Media, []string{"https://example.com/a.png", "200"}, false},
+		{"empty", s, "", Media, []string{"https://example.com/a.png", "200"}, false},
+	} {
+		if got := tt.signer.Verify(tt.sig, tt.purpose, tt.parts...); got != tt.valid {
+			t.Errorf("%s: Verify = %v, want %v", tt.name, got, tt.valid)
+		}
+	}
+}
+
+// TestPurposes checks that no purpose accepts the signature of another, in
+// particular that a redirect of a query to a target can't be made from the
+// media link of an image.
+func TestPurposes(t *testing.T) {
+	s := New("key")
+	purposes := []Purpose{Redirect, Media, Clicks}
+	for _, signed := range purposes {
+		sig := s.Sign(signed, "media", "https://example.com/", "0")
+		for _, verified := range purposes {
+			if got := s.Verify(sig, verified, "media", "https://example.com/", "0"); got != (signed == verified) {
+				t.Errorf("signed for %s, Verify for %s = %v", signed, verified, got)
+			}
+		}
+	}
+	if s.Sign(Redirect, "a") == s.Sign(Redirect+"a") {
+		t.Error("purpose and first part not separated")
+	}
+}
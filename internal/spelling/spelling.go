@@ -0,0 +1,320 @@
+// Package spelling corrects misspelled queries without relying on the
+// engines behind SearXNG. Words come from a bundled frequency list and from
+// the queries searched on this instance, and are looked up with symmetric
+// delete: every word is indexed under the strings left by deleting up to
+// maxDistance of its letters, so that a misspelling shares an entry with the
+// words it is close to.
+package spelling
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	_ "embed"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/AletisSearch/aletis/internal/querylog"
+)
+
+// words.txt lists the most frequent words of English technical
+// documentation with their counts, one per line.
+//
+//go:embed words.txt
+var bundled string
+
+const (
+	maxDistance = 2
+	// prefixLength bounds the letters of a word that are indexed. Longer
+	// words are found through their prefix and checked in full, which
+	// keeps the index small.
+	prefixLength = 7
+	// minWordLength leaves short words, which have too many neighbours to
+	// correct reliably, as they are.
+	minWordLength = 3
+	// With auto-correct on, typos are only corrected without asking when
+	// they are one edit away from a common word at least autoMinLength
+	// letters long.
+	autoMinLength = 5
+	autoMinCount  = 50
+	// queryWordWeight is what a word counts for each search of a popular
+	// query containing it.
+	queryWordWeight = 20
+	popularWindow   = time.Hour * 24 * 30
+	popularLimit    = 20000
+)
+
+// Correction is a corrected query.
+type Correction struct {
+	Query string
+	// Auto is set when auto-correct is on and the typos are clear enough to
+	// search the correction instead of the query.
+	Auto bool
+}
+
+// Speller corrects queries with a dictionary rebuilt from the query log.
+type Speller struct {
+	log  *querylog.QueryLog
+	auto bool
+
+	mu   sync.RWMutex
+	dict *dictionary
+	// searched are the words of queries searched again, which are taken
+	// as real terms and never corrected
+	searched map[string]bool
+}
+
+// New creates a speller with the bundled words. log may be nil, then the
+// bundled words are all it knows. Corrections are only suggested unless
+// autoCorrect is set.
+func New(log *querylog.QueryLog, autoCorrect bool) *Speller {
+	return &Speller{log: log, auto: autoCorrect, dict: build(bundledCounts())}
+}
+
+func bundledCounts() map[string]int64 {
+	counts := map[string]int64{}
+	sc := bufio.NewScanner(strings.NewReader(bundled))
+	for sc.Scan() {
+		w, c, ok := strings.Cut(sc.Text(), " ")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.ParseInt(c, 10, 64); err == nil {
+			counts[w] = n
+		}
+	}
+	return counts
+}
+
+// Refresh rebuilds the dictionary with the words of popular queries. Only
+// those are suggested as corrections, the words of other queries searched
+// again are only left as they are.
+func (s *Speller) Refresh(ctx context.Context) error {
+	if s == nil || s.log == nil {
+		return nil
+	}
+	popular, err := s.log.Popular(ctx, popularWindow, popularLimit)
+	if err != nil {
+		return err
+	}
+	repeated, err := s.log.Repeated(ctx, popularWindow, popularLimit)
+	if err != nil {
+		return err
+	}
+	searched := map[string]bool{}
+	for _, r := range repeated {
+		for _, w := range strings.Fields(r.Query) {
+			searched[w] = true
+		}
+	}
+	counts := bundledCounts()
+	for _, p := range popular {
+		for _, w := range strings.Fields(p.Query) {
+			if isWord(w) {
+				counts[w] += p.Searches * queryWordWeight
+			}
+		}
+	}
+	d := build(counts)
+	s.mu.Lock()
+	s.dict, s.searched = d, searched
+	s.mu.Unlock()
+	return nil
+}
+
+// Correct returns the query with its unknown words replaced by the closest
+// known ones, and false when there was nothing to correct. Words for which
+// keep returns true, such as those of the results of the query, are left as
+// they are.
+func (s *Speller) Correct(query string, keep func(word string) bool) (Correction, bool) {
+	if s == nil {
+		return Correction{}, false
+	}
+	s.mu.RLock()
+	d, searched := s.dict, s.searched
+	s.mu.RUnlock()
+
+	tokens := strings.Fields(query)
+	changed := false
+	auto := s.auto
+	for i, t := range tokens {
+		w := strings.ToLower(t)
+		if !isWord(w) || len([]rune(w)) < minWordLength || searched[w] || (keep != nil && keep(w)) {
+			continue
+		}
+		best, dist, ok := d.lookup(w)
+		if !ok || dist == 0 {
+			continue
+		}
+		tokens[i] = best
+		changed = true
+		auto = auto && dist == 1 && len([]rune(w)) >= autoMinLength && d.counts[best] >= autoMinCount
+	}
+	if !changed {
+		return Correction{}, false
+	}
+	return Correction{Query: strings.Join(tokens, " "), Auto: auto}, true
+}
+
+// Seen returns a keep function for Correct reporting whether a word is one
+// of those of texts.
+func Seen(texts ...string) func(word string) bool {
+	words := map[string]bool{}
+	for _, t := range texts {
+		for _, w := range strings.FieldsFunc(strings.ToLower(t), notWordRune) {
+			words[w] = true
+		}
+	}
+	return func(word string) bool {
+		return words[word]
+	}
+}
+
+func notWordRune(r rune) bool {
+	return !unicode.IsLetter(r) && r != '\''
+}
+
+// isWord reports whether s is made of letters only. Anything else, such as
+// numbers, operators and URLs, is never corrected.
+func isWord(s string) bool {
+	if s == "" {
+		return false
+	}
+	return strings.IndexFunc(s, notWordRune) == -1
+}
+
+type dictionary struct {
+	words   []string
+	counts  map[string]int64
+	deletes map[string][]int32
+}
+
+func build(counts map[string]int64) *dictionary {
+	d := &dictionary{
+		words:   make([]string, 0, len(counts)),
+		counts:  counts,
+		deletes: map[string][]int32{},
+	}
+	for w := range counts {
+		i := int32(len(d.words))
+		d.words = append(d.words, w)
+		for del := range deletes(prefix(w)) {
+			d.deletes[del] = append(d.deletes[del], i)
+		}
+	}
+	return d
+}
+
+func prefix(w string) string {
+	r := []rune(w)
+	return string(r[:min(len(r), prefixLength)])
+}
+
+// deletes returns s and the strings left by deleting up to maxDistance of
+// its letters.
+func deletes(s string) map[string]struct{} {
+	out := map[string]struct{}{s: {}}
+	level := []string{s}
+	for range maxDistance {
+		var next []string
+		for _, w := range level {
+			r := []rune(w)
+			if len(r) <= 1 {
+				continue
+			}
+			for i := range r {
+				del := string(r[:i]) + string(r[i+1:])
+				if _, ok := out[del]; !ok {
+					out[del] = struct{}{}
+					next = append(next, del)
+				}
+			}
+		}
+		level = next
+	}
+	return out
+}
+
+// lookup finds the known word closest to w, the most frequent one among
+// equally close words.
+func (d *dictionary) lookup(w string) (string, int, bool) {
+	if _, ok := d.counts[w]; ok {
+		return w, 0, true
+	}
+	// Short words are close to too many others for two edits to mean much
+	limit := min(maxDistance, max(1, len([]rune(w))/4))
+	var (
+		best     string
+		bestDist = limit + 1
+		seen     = map[int32]bool{}
+	)
+	for del := range deletes(prefix(w)) {
+		for _, i := range d.deletes[del] {
+			if seen[i] {
+				continue
+			}
+			seen[i] = true
+			cand := d.words[i]
+			dist := distance(w, cand, limit)
+			if dist < 0 {
+				continue
+			}
+			if c := cmp.Compare(dist, bestDist); c < 0 || (c == 0 && d.counts[cand] > d.counts[best]) {
+				best, bestDist = cand, dist
+			}
+		}
+	}
+	if best == "" {
+		return "", 0, false
+	}
+	return best, bestDist, true
+}
+
+// distance is the edit distance between a and b counting swapped adjacent
+// letters as one edit, or -1 when it is over limit.
+func distance(a, b string, limit int) int {
+	ra, rb := []rune(a), []rune(b)
+	if abs(len(ra)-len(rb)) > limit {
+		return -1
+	}
+	// Three rows are enough to look back for transpositions
+	prev2 := make([]int, len(rb)+1)
+	prev := make([]int, len(rb)+1)
+	cur := make([]int, len(rb)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		cur[0] = i
+		rowMin := cur[0]
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+			if i > 1 && j > 1 && ra[i-1] == rb[j-2] && ra[i-2] == rb[j-1] {
+				cur[j] = min(cur[j], prev2[j-2]+1)
+			}
+			rowMin = min(rowMin, cur[j])
+		}
+		if rowMin > limit {
+			return -1
+		}
+		prev2, prev, cur = prev, cur, prev2
+	}
+	if d := prev[len(rb)]; d <= limit {
+		return d
+	}
+	return -1
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
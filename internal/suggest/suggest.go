@@ -0,0 +1,183 @@
+// Package suggest completes partly typed queries from the queries popular on
+// this instance and the AI expansions cached for them. The index is rebuilt
+// periodically and kept in memory so that lookups take microseconds.
+package suggest
+
+import (
+	"cmp"
+	"context"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	aiclient "github.com/AletisSearch/aletis/internal/aiClient"
+	"github.com/AletisSearch/aletis/internal/querylog"
+)
+
+const (
+	popularWindow = time.Hour * 24 * 30
+	popularLimit  = 50000
+	// expandLimit bounds the popular queries whose expansions are looked
+	// up at each rebuild.
+	expandLimit = 500
+	// expansionWeight is the share of the searches of a query that its
+	// expansions are ranked with.
+	expansionWeight = 0.25
+	// MaxSuggestions is the most suggestions returned for a prefix.
+	MaxSuggestions = 8
+	// shortPrefix is the longest prefix, in bytes, whose suggestions are
+	// computed ahead. Short prefixes match too many queries to rank at
+	// lookup.
+	shortPrefix = 2
+	maxLength   = 100
+)
+
+type entry struct {
+	query string
+	score float64
+}
+
+// index holds the queries sorted so that the matches of a prefix are one
+// contiguous range.
+type index struct {
+	entries []entry
+	short   map[string][]string
+}
+
+func build(scores map[string]float64) *index {
+	idx := &index{
+		entries: make([]entry, 0, len(scores)),
+		short:   map[string][]string{},
+	}
+	for q, s := range scores {
+		idx.entries = append(idx.entries, entry{query: q, score: s})
+	}
+	slices.SortFunc(idx.entries, func(a, b entry) int {
+		return strings.Compare(a.query, b.query)
+	})
+
+	byPrefix := map[string][]entry{}
+	for _, e := range idx.entries {
+		for n := 1; n <= min(shortPrefix, len(e.query)); n++ {
+			if !utf8.ValidString(e.query[:n]) {
+				continue
+			}
+			byPrefix[e.query[:n]] = append(byPrefix[e.query[:n]], e)
+		}
+	}
+	for p, entries := range byPrefix {
+		idx.short[p] = top(entries, MaxSuggestions)
+	}
+	return idx
+}
+
+// top returns the queries of the n best scored entries.
+func top(entries []entry, n int) []string {
+	entries = slices.Clone(entries)
+	slices.SortStableFunc(entries, func(a, b entry) int {
+		return cmp.Compare(b.score, a.score)
+	})
+	out := make([]string, 0, min(n, len(entries)))
+	for _, e := range entries[:min(n, len(entries))] {
+		out = append(out, e.query)
+	}
+	return out
+}
+
+func (idx *index) lookup(prefix string, n int) []string {
+	if len(prefix) <= shortPrefix {
+		s := idx.short[prefix]
+		return s[:min(n, len(s))]
+	}
+	start := sort.Search(len(idx.entries), func(i int) bool {
+		return idx.entries[i].query >= prefix
+	})
+	end := start
+	for end < len(idx.entries) && strings.HasPrefix(idx.entries[end].query, prefix) {
+		end++
+	}
+	return top(idx.entries[start:end], n)
+}
+
+// Suggester completes queries. Without a query log it knows no queries and
+// suggests nothing.
+type Suggester struct {
+	log *querylog.QueryLog
+	ai  *aiclient.Client
+
+	mu  sync.RWMutex
+	idx *index
+}
+
+// New creates a suggester. ai may be nil, then only queries that were
+// searched are suggested.
+func New(log *querylog.QueryLog, ai *aiclient.Client) *Suggester {
+	return &Suggester{log: log, ai: ai, idx: build(nil)}
+}
+
+// Rebuild indexes the popular queries and the cached expansions of the most
+// popular ones. Expansions are only looked up for queries that are popular
+// already so that they never reveal what a single person searched for.
+func (s *Suggester) Rebuild(ctx context.Context) error {
+	if s == nil || s.log == nil {
+		return nil
+	}
+	popular, err := s.log.Popular(ctx, popularWindow, popularLimit)
+	if err != nil {
+		return err
+	}
+	scores := make(map[string]float64, len(popular))
+	for _, p := range popular {
+		scores[p.Query] = float64(p.Searches)
+	}
+	if s.ai != nil {
+		for _, p := range popular[:min(len(popular), expandLimit)] {
+			// The search handler asks for the expansion of the query in
+			// brackets
+			out, err := s.ai.CachedQueryExpand(ctx, fmt.Sprintf("[%s]", p.Query))
+			if err != nil {
+				continue
+			}
+			for line := range strings.Lines(out.Content) {
+				q := querylog.Normalize(line)
+				if q == "" || utf8.RuneCountInString(q) > maxLength {
+					continue
+				}
+				scores[q] = max(scores[q], float64(p.Searches)*expansionWeight)
+			}
+		}
+	}
+
+	idx := build(scores)
+	s.mu.Lock()
+	s.idx = idx
+	s.mu.Unlock()
+	slog.Debug("rebuilt suggestions", "Queries", len(idx.entries))
+	return nil
+}
+
+// Suggest returns up to n completions of prefix, best first.
+func (s *Suggester) Suggest(prefix string, n int) []string {
+	if s == nil {
+		return nil
+	}
+	// Queries are indexed normalized, but a trailing space tells that the
+	// next word has not been started yet
+	trailing := strings.HasSuffix(prefix, " ")
+	prefix = querylog.Normalize(prefix)
+	if prefix == "" {
+		return nil
+	}
+	if trailing {
+		prefix += " "
+	}
+	s.mu.RLock()
+	idx := s.idx
+	s.mu.RUnlock()
+	return idx.lookup(prefix, min(n, MaxSuggestions))
+}
@@ -0,0 +1,45 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var _ pgx.QueryTracer = PgxTracer{}
+
+// PgxTracer starts a span for every query run through a pgx connection.
+// Query arguments are never recorded since they hold user queries.
+type PgxTracer struct{}
+
+func (PgxTracer) TraceQueryStart(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryStartData) context.Context {
+	ctx, _ = Tracer().Start(ctx, queryName(data.SQL),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemNamePostgreSQL,
+			attribute.String("db.query.text", data.SQL),
+		),
+	)
+	return ctx
+}
+
+func (PgxTracer) TraceQueryEnd(ctx context.Context, conn *pgx.Conn, data pgx.TraceQueryEndData) {
+	span := trace.SpanFromContext(ctx)
+	span.SetAttributes(attribute.Int64("db.response.returned_rows", data.CommandTag.RowsAffected()))
+	End(span, data.Err)
+}
+
+// queryName uses the sqlc "-- name: X" header as the span name when there is
+// one.
+func queryName(sql string) string {
+	if rest, ok := strings.CutPrefix(sql, "-- name: "); ok {
+		if name, _, ok := strings.Cut(rest, " "); ok {
+			return "db " + name
+		}
+	}
+	return "db query"
+}
@@ -0,0 +1,102 @@
+// Package tracing sets up OpenTelemetry tracing. Without an exporter the
+// global no-op provider stays in place and spans cost next to nothing.
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/AletisSearch/aletis/internal/config"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.40.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const name = "github.com/AletisSearch/aletis"
+
+// trustParent is set when requests come through a proxy that only lets
+// trusted callers send traceparent headers.
+var trustParent bool
+
+// Tracer returns the tracer used by all of Aletis.
+func Tracer() trace.Tracer {
+	return otel.Tracer(name)
+}
+
+// Start starts a span named name as a child of the span in ctx.
+func Start(ctx context.Context, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	return Tracer().Start(ctx, name, trace.WithAttributes(attrs...))
+}
+
+// End records err on the span, if any, and ends it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// Setup installs the exporter selected by the config as the global tracer
+// provider. The returned function flushes pending spans and must be called
+// on shutdown.
+func Setup(ctx context.Context, conf *config.Config) (func(context.Context) error, error) {
+	if conf.TracingExporter == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+	trustParent = conf.TracingTrusted
+
+	var opts []otlptracehttp.Option
+	if conf.TracingEndpoint != "" {
+		opts = append(opts, otlptracehttp.WithEndpointURL(conf.TracingEndpoint))
+	}
+	exporter, err := otlptracehttp.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create trace exporter: %w", err)
+	}
+	res, err := resource.New(ctx,
+		resource.WithAttributes(semconv.ServiceName("aletis")),
+		resource.WithFromEnv(),
+		resource.WithTelemetrySDK(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create trace resource: %w", err)
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(conf.TracingRatio))),
+	)
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	slog.Info("tracing enabled", "exporter", conf.TracingExporter, "ratio", conf.TracingRatio)
+	return provider.Shutdown, nil
+}
+
+// StartRequest starts a server span for r. Requests start a new trace, so
+// that clients can't pick trace IDs or force spans to be sampled, unless
+// TRACING_TRUST_PARENT is set, in which case the trace of the caller is
+// continued when it sent one.
+func StartRequest(r *http.Request, name string, attrs ...attribute.KeyValue) (context.Context, trace.Span) {
+	if !trustParent {
+		return Tracer().Start(r.Context(), name,
+			trace.WithNewRoot(),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(attrs...),
+		)
+	}
+	ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+	return Tracer().Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindServer),
+		trace.WithAttributes(attrs...),
+	)
+}
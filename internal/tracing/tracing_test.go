@@ -0,0 +1,127 @@
+package tracing
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	remoteTraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	traceparent   = "00-" + remoteTraceID + "-00f067aa0ba902b7-01"
+)
+
+// record installs a provider that never samples on its own, so that only a
+// sampled parent gets spans recorded unless sampleAll is set.
+func record(t *testing.T, sampleAll bool) *tracetest.SpanRecorder {
+	t.Helper()
+	sampler := sdktrace.ParentBased(sdktrace.NeverSample())
+	if sampleAll {
+		sampler = sdktrace.AlwaysSample()
+	}
+	rec := tracetest.NewSpanRecorder()
+	provider := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec), sdktrace.WithSampler(sampler))
+	prevProvider, prevPropagator, prevTrust := otel.GetTracerProvider(), otel.GetTextMapPropagator(), trustParent
+	otel.SetTracerProvider(provider)
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	t.Cleanup(func() {
+		otel.SetTracerProvider(prevProvider)
+		otel.SetTextMapPropagator(prevPropagator)
+		trustParent = prevTrust
+	})
+	return rec
+}
+
+func TestStartRequestIgnoresParent(t *testing.T) {
+	rec := record(t, false)
+	trustParent = false
+
+	r := httptest.NewRequest("GET", "/search?q=go", nil)
+	r.Header.Set("traceparent", traceparent)
+	_, span := StartRequest(r, "handlers.Search")
+	span.End()
+
+	// The sampled flag of the caller doesn't get the span recorded
+	if spans := rec.Ended(); len(spans) != 0 {
+		t.Fatalf("recorded %d spans, want 0", len(spans))
+	}
+	if sc := span.SpanContext(); sc.TraceID().String() == remoteTraceID {
+		t.Errorf("span continued the trace of the caller")
+	}
+}
+
+func TestStartRequestNewRoot(t *testing.T) {
+	rec := record(t, true)
+	trustParent = false
+
+	r := httptest.NewRequest("GET", "/search?q=go", nil)
+	r.Header.Set("traceparent", traceparent)
+	_, span := StartRequest(r, "handlers.Search", attribute.Bool("aletis.ai", true))
+	span.End()
+
+	spans := rec.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(spans))
+	}
+	s := spans[0]
+	if s.Parent().IsValid() || s.SpanContext().TraceID().String() == remoteTraceID {
+		t.Errorf("span has parent %v, want a new root", s.Parent())
+	}
+	if s.Name() != "handlers.Search" || s.SpanKind() != trace.SpanKindServer {
+		t.Errorf("span = %q %v, want handlers.Search server", s.Name(), s.SpanKind())
+	}
+	if attrs := s.Attributes(); len(attrs) != 1 || attrs[0] != attribute.Bool("aletis.ai", true) {
+		t.Errorf("attributes = %v", attrs)
+	}
+}
+
+func TestStartRequestTrustedParent(t *testing.T) {
+	rec := record(t, false)
+	trustParent = true
+
+	r := httptest.NewRequest("GET", "/search?q=go", nil)
+	r.Header.Set("traceparent", traceparent)
+	ctx, span := StartRequest(r, "handlers.Search")
+	_, child := Start(ctx, "searxng.Search")
+	End(child, nil)
+	span.End()
+
+	spans := rec.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("recorded %d spans, want 2", len(spans))
+	}
+	server, client := spans[1], spans[0]
+	if server.SpanContext().TraceID().String() != remoteTraceID || !server.Parent().IsRemote() {
+		t.Errorf("server span has parent %v, want the caller's span", server.Parent())
+	}
+	if client.Parent().SpanID() != server.SpanContext().SpanID() {
+		t.Errorf("child span has parent %v, want the server span", client.Parent())
+	}
+}
+
+func TestEndRecordsError(t *testing.T) {
+	rec := record(t, true)
+
+	_, span := Start(t.Context(), "llm.Run")
+	End(span, errors.New("bad gateway"))
+
+	spans := rec.Ended()
+	if len(spans) != 1 {
+		t.Fatalf("recorded %d spans, want 1", len(spans))
+	}
+	s := spans[0]
+	if s.Status().Code != codes.Error || s.Status().Description != "bad gateway" {
+		t.Errorf("status = %v", s.Status())
+	}
+	if events := s.Events(); len(events) != 1 || events[0].Name != "exception" {
+		t.Errorf("events = %v, want the recorded error", events)
+	}
+}
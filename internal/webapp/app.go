@@ -2,6 +2,7 @@ package webapp
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
@@ -9,33 +10,191 @@ import (
 	"time"
 
 	aiclient "github.com/AletisSearch/aletis/internal/aiClient"
+	"github.com/AletisSearch/aletis/internal/alerts"
+	"github.com/AletisSearch/aletis/internal/apikey"
+	"github.com/AletisSearch/aletis/internal/cache"
+	"github.com/AletisSearch/aletis/internal/clicks"
+	"github.com/AletisSearch/aletis/internal/clientip"
 	"github.com/AletisSearch/aletis/internal/config"
 	"github.com/AletisSearch/aletis/internal/db"
+	"github.com/AletisSearch/aletis/internal/domainrules"
+	"github.com/AletisSearch/aletis/internal/egress"
+	"github.com/AletisSearch/aletis/internal/federation"
 	"github.com/AletisSearch/aletis/internal/handlers"
+	"github.com/AletisSearch/aletis/internal/health"
+	"github.com/AletisSearch/aletis/internal/history"
+	"github.com/AletisSearch/aletis/internal/icons"
+	"github.com/AletisSearch/aletis/internal/metrics"
+	"github.com/AletisSearch/aletis/internal/querylog"
+	"github.com/AletisSearch/aletis/internal/ratelimit"
 	"github.com/AletisSearch/aletis/internal/searxng"
+	"github.com/AletisSearch/aletis/internal/settings"
+	"github.com/AletisSearch/aletis/internal/signing"
+	"github.com/AletisSearch/aletis/internal/spelling"
+	"github.com/AletisSearch/aletis/internal/suggest"
 	"github.com/AletisSearch/aletis/web"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	"github.com/go-chi/httprate"
 )
 
-func NewApp(ctx context.Context, wg *sync.WaitGroup, conf *config.Config, q *db.Queries) (*chi.Mux, error) {
+func NewApp(ctx context.Context, wg *sync.WaitGroup, conf *config.Config, q *db.Queries, checker *health.Checker) (*chi.Mux, error) {
+	cacheStore := newCacheStore(conf, q)
 	var aiClient *aiclient.Client
 	if conf.AIEnabled {
-		aiClient = aiclient.NewClient(conf.OpenAIURL, conf.OpenAIKey, q)
+		aiClient = aiclient.NewClient(conf.OpenAIURL, conf.OpenAIKey, cacheStore, q)
 	}
-	searchClient := searxng.NewClient(conf.SearxngHost, q)
+	upstreams := make([]searxng.Upstream, len(conf.SearxngHosts))
+	for i, h := range conf.SearxngHosts {
+		upstreams[i] = searxng.Upstream{URL: h.URL, Weight: h.Weight}
+	}
+	egressFactory := egress.New(
+		egress.WithAllowHosts(conf.EgressAllowHosts...),
+		egress.WithDenyHosts(conf.EgressDenyHosts...),
+	)
+	searchClient := searxng.NewClient(upstreams, cacheStore, q, egressFactory)
+	signer := signing.New(conf.SecretKey)
+
+	// Upstreams failing their health check are skipped until they recover
+	searchClient.CheckHealth(ctx)
+	wg.Go(func() {
+		t := time.Tick(time.Second * 10)
+		for {
+			select {
+			case <-t:
+				searchClient.CheckHealth(ctx)
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+	checker.Add("searxng", time.Second*5, searchClient.Ping)
+	if aiClient != nil && conf.ReadyCheckAI {
+		checker.AddOptional("llm", time.Minute, aiClient.Ping)
+	}
+
+	// Settings and domain rules are changed from /admin and shared between
+	// replicas through the database
+	runtimeSettings := settings.New(q)
+	var rules *domainrules.Rules
+	if q != nil {
+		rules = domainrules.New(q)
+		refreshAdmin(ctx, runtimeSettings, rules)
+		wg.Go(func() {
+			t := time.Tick(time.Second * 30)
+			for {
+				select {
+				case <-t:
+					refreshAdmin(ctx, runtimeSettings, rules)
+				case <-ctx.Done():
+					return
+				}
+			}
+		})
+	}
+
+	// History stays nil unless the operator enables it
+	var hist *history.History
+	if conf.HistoryEnabled {
+		hist = history.New(q)
+	}
+
+	// Click statistics are rebuilt from the recorded clicks now and then and
+	// shared between replicas through the database
+	var clickStats *clicks.Clicks
+	if conf.ClicksActive() && q != nil {
+		clickStats = clicks.New(q, signer)
+		aggregateClicks(ctx, conf, clickStats)
+		wg.Go(func() {
+			t := time.Tick(time.Minute * 10)
+			for {
+				select {
+				case <-t:
+					aggregateClicks(ctx, conf, clickStats)
+				case <-ctx.Done():
+					return
+				}
+			}
+		})
+	}
+
+	// The speller starts with the bundled words and learns the words of
+	// popular queries as they are counted
+	var queryLog *querylog.QueryLog
+	if conf.QueryLogActive() && q != nil {
+		queryLog = querylog.New(q)
+	}
+	speller := spelling.New(queryLog, conf.AutoCorrect)
+	suggester := suggest.New(queryLog, aiClient)
+	if queryLog != nil {
+		wg.Go(func() {
+			refreshSpeller(ctx, speller)
+			t := time.Tick(time.Hour)
+			for {
+				select {
+				case <-t:
+					refreshSpeller(ctx, speller)
+				case <-ctx.Done():
+					return
+				}
+			}
+		})
+		wg.Go(func() {
+			rebuildSuggestions(ctx, suggester)
+			t := time.Tick(time.Minute * 15)
+			for {
+				select {
+				case <-t:
+					rebuildSuggestions(ctx, suggester)
+				case <-ctx.Done():
+					return
+				}
+			}
+		})
+	}
+
+	searchLimitStore, err := ratelimit.NewStore(conf, q, "search")
+	if err != nil {
+		return nil, err
+	}
+	iconsLimitStore, err := ratelimit.NewStore(conf, q, "icons")
+	if err != nil {
+		return nil, err
+	}
+	suggestLimitStore, err := ratelimit.NewStore(conf, q, "suggest")
+	if err != nil {
+		return nil, err
+	}
+	redirectLimitStore, err := ratelimit.NewStore(conf, q, "redirect")
+	if err != nil {
+		return nil, err
+	}
+
+	if conf.AlertsEnabled {
+		scheduler := alerts.New(q, searchClient, conf.AlertsInterval, conf.AlertsWebhookURL, egressFactory)
+		wg.Go(func() {
+			scheduler.Run(ctx)
+		})
+	}
+
+	fed, err := newFederation(conf, q, searchClient, egressFactory)
+	if err != nil {
+		return nil, err
+	}
+
+	iconsClient := icons.New(cacheStore, conf.IconsFallbackURL, egressFactory)
 
 	wg.Go(func() {
 		<-ctx.Done()
 		slog.Info("Closing Search Client")
 		searchClient.Close()
+		iconsClient.Close()
 	})
 
 	r := chi.NewRouter()
-	r.Use(middleware.RealIP)
+	r.Use(clientip.Middleware(conf.TrustedProxies))
 	r.Use(middleware.Logger)
 	r.Use(middleware.Recoverer)
+	r.Use(metrics.Middleware)
 	r.Use(middleware.CleanPath)
 	r.Use(middleware.SetHeader("X-Frame-Options", "DENY"))
 	r.Use(middleware.SetHeader("X-Content-Type-Options", "nosniff"))
@@ -45,6 +204,8 @@ func NewApp(ctx context.Context, wg *sync.WaitGroup, conf *config.Config, q *db.
 	r.Use(middleware.SetHeader("Cross-Origin-Embedder-Policy", "require-corp"))
 	r.Use(middleware.SetHeader("Cross-Origin-Resource-Policy", "same-site"))
 	r.Use(middleware.SetHeader("Permissions-Policy", "geolocation=(), camera=(), microphone=(), interest-cohort=()"))
+	r.Get("/healthz", handlers.Healthz())
+	r.Get("/readyz", handlers.Readyz(checker))
 	r.Group(func(r chi.Router) {
 		r.Use(func(h http.Handler) http.Handler {
 			linkPreload, err := web.GetLinkPreload()
@@ -61,16 +222,90 @@ func NewApp(ctx context.Context, wg *sync.WaitGroup, conf *config.Config, q *db.
 				h.ServeHTTP(w, r)
 			})
 		})
-		r.Get("/", handlers.Home())
+		r.Get("/", handlers.Home(conf.HistoryEnabled))
 		r.Route("/search", func(r chi.Router) {
-			if conf.Public {
-				r.Use(httprate.LimitByRealIP(10, time.Minute))
+			if q != nil {
+				r.Use(apikey.Middleware(q))
+			}
+			r.Use(apikey.RateLimit(
+				"search",
+				conf.RateLimitSearch.Requests,
+				conf.RateLimitSearch.Window,
+				conf.Public && conf.RateLimitSearch.Requests > 0,
+				searchLimitStore,
+			))
+			if q != nil {
+				r.Use(apikey.Quota(q))
 			}
 			// /search
-			r.Get("/", handlers.Search(aiClient, searchClient))
+			r.Get("/", handlers.Search(aiClient, fed, hist, clickStats, queryLog, speller, signer, runtimeSettings, rules))
 		})
+		if hist != nil {
+			r.Route("/history", func(r chi.Router) {
+				// The lax history cookie still comes with form posts from other
+				// origins of the same site
+				r.Use(http.NewCrossOriginProtection().Handler)
+				r.Get("/", handlers.History(hist, conf.HistoryRetention))
+				r.Get("/saved", handlers.HistorySaved(hist, conf.AlertsEnabled))
+				r.Get("/export", handlers.HistoryExport(hist))
+				r.Post("/enable", handlers.HistoryEnable(hist))
+				r.Post("/disable", handlers.HistoryDisable(hist))
+				r.Post("/clear", handlers.HistoryClear(hist))
+				r.Post("/delete", handlers.HistoryDelete(hist))
+				r.Post("/clicks/delete", handlers.HistoryDeleteClick(hist))
+				r.Post("/saved", handlers.HistorySave(hist))
+				r.Post("/saved/delete", handlers.HistoryDeleteSaved(hist))
+				if conf.AlertsEnabled {
+					r.Post("/saved/alert", handlers.HistorySetAlert(hist))
+				}
+			})
+		}
+	})
+	r.Group(func(r chi.Router) {
+		// Icons and media are fetched from other sites for whoever asks, so
+		// they are limited on private instances too
+		r.Use(ratelimit.Limit("icons", conf.RateLimitIcons, iconsLimitStore))
+		r.Get("/icons/sprite", handlers.IconSprite(iconsClient))
+		r.Get("/icons/{domain}", handlers.Icons(iconsClient))
+		r.Get("/media", handlers.Media(cacheStore, signer, egressFactory))
+	})
+	r.Group(func(r chi.Router) {
+		if conf.Public {
+			r.Use(ratelimit.Limit("suggest", conf.RateLimitSuggest, suggestLimitStore))
+		}
+		r.Get("/suggest", handlers.Suggest(suggester))
 	})
-	r.Get("/icons/{domain}", handlers.Icons(q))
+	if hist != nil || clickStats != nil {
+		r.Group(func(r chi.Router) {
+			if conf.Public {
+				r.Use(ratelimit.Limit("redirect", conf.RateLimitRedirect, redirectLimitStore))
+			}
+			r.Get("/r", handlers.Redirect(hist, clickStats, signer))
+		})
+	}
+	if conf.AlertsEnabled {
+		r.Get("/alerts/{token}", handlers.AlertFeed(q))
+	}
+	if conf.AdminEnabled() {
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(middleware.NoCache)
+			r.Use(middleware.BasicAuth("aletis admin", map[string]string{
+				conf.AdminUsername: conf.AdminPassword,
+			}))
+			// Browsers resend basic auth credentials on cross-site form posts
+			r.Use(http.NewCrossOriginProtection().Handler)
+			r.Get("/", handlers.AdminDashboard(conf, q, searchClient, runtimeSettings, rules))
+			r.Get("/cache/stats", handlers.AdminCacheStats(q))
+			r.Post("/cache/purge", handlers.AdminCachePurge(cacheStore))
+			if aiClient != nil {
+				r.Post("/ai", handlers.AdminSetAI(runtimeSettings))
+			}
+			if rules != nil {
+				r.Post("/rules", handlers.AdminSetRule(rules))
+				r.Post("/rules/delete", handlers.AdminDeleteRule(rules))
+			}
+		})
+	}
 	r.Handle("/assets/*", handlers.Assets(conf.Dev))
 
 	r.Get("/robots.txt", func(w http.ResponseWriter, r *http.Request) {
@@ -78,7 +313,94 @@ func NewApp(ctx context.Context, wg *sync.WaitGroup, conf *config.Config, q *db.
 		w.Write([]byte(`User-agent: *
 Disallow: /search
 Disallow: /icons
-Disallow: /assets`))
+Disallow: /media
+Disallow: /assets
+Disallow: /history
+Disallow: /r
+Disallow: /suggest
+Disallow: /alerts
+Disallow: /admin`))
 	})
 	return r, nil
 }
+
+func newCacheStore(conf *config.Config, q *db.Queries) cache.Store {
+	maxSize := make(map[string]int, len(conf.CacheMaxEntryKB))
+	for ns, kb := range conf.CacheMaxEntryKB {
+		maxSize[ns] = kb << 10
+	}
+	memory := func() cache.Store {
+		return cache.NewMemoryStore(int64(conf.CacheMemoryMB) << 20)
+	}
+	var store cache.Store
+	switch conf.CacheStore {
+	case config.CacheStorePostgres:
+		store = cache.NewPostgresStore(q)
+	case config.CacheStoreMemory:
+		store = memory()
+	default:
+		store = cache.NewTieredStore(memory(), cache.NewPostgresStore(q))
+	}
+	return cache.NewLimitStore(store, maxSize)
+}
+
+// newFederation searches the configured backends alongside SearXNG. Their
+// hosts are set by the operator and are trusted like the SearXNG ones.
+func newFederation(conf *config.Config, q *db.Queries, searchClient *searxng.Client, f *egress.Factory) (*federation.Federation, error) {
+	sources := make([]federation.Source, 0, len(conf.Federation))
+	for _, b := range conf.Federation {
+		var (
+			backend federation.Backend
+			err     error
+		)
+		// The timeout of the backend applies to each search through its
+		// context
+		client := f.Client(egress.WithTrusted())
+		switch b.Kind {
+		case config.FederationAletis:
+			backend, err = federation.NewAletis(b.Name, b.Target, client)
+		case config.FederationMediaWiki:
+			backend, err = federation.NewMediaWiki(b.Name, b.Target, client)
+		case config.FederationPostgres:
+			backend = federation.NewPostgres(b.Name, b.Target, q)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to create federated backend %q: %w", b.Name, err)
+		}
+		sources = append(sources, federation.Source{Name: b.Name, Backend: backend, Timeout: b.Timeout})
+	}
+	return federation.New(searchClient, sources...), nil
+}
+
+func refreshAdmin(ctx context.Context, s *settings.Settings, rules *domainrules.Rules) {
+	if err := s.Refresh(ctx); err != nil {
+		slog.Error("unable to refresh settings", "ERROR", err)
+	}
+	if err := rules.Refresh(ctx); err != nil {
+		slog.Error("unable to refresh domain rules", "ERROR", err)
+	}
+}
+
+func aggregateClicks(ctx context.Context, conf *config.Config, c *clicks.Clicks) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	if err := c.Aggregate(ctx, conf.ClicksRetention); err != nil {
+		slog.Error("unable to aggregate click statistics", "ERROR", err)
+	}
+}
+
+func refreshSpeller(ctx context.Context, s *spelling.Speller) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	if err := s.Refresh(ctx); err != nil {
+		slog.Error("unable to refresh spelling dictionary", "ERROR", err)
+	}
+}
+
+func rebuildSuggestions(ctx context.Context, s *suggest.Suggester) {
+	ctx, cancel := context.WithTimeout(ctx, time.Minute)
+	defer cancel()
+	if err := s.Rebuild(ctx); err != nil {
+		slog.Error("unable to rebuild suggestions", "ERROR", err)
+	}
+}
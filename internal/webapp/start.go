@@ -12,8 +12,15 @@ import (
 	"time"
 
 	sqlcdb "github.com/AletisSearch/aletis/db"
+	"github.com/AletisSearch/aletis/internal/cache"
+	"github.com/AletisSearch/aletis/internal/clicks"
 	"github.com/AletisSearch/aletis/internal/config"
 	"github.com/AletisSearch/aletis/internal/db"
+	"github.com/AletisSearch/aletis/internal/health"
+	"github.com/AletisSearch/aletis/internal/history"
+	"github.com/AletisSearch/aletis/internal/metrics"
+	"github.com/AletisSearch/aletis/internal/querylog"
+	"github.com/AletisSearch/aletis/internal/tracing"
 	_ "github.com/amacneil/dbmate/v2/pkg/driver/postgres"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -36,46 +43,40 @@ func Start(options ...config.Option) error {
 		return fmt.Errorf("failed to validate config: %w", err)
 	}
 
-	// Database
-	if err = sqlcdb.ApplyMigrations(conf); err != nil {
-		return err
-	}
-
-	database, err := pgxpool.New(ctx, conf.DBconnStr())
-	if err != nil {
-		return err
-	}
-	err = database.Ping(ctx)
+	shutdownTracing, err := tracing.Setup(ctx, conf)
 	if err != nil {
 		return err
 	}
 
-	queries := db.New(database)
-
-	wg.Go(func() {
-		t := time.Tick(5 * time.Minute)
-		for {
-			select {
-			case <-t:
-				ctxLimit, cancel := context.WithTimeout(ctx, time.Second*30)
-				defer cancel()
-				err := queries.DeleteOld(ctxLimit, time.Now())
-				if err != nil {
-					slog.Error("err running DB Cleanup", "ERR", err)
-				}
-			case <-ctx.Done():
-				slog.Info("Closing DB Cleanup")
-				return
-			}
+	// Database, optional when only the memory cache is used
+	checker := health.New()
+	var queries *db.Queries
+	if conf.DatabaseEnabled() {
+		database, err := openDatabase(ctx, conf)
+		if err != nil {
+			return err
 		}
-	})
+		queries = db.New(database)
+		metrics.RegisterPool(database)
+		// Probes are public, a short TTL keeps them from reaching the
+		// database on every request
+		checker.Add("postgres", time.Second*5, database.Ping)
+		checker.Add("migrations", time.Minute, func(context.Context) error {
+			return sqlcdb.CheckMigrations(conf)
+		})
+		wg.Go(func() {
+			dbCleanup(ctx, conf, queries)
+		})
+	} else {
+		slog.Warn("running without a database")
+	}
 
-	router, err := NewApp(ctx, &wg, conf, queries)
+	router, err := NewApp(ctx, &wg, conf, queries, checker)
 	if err != nil {
 		return fmt.Errorf("failed to create app: %w", err)
 	}
 
-	serverErrChan := make(chan error, 1)
+	serverErrChan := make(chan error, 2)
 
 	addr := ":" + conf.Port
 	server := &http.Server{
@@ -90,6 +91,24 @@ func Start(options ...config.Option) error {
 		}
 	}()
 
+	// Metrics get their own listener so they are never exposed publicly
+	var metricsServer *http.Server
+	if conf.MetricsPort != "" {
+		metricsAddr := ":" + conf.MetricsPort
+		mux := http.NewServeMux()
+		mux.Handle("GET /metrics", metrics.Handler())
+		metricsServer = &http.Server{
+			Addr:    metricsAddr,
+			Handler: mux,
+		}
+		go func() {
+			slog.Info("metrics listening", "addr", metricsAddr)
+			if err := metricsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				serverErrChan <- err
+			}
+		}()
+	}
+
 	quitChan := make(chan os.Signal, 1)
 	signal.Notify(quitChan, syscall.SIGINT, syscall.SIGTERM)
 
@@ -100,6 +119,14 @@ func Start(options ...config.Option) error {
 		slog.Info("received signal", "signal", sig)
 	}
 
+	// Fail readiness first so load balancers stop routing here before
+	// connections are drained
+	checker.Shutdown()
+	if conf.ShutdownDelay > 0 {
+		slog.Info("waiting before shutdown", "delay", conf.ShutdownDelay)
+		time.Sleep(conf.ShutdownDelay)
+	}
+
 	ctxTmt, cancelTmt := context.WithTimeout(ctx, time.Second*15)
 	defer cancelTmt()
 
@@ -107,10 +134,99 @@ func Start(options ...config.Option) error {
 	if err = server.Shutdown(ctxTmt); err != nil {
 		slog.Error("shutting down server", "ERR", err)
 	}
+	if metricsServer != nil {
+		if err = metricsServer.Shutdown(ctxTmt); err != nil {
+			slog.Error("shutting down metrics server", "ERR", err)
+		}
+	}
 
 	cancel()
 
 	wg.Wait()
 
+	if err = shutdownTracing(ctxTmt); err != nil {
+		slog.Error("flushing traces", "ERR", err)
+	}
+
 	return nil
 }
+
+func openDatabase(ctx context.Context, conf *config.Config) (*pgxpool.Pool, error) {
+	if err := sqlcdb.ApplyMigrations(conf); err != nil {
+		return nil, err
+	}
+
+	poolConf, err := pgxpool.ParseConfig(conf.DBconnStr())
+	if err != nil {
+		return nil, err
+	}
+	poolConf.ConnConfig.Tracer = tracing.PgxTracer{}
+	database, err := pgxpool.NewWithConfig(ctx, poolConf)
+	if err != nil {
+		return nil, err
+	}
+	if err = database.Ping(ctx); err != nil {
+		return nil, err
+	}
+	return database, nil
+}
+
+func dbCleanup(ctx context.Context, conf *config.Config, queries *db.Queries) {
+	t := time.Tick(5 * time.Minute)
+	for {
+		select {
+		case <-t:
+			ctxLimit, cancel := context.WithTimeout(ctx, time.Second*30)
+			defer cancel()
+			// Expired entries are kept a while to be served stale
+			err := queries.DeleteOld(ctxLimit, time.Now().Add(-cache.MaxStale))
+			if err != nil {
+				slog.Error("err running DB Cleanup", "ERR", err)
+			}
+			metrics.CleanupRun("cache", err)
+			if conf.CacheStore != config.CacheStoreMemory && conf.CacheMaxTableMB > 0 {
+				n, err := queries.EvictCache(ctxLimit, int64(conf.CacheMaxTableMB)<<20)
+				if err != nil {
+					slog.Error("err running cache eviction", "ERR", err)
+				} else if n > 0 {
+					slog.Info("Evicted cache entries", "Count", n)
+					metrics.CacheEvicted(n)
+				}
+				metrics.CleanupRun("cache_eviction", err)
+			}
+			if err = queries.DeleteOldAPIKeyUsage(ctxLimit); err != nil {
+				slog.Error("err running API key usage cleanup", "ERR", err)
+			}
+			metrics.CleanupRun("api_key_usage", err)
+			if err = queries.DeleteOldRateLimits(ctxLimit, time.Now().Add(-2*conf.RateLimitMaxWindow())); err != nil {
+				slog.Error("err running rate limit cleanup", "ERR", err)
+			}
+			metrics.CleanupRun("rate_limits", err)
+			if err = queries.DeleteOldEngineFailures(ctxLimit, time.Now().AddDate(0, 0, -7)); err != nil {
+				slog.Error("err running engine failure cleanup", "ERR", err)
+			}
+			metrics.CleanupRun("engine_failures", err)
+			if conf.HistoryEnabled {
+				if err = history.New(queries).Cleanup(ctxLimit, conf.HistoryRetention); err != nil {
+					slog.Error("err running history cleanup", "ERR", err)
+				}
+				metrics.CleanupRun("history", err)
+			}
+			if conf.ClicksActive() {
+				if err = clicks.New(queries, nil).Cleanup(ctxLimit, conf.ClicksRetention); err != nil {
+					slog.Error("err running click event cleanup", "ERR", err)
+				}
+				metrics.CleanupRun("click_events", err)
+			}
+			if conf.QueryLogActive() {
+				if err = querylog.New(queries).Cleanup(ctxLimit, conf.QueryLogRetention); err != nil {
+					slog.Error("err running query log cleanup", "ERR", err)
+				}
+				metrics.CleanupRun("query_log", err)
+			}
+		case <-ctx.Done():
+			slog.Info("Closing DB Cleanup")
+			return
+		}
+	}
+}
@@ -0,0 +1,44 @@
+// Fills the datalist of the search bar with completions of what is being
+// typed. Picking one searches it straight away.
+const input = document.getElementById("q");
+const list = document.getElementById("q-suggestions");
+
+if (input && list) {
+  let timer;
+  let controller;
+
+  input.addEventListener("input", (e) => {
+    // Browsers fire input without a typing inputType when an option is picked
+    if (e.inputType === undefined || e.inputType === "insertReplacementText") {
+      input.form.requestSubmit();
+      return;
+    }
+    clearTimeout(timer);
+    timer = setTimeout(async () => {
+      controller?.abort();
+      controller = new AbortController();
+      if (input.value.trim() === "") {
+        list.replaceChildren();
+        return;
+      }
+      try {
+        const res = await fetch("/suggest?q=" + encodeURIComponent(input.value), {
+          signal: controller.signal,
+        });
+        if (!res.ok) {
+          return;
+        }
+        const [, suggestions] = await res.json();
+        list.replaceChildren(
+          ...suggestions.map((s) => {
+            const option = document.createElement("option");
+            option.value = s;
+            return option;
+          }),
+        );
+      } catch {
+        // Aborted by newer input or offline, the search bar still works
+      }
+    }, 100);
+  });
+}
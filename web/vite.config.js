@@ -8,7 +8,7 @@ export default defineConfig({
     manifest: true,
     rollupOptions: {
       // overwrite default .html entry
-      input: ["./main.css"],
+      input: ["./main.css", "./suggest.js"],
       output: {
         dir: "./dist",
       },